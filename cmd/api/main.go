@@ -1,9 +1,15 @@
 package main
 
 import (
+    "context"
     "log"
     "my-golang-api/internal/api"
     "net/http"
+    "os"
+    "os/signal"
+    "strconv"
+    "syscall"
+    "time"
     "github.com/gorilla/mux"
 )
 
@@ -12,7 +18,7 @@ func sendDataWrapper(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     streamID, exists := vars["stream_id"]
     if !exists || streamID == "" {
-        http.Error(w, "Stream ID is required", http.StatusBadRequest)
+        api.WriteError(w, r, api.NewAPIError(http.StatusBadRequest, api.ErrCodeInvalidRequest, "Stream ID is required"))
         return
     }
     
@@ -23,29 +29,209 @@ func sendDataWrapper(w http.ResponseWriter, r *http.Request) {
 
 
 func main() {
-	api.RegisterMetrics()
-    router := mux.NewRouter()
+    if err := api.ConfigureLoggingFromEnv(); err != nil {
+        log.Fatalf("Failed to configure logging: %s", err)
+    }
+
+    metrics := api.NewMetrics(api.MetricsOptions{RuntimeCollectors: true})
+    api.UseMetrics(metrics)
+
+    brokerConfig, err := api.BrokerConfigFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to configure Kafka brokers: %s", err)
+    }
+    api.UseBrokerConfig(brokerConfig)
+
+    // Report unreachable brokers and rejected credentials up front rather than on the first request
+    checkCtx, cancelCheck := context.WithTimeout(context.Background(), 15*time.Second)
+    if err := api.CheckBrokerConnectivity(checkCtx, brokerConfig); err != nil {
+        log.Printf("Kafka connectivity check failed: %s", err)
+    } else {
+        log.Printf("Connected to Kafka brokers %v", brokerConfig.Brokers)
+    }
+    cancelCheck()
+
+    shutdownTracing, err := api.InitTracing(context.Background())
+    if err != nil {
+        log.Fatalf("Failed to configure tracing: %s", err)
+    }
+    defer shutdownTracing(context.Background())
+
+    auditor, err := api.ConfigureAuditFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to configure audit log: %s", err)
+    }
+    defer auditor.Close()
+
+    streamStore, err := api.StreamStoreFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to open stream store: %s", err)
+    }
+    if err := api.UseStreamStore(streamStore); err != nil {
+        log.Fatalf("Failed to load streams: %s", err)
+    }
+    api.SetStreamAutoCreate(api.StreamAutoCreateFromEnv())
+
+    schemaStore, err := api.SchemaStoreFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to open schema store: %s", err)
+    }
+    api.UseSchemaStore(schemaStore)
+
+    webhooks, err := api.WebhookManagerFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to open webhook store: %s", err)
+    }
+    api.UseWebhooks(webhooks)
+
+    routes, err := api.RouteManagerFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to open route store: %s", err)
+    }
+    api.UseRoutes(routes)
+
+    root := mux.NewRouter()
+
+    // Tag every request with a correlation id before anything else logs it
+    root.Use(api.RequestIDMiddleware())
 
-    router.Use(apiKeyAuthMiddleware)
+    // Instrument first so rejected and unauthenticated requests are counted too
+    root.Use(metrics.Middleware())
+    root.Use(api.TracingMiddleware())
+
+    // mux skips middleware for requests no route matches, so 404s and 405s
+    // get theirs here; they are counted under the "unmatched" route
+    unmatched := func(handler http.Handler) http.Handler {
+        return api.RequestIDMiddleware()(metrics.Middleware()(api.TracingMiddleware()(handler)))
+    }
+    root.NotFoundHandler = unmatched(api.NotFoundHandler())
+    root.MethodNotAllowedHandler = unmatched(api.MethodNotAllowedHandler())
+
+    // Probes for the orchestrator are served without authentication or rate limiting
+    root.HandleFunc("/healthz", api.Healthz).Methods("GET")
+    root.HandleFunc("/readyz", api.Readyz).Methods("GET")
+
+    router := root.PathPrefix("/").Subrouter()
+
+    certPrincipals, err := api.NewCertPrincipalMapper(os.Getenv("TLS_CLIENT_PRINCIPALS"))
+    if err != nil {
+        log.Fatalf("Failed to configure client certificate principals: %s", err)
+    }
+    router.Use(authMiddleware(certPrincipals))
+
+    // Requests are billed to, and use the streams of, their principal's tenant
+    tenants, err := api.NewTenantMapper(os.Getenv("TENANT_PRINCIPALS"))
+    if err != nil {
+        log.Fatalf("Failed to configure tenants: %s", err)
+    }
+    api.UseTenantMapper(tenants)
+
+    // Audit records only believe X-Forwarded-For from these proxies
+    proxies, err := api.NewTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+    if err != nil {
+        log.Fatalf("Failed to configure trusted proxies: %s", err)
+    }
+    api.UseTrustedProxies(proxies)
+
+    // Only these principals may use the admin API, such as attaching topics
+    api.UseAdminPrincipals(api.NewAdminPrincipals(os.Getenv("ADMIN_PRINCIPALS")))
 
 	
 
-    // Use the global rate limiter middleware
-    router.Use(api.RateLimiterMiddleware())
+    // Use the global rate limiter middleware, shared between replicas when
+    // RATE_LIMIT_STORE=redis
+    rateLimitStore, err := api.NewRateLimitStoreFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to configure rate limiter: %s", err)
+    }
+    router.Use(api.RateLimiterMiddlewareWithStore(rateLimitStore, api.RateLimitFailOpen()))
 
 	
   
 
     // Update handlers to use api package
     router.HandleFunc("/stream/start", api.StartStream).Methods("POST")
+    router.HandleFunc("/streams", api.ListStreams).Methods("GET")
+    router.HandleFunc("/streams/attach", api.AttachStream).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}", api.DescribeStream).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/schema", api.GetStreamSchemas).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/schema", api.RegisterStreamSchema).Methods("POST")
     router.HandleFunc("/stream/{stream_id}/send", sendDataWrapper).Methods("POST")
     router.HandleFunc("/stream/{stream_id}/results", api.GetResults).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/fetch", api.FetchRecords).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/deliveries/{delivery_id}", api.GetDelivery).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/webhooks", api.CreateWebhook).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/webhooks", api.ListWebhooks).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}", api.GetWebhook).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}", api.DeleteWebhook).Methods("DELETE")
+    router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}/dead-letters", api.GetWebhookDeadLetters).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/routes", api.CreateRoute).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/routes", api.ListRoutes).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}", api.GetRoute).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}", api.DeleteRoute).Methods("DELETE")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}/pause", api.PauseRoute).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}/resume", api.ResumeRoute).Methods("POST")
+    router.HandleFunc("/tenants/{tenant}/usage", api.GetTenantUsage).Methods("GET")
+
+    router.Handle("/metrics", metrics.Handler())
+    router.HandleFunc("/debug/broker", api.DebugBroker).Methods("GET")
+
+
+    tlsConfig, certReloader, err := api.TLSConfigFromEnv()
+    if err != nil {
+        log.Fatalf("Failed to configure TLS: %s", err)
+    }
+    server := &http.Server{Addr: ":8080", Handler: root, TLSConfig: tlsConfig}
 
-    router.Handle("/metrics", api.MetricsHandler())
+    // On SIGTERM, fail readiness first so the load balancer drains this
+    // replica, then stop accepting connections and let requests finish
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+    shutdownDone := make(chan struct{})
+    go func() {
+        defer close(shutdownDone)
+        <-ctx.Done()
+        api.SetDraining(true)
+        log.Println("Draining: readiness now failing")
+        time.Sleep(time.Duration(drainDelaySeconds()) * time.Second)
 
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        defer cancel()
+        if err := server.Shutdown(shutdownCtx); err != nil {
+            log.Printf("Graceful shutdown failed: %s", err)
+        }
+        // Stop routing, leaving records not yet written to every target
+        // uncommitted, then deliver records accepted by async sends before
+        // exiting
+        routes.Close()
+        api.FlushAsyncProducers()
+        // Let webhook delivery attempts in flight finish; undelivered records
+        // stay uncommitted and are delivered after a restart
+        webhooks.Close()
+    }()
 
-    log.Println("Server is running on http://localhost:8080")
-    if err := http.ListenAndServe(":8080", router); err != nil {
+    if tlsConfig == nil {
+        log.Println("Server is running on http://localhost:8080")
+        err = server.ListenAndServe()
+    } else {
+        // Pick up renewed certificates without a restart
+        go certReloader.Watch(ctx, 30*time.Second)
+        log.Println("Server is running on https://localhost:8080")
+        err = server.ListenAndServeTLS("", "")
+    }
+    if err != nil && err != http.ErrServerClosed {
         log.Fatalf("Failed to start server: %s", err)
     }
+    <-shutdownDone
+    log.Println("Server stopped")
+}
+
+// drainDelaySeconds is how long readiness fails before the listener closes,
+// from DRAIN_DELAY_SECONDS (default 5).
+func drainDelaySeconds() int {
+    seconds, err := strconv.Atoi(os.Getenv("DRAIN_DELAY_SECONDS"))
+    if err != nil || seconds < 0 {
+        return 5
+    }
+    return seconds
 }
@@ -1,23 +1,44 @@
 package main
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "my-golang-api/internal/api"
     "net/http"
     "os"
+
+    "github.com/gorilla/mux"
 )
 
-// Middleware function to check for the API key in each request
-func apiKeyAuthMiddleware(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        apiKey := r.Header.Get("X-API-Key")
-        expectedApiKey := os.Getenv("API_KEY") // Retrieve the expected API key from environment variables
+// Middleware function to authenticate each request by verified client
+// certificate (when mTLS is enabled) or by API key
+func authMiddleware(certPrincipals *api.CertPrincipalMapper) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            // A verified client certificate with an authorized subject is sufficient
+            if principal, ok := certPrincipals.Principal(r); ok {
+                next.ServeHTTP(w, api.WithPrincipal(r, principal))
+                return
+            }
+
+            apiKey := r.Header.Get("X-API-Key")
+            expectedApiKey := os.Getenv("API_KEY") // Retrieve the expected API key from environment variables
 
-        // Check if the API key is missing or incorrect
-        if apiKey == "" || apiKey != expectedApiKey {
-            http.Error(w, "Unauthorized: Invalid API key", http.StatusUnauthorized)
-            return
-        }
+            // Check if the API key is missing or incorrect
+            if apiKey == "" || apiKey != expectedApiKey {
+                api.Audit(r, api.AuditActionAuth, mux.Vars(r)["stream_id"], api.AuditOutcomeDenied, "invalid API key")
+                api.WriteError(w, r, api.NewAPIError(http.StatusUnauthorized, api.ErrCodeUnauthorized, "Missing or invalid API key"))
+                return
+            }
+
+            // If the API key is valid, continue with the request as its principal
+            next.ServeHTTP(w, api.WithPrincipal(r, apiKeyPrincipal(apiKey)))
+        })
+    }
+}
 
-        // If the API key is valid, continue with the request
-        next.ServeHTTP(w, r)
-    })
+// apiKeyPrincipal identifies an API key in audit records without revealing it.
+func apiKeyPrincipal(apiKey string) string {
+    sum := sha256.Sum256([]byte(apiKey))
+    return "apikey:" + hex.EncodeToString(sum[:4])
 }
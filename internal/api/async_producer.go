@@ -0,0 +1,241 @@
+// internal/api/async_producer.go
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+    "github.com/sirupsen/logrus"
+)
+
+// DeliveryIDHeader is the Kafka record header carrying the delivery id of
+// records sent asynchronously.
+const DeliveryIDHeader = "delivery-id"
+
+// Delivery report statuses.
+const (
+    DeliveryPending   = "pending"
+    DeliveryDelivered = "delivered"
+    DeliveryFailed    = "failed"
+)
+
+// Async produce defaults, overridable through the environment
+const (
+    defaultAsyncBatchSize      = 500
+    defaultAsyncBatchTimeoutMs = 10
+    defaultAsyncQueueSize      = 10000
+    defaultDeliveryReportTTL   = 600 // seconds
+    defaultDeliveryReportMax   = 100000
+)
+
+// ErrProduceQueueFull is returned when a stream already has as many records
+// in flight as its async queue holds.
+var ErrProduceQueueFull = errors.New("async produce queue is full")
+
+// DeliveryReport is the outcome of a record sent asynchronously. Partition
+// and Offset are set once the record is delivered.
+type DeliveryReport struct {
+    ID          string     `json:"delivery_id"`
+    StreamID    string     `json:"stream_id"`
+    Status      string     `json:"status"`
+    Durability  string     `json:"durability,omitempty"`
+    Partition   *int       `json:"partition,omitempty"`
+    Offset      *int64     `json:"offset,omitempty"`
+    Error       string     `json:"error,omitempty"`
+    QueuedAt    time.Time  `json:"queued_at"`
+    CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// deliveryTracker keeps delivery reports for DELIVERY_REPORT_TTL seconds
+// after their records were queued, and at most DELIVERY_REPORT_MAX of them.
+type deliveryTracker struct {
+    mu      sync.Mutex
+    reports map[string]*DeliveryReport
+    order   []string
+    ttl     time.Duration
+    max     int
+}
+
+func newDeliveryTracker(ttl time.Duration, max int) *deliveryTracker {
+    return &deliveryTracker{reports: make(map[string]*DeliveryReport), ttl: ttl, max: max}
+}
+
+var deliveries = newDeliveryTracker(
+    time.Duration(envInt64("DELIVERY_REPORT_TTL", defaultDeliveryReportTTL))*time.Second,
+    int(envInt64("DELIVERY_REPORT_MAX", defaultDeliveryReportMax)),
+)
+
+// add records a pending delivery, expiring the oldest reports and evicting
+// them when the tracker is full.
+func (dt *deliveryTracker) add(id, streamID string) {
+    dt.mu.Lock()
+    defer dt.mu.Unlock()
+
+    now := time.Now()
+    for len(dt.order) > 0 {
+        oldest, exists := dt.reports[dt.order[0]]
+        if exists && now.Sub(oldest.QueuedAt) < dt.ttl && len(dt.order) < dt.max {
+            break
+        }
+        delete(dt.reports, dt.order[0])
+        dt.order = dt.order[1:]
+    }
+    dt.reports[id] = &DeliveryReport{ID: id, StreamID: streamID, Status: DeliveryPending, QueuedAt: now}
+    dt.order = append(dt.order, id)
+}
+
+// complete records the outcome of a delivery made with the given
+// acknowledgement level.
+func (dt *deliveryTracker) complete(id, acks string, m kafka.Message, err error) {
+    dt.mu.Lock()
+    defer dt.mu.Unlock()
+
+    report, exists := dt.reports[id]
+    if !exists {
+        return
+    }
+    now := time.Now()
+    report.CompletedAt = &now
+    if err != nil {
+        report.Status, report.Error = DeliveryFailed, kafkaAPIError(err).Detail
+        return
+    }
+    partition, offset := m.Partition, m.Offset
+    report.Status, report.Durability, report.Partition, report.Offset = DeliveryDelivered, acks, &partition, &offset
+}
+
+// get returns a copy of a delivery report.
+func (dt *deliveryTracker) get(id string) (DeliveryReport, bool) {
+    dt.mu.Lock()
+    defer dt.mu.Unlock()
+
+    report, exists := dt.reports[id]
+    if !exists {
+        return DeliveryReport{}, false
+    }
+    return *report, true
+}
+
+// asyncProducer batches a stream's records in the background. The slots
+// channel bounds the records queued but not yet acknowledged; tenants holds
+// the tenant each of them was reserved for, by delivery id.
+type asyncProducer struct {
+    writer  *kafka.Writer
+    acks    string
+    slots   chan struct{}
+    mu      sync.Mutex
+    tenants map[string]string
+}
+
+// newAsyncProducer turns writer into a batching writer that reports each
+// record's outcome to the delivery tracker.
+func newAsyncProducer(writer *kafka.Writer, streamID, acks string) *asyncProducer {
+    ap := &asyncProducer{
+        writer:  writer,
+        acks:    acks,
+        slots:   make(chan struct{}, envInt64("ASYNC_QUEUE_SIZE", defaultAsyncQueueSize)),
+        tenants: make(map[string]string),
+    }
+    writer.Async = true
+    writer.BatchSize = int(envInt64("ASYNC_BATCH_SIZE", defaultAsyncBatchSize))
+    writer.BatchTimeout = time.Duration(envInt64("ASYNC_BATCH_TIMEOUT_MS", defaultAsyncBatchTimeoutMs)) * time.Millisecond
+    writer.Completion = func(messages []kafka.Message, err error) {
+        for _, m := range messages {
+            <-ap.slots
+            deliveryID := kafkaHeaderCarrier{headers: &m.Headers}.Get(DeliveryIDHeader)
+            // Like sync sends, records Kafka refused do not count against
+            // the tenant's quota
+            if tenant, exists := ap.takeTenant(deliveryID); exists && err != nil {
+                quotaManager.Release(tenant, int64(len(m.Value)))
+            }
+            deliveries.complete(deliveryID, ap.acks, m, err)
+        }
+        metrics := currentMetrics()
+        label := metrics.streamLabel(streamID)
+        logger := log.WithField("stream_id", streamID)
+        if err != nil {
+            metrics.kafkaProducerErrors.WithLabelValues(label, producerErrorCause(err)).Add(float64(len(messages)))
+            logger.WithFields(logrus.Fields{"records": len(messages), "error": err.Error()}).Error("Failed to deliver queued records to Kafka")
+            return
+        }
+        metrics.kafkaMessagesProduced.Add(float64(len(messages)))
+
+        // Records are only counted and pushed to subscribers once Kafka has them
+        for i := range messages {
+            metrics.streamBytesIn.WithLabelValues(label).Add(float64(len(messages[i].Value)))
+            pushRecord(context.Background(), logger, streamID, messages[i].Value, deliveredText(&messages[i]), messages[i].Headers)
+        }
+    }
+    return ap
+}
+
+// deliveredText returns the text a delivered record was sent as: records
+// framed with a schema are decoded back to the JSON that was sent.
+func deliveredText(m *kafka.Message) string {
+    value, contentType := m.Value, recordContentType(m)
+    if contentType == ContentTypeJSON && isFramedRecord(value) {
+        if decoded, err := DecodeRecord(value); err == nil {
+            value = decoded
+        }
+    }
+    return textPayload(value, contentType)
+}
+
+// enqueue queues a record carrying a DeliveryIDHeader whose bytes were
+// reserved for tenant, or fails with ErrProduceQueueFull when the stream's
+// queue is full. The reservation is released if Kafka refuses the record;
+// when enqueue fails, releasing it is up to the caller.
+func (ap *asyncProducer) enqueue(ctx context.Context, streamID, deliveryID, tenant string, message kafka.Message) error {
+    select {
+    case ap.slots <- struct{}{}:
+    default:
+        return ErrProduceQueueFull
+    }
+    deliveries.add(deliveryID, streamID)
+    ap.mu.Lock()
+    ap.tenants[deliveryID] = tenant
+    ap.mu.Unlock()
+    if err := ap.writer.WriteMessages(ctx, message); err != nil {
+        <-ap.slots
+        ap.takeTenant(deliveryID)
+        deliveries.complete(deliveryID, ap.acks, message, err)
+        return err
+    }
+    return nil
+}
+
+// takeTenant returns and forgets the tenant a queued record was reserved for.
+func (ap *asyncProducer) takeTenant(deliveryID string) (string, bool) {
+    ap.mu.Lock()
+    defer ap.mu.Unlock()
+    tenant, exists := ap.tenants[deliveryID]
+    delete(ap.tenants, deliveryID)
+    return tenant, exists
+}
+
+// FlushAsyncProducers delivers every record queued by async sends; call it on
+// shutdown once the server has stopped accepting requests.
+func FlushAsyncProducers() {
+    streamManager.FlushAsyncProducers()
+}
+
+// GetDelivery handles GET /stream/{stream_id}/deliveries/{delivery_id},
+// reporting whether a record sent with ?async=true reached Kafka.
+func GetDelivery(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    streamID := vars["stream_id"]
+    if _, ok := requireStream(w, r, streamID, AuditActionDeliveryLookup); !ok {
+        return
+    }
+    report, exists := deliveries.get(vars["delivery_id"])
+    if !exists || report.StreamID != streamID {
+        writeError(w, r, http.StatusNotFound, ErrCodeDeliveryNotFound, "Delivery "+vars["delivery_id"]+" is unknown or has expired")
+        return
+    }
+    writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,414 @@
+// internal/api/audit.go
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/segmentio/kafka-go"
+)
+
+// Audit actions
+const (
+    AuditActionStreamStart       = "stream.start"
+    AuditActionStreamAttach      = "stream.attach"
+    AuditActionStreamSchema      = "stream.schema"
+    AuditActionStreamSend        = "stream.send"
+    AuditActionStreamSubscribe   = "stream.subscribe"
+    AuditActionStreamFetch       = "stream.fetch"
+    AuditActionDeliveryLookup    = "delivery.lookup"
+    AuditActionStreamUnsubscribe = "stream.unsubscribe"
+    AuditActionWebhookCreate     = "webhook.create"
+    AuditActionWebhookDelete     = "webhook.delete"
+    AuditActionRouteCreate       = "route.create"
+    AuditActionRouteDelete       = "route.delete"
+    AuditActionRoutePause        = "route.pause"
+    AuditActionRouteResume       = "route.resume"
+    AuditActionAuth              = "auth"
+    AuditActionRateLimit         = "ratelimit"
+)
+
+// Audit outcomes
+const (
+    AuditOutcomeSuccess  = "success"
+    AuditOutcomeFailure  = "failure"
+    AuditOutcomeRejected = "rejected"
+    AuditOutcomeDenied   = "denied"
+)
+
+// Default rotation settings for the audit log file
+const (
+    defaultAuditMaxBytes   = 100 << 20 // 100MB per file
+    defaultAuditMaxBackups = 10
+)
+
+// AuditEvent is a single structured audit record.
+type AuditEvent struct {
+    Time      time.Time `json:"time"`
+    Principal string    `json:"principal"`
+    Action    string    `json:"action"`
+    Stream    string    `json:"stream,omitempty"`
+    Outcome   string    `json:"outcome"`
+    ClientIP  string    `json:"client_ip"`
+    RequestID string    `json:"request_id,omitempty"`
+    Detail    string    `json:"detail,omitempty"`
+}
+
+// AuditSink receives audit events as encoded JSON lines.
+type AuditSink interface {
+    WriteEvent(event []byte) error
+    Close() error
+}
+
+// Auditor fans audit events out to its sinks. The zero value discards events.
+type Auditor struct {
+    mu    sync.Mutex
+    sinks []AuditSink
+}
+
+// NewAuditor creates an Auditor writing to sinks.
+func NewAuditor(sinks ...AuditSink) *Auditor {
+    return &Auditor{sinks: sinks}
+}
+
+// Emit writes event to every sink. Sink failures are logged and do not fail
+// the request. Sinks are written outside the lock, so a slow sink does not
+// hold up other requests' events; sinks serialize their own writes.
+func (a *Auditor) Emit(event AuditEvent) {
+    a.mu.Lock()
+    sinks := append([]AuditSink(nil), a.sinks...)
+    a.mu.Unlock()
+
+    if len(sinks) == 0 {
+        return
+    }
+    if event.Time.IsZero() {
+        event.Time = time.Now().UTC()
+    }
+    line, err := json.Marshal(event)
+    if err != nil {
+        log.WithField("error", err.Error()).Error("Failed to encode audit event")
+        return
+    }
+    for _, sink := range sinks {
+        if err := sink.WriteEvent(line); err != nil {
+            log.WithField("error", err.Error()).Error("Failed to write audit event")
+        }
+    }
+}
+
+// Close closes every sink.
+func (a *Auditor) Close() error {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    var firstErr error
+    for _, sink := range a.sinks {
+        if err := sink.Close(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    a.sinks = nil
+    return firstErr
+}
+
+// RotatingFile is an AuditSink appending JSON lines to a file, rotating it to
+// path.1 ... path.N once it grows past maxBytes.
+type RotatingFile struct {
+    path       string
+    maxBytes   int64
+    maxBackups int
+
+    mu   sync.Mutex
+    file *os.File
+    size int64
+}
+
+// NewRotatingFile opens (or creates) path for appending.
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+    rf := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+    if err := rf.open(); err != nil {
+        return nil, err
+    }
+    return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+    file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+    if err != nil {
+        return err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+    rf.file = file
+    rf.size = info.Size()
+    return nil
+}
+
+// rotate shifts path.N-1 to path.N down to path to path.1. Callers must hold rf.mu.
+func (rf *RotatingFile) rotate() error {
+    if err := rf.file.Close(); err != nil {
+        return err
+    }
+    for i := rf.maxBackups - 1; i >= 1; i-- {
+        os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+    }
+    if rf.maxBackups > 0 {
+        if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+            return err
+        }
+    } else if err := os.Remove(rf.path); err != nil {
+        return err
+    }
+    return rf.open()
+}
+
+func (rf *RotatingFile) WriteEvent(event []byte) error {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+
+    if rf.file == nil {
+        return fmt.Errorf("audit log %s is closed", rf.path)
+    }
+    if rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(event))+1 > rf.maxBytes {
+        if err := rf.rotate(); err != nil {
+            return err
+        }
+    }
+    n, err := rf.file.Write(append(event, '\n'))
+    rf.size += int64(n)
+    return err
+}
+
+func (rf *RotatingFile) Close() error {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+
+    if rf.file == nil {
+        return nil
+    }
+    err := rf.file.Close()
+    rf.file = nil
+    return err
+}
+
+// kafkaAuditSink publishes audit events to a dedicated topic without blocking requests.
+type kafkaAuditSink struct {
+    writer *kafka.Writer
+}
+
+func (s *kafkaAuditSink) WriteEvent(event []byte) error {
+    return s.writer.WriteMessages(context.Background(), kafka.Message{Value: event})
+}
+
+func (s *kafkaAuditSink) Close() error {
+    return s.writer.Close()
+}
+
+var auditor = &Auditor{}
+
+// ConfigureAuditFromEnv installs the audit sinks selected by AUDIT_LOG_FILE
+// (with AUDIT_LOG_MAX_BYTES and AUDIT_LOG_MAX_BACKUPS) and AUDIT_KAFKA_TOPIC.
+// The returned Auditor should be closed on shutdown.
+func ConfigureAuditFromEnv() (*Auditor, error) {
+    var sinks []AuditSink
+
+    if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+        file, err := NewRotatingFile(path,
+            envInt64("AUDIT_LOG_MAX_BYTES", defaultAuditMaxBytes),
+            int(envInt64("AUDIT_LOG_MAX_BACKUPS", defaultAuditMaxBackups)))
+        if err != nil {
+            return nil, fmt.Errorf("opening audit log: %w", err)
+        }
+        sinks = append(sinks, file)
+    }
+
+    if topic := os.Getenv("AUDIT_KAFKA_TOPIC"); topic != "" {
+        writer := KafkaWriter(brokerConfig.Brokers, topic)
+        if writer == nil {
+            for _, sink := range sinks {
+                sink.Close()
+            }
+            return nil, fmt.Errorf("failed to initialize Kafka writer for audit topic %s", topic)
+        }
+        writer.Async = true
+        sinks = append(sinks, &kafkaAuditSink{writer: writer})
+    }
+
+    auditor = NewAuditor(sinks...)
+    return auditor, nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of r carrying the authenticated principal.
+func WithPrincipal(r *http.Request, principal string) *http.Request {
+    return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// PrincipalFromRequest returns the authenticated principal, or "anonymous".
+func PrincipalFromRequest(r *http.Request) string {
+    if principal, ok := r.Context().Value(principalKey{}).(string); ok && principal != "" {
+        return principal
+    }
+    return "anonymous"
+}
+
+// AdminPrincipals are the principals allowed to use the admin API, such as
+// attaching existing topics. The zero value allows none.
+type AdminPrincipals struct {
+    principals map[string]bool
+}
+
+// NewAdminPrincipals parses principals separated by commas, as authenticated,
+// e.g. "apikey:1a2b3c4d" or a client certificate's mapped principal.
+func NewAdminPrincipals(spec string) *AdminPrincipals {
+    admins := &AdminPrincipals{principals: make(map[string]bool)}
+    for _, principal := range strings.Split(spec, ",") {
+        if principal = strings.TrimSpace(principal); principal != "" {
+            admins.principals[principal] = true
+        }
+    }
+    return admins
+}
+
+// Allows reports whether principal is an admin.
+func (a *AdminPrincipals) Allows(principal string) bool {
+    return a.principals[principal]
+}
+
+var (
+    adminPrincipals   = &AdminPrincipals{}
+    adminPrincipalsMu sync.Mutex
+)
+
+// UseAdminPrincipals replaces the principals allowed to use the admin API.
+func UseAdminPrincipals(a *AdminPrincipals) {
+    adminPrincipalsMu.Lock()
+    defer adminPrincipalsMu.Unlock()
+    adminPrincipals = a
+}
+
+// isAdmin reports whether the request's principal may use the admin API.
+func isAdmin(r *http.Request) bool {
+    adminPrincipalsMu.Lock()
+    defer adminPrincipalsMu.Unlock()
+    return adminPrincipals.Allows(PrincipalFromRequest(r))
+}
+
+// TrustedProxies are the networks of the reverse proxies whose
+// X-Forwarded-For headers are believed. The zero value trusts none.
+type TrustedProxies struct {
+    networks []*net.IPNet
+}
+
+// NewTrustedProxies parses CIDRs or single addresses separated by commas.
+func NewTrustedProxies(spec string) (*TrustedProxies, error) {
+    proxies := &TrustedProxies{}
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            ip := net.ParseIP(entry)
+            if ip == nil {
+                return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+            }
+            bits := 8 * net.IPv6len
+            if ip.To4() != nil {
+                ip, bits = ip.To4(), 8*net.IPv4len
+            }
+            proxies.networks = append(proxies.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+            continue
+        }
+        _, network, err := net.ParseCIDR(entry)
+        if err != nil {
+            return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+        }
+        proxies.networks = append(proxies.networks, network)
+    }
+    return proxies, nil
+}
+
+// trusts reports whether addr is the address of a trusted proxy.
+func (p *TrustedProxies) trusts(addr string) bool {
+    ip := net.ParseIP(addr)
+    if ip == nil {
+        return false
+    }
+    for _, network := range p.networks {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
+
+var (
+    trustedProxies   = &TrustedProxies{}
+    trustedProxiesMu sync.Mutex
+)
+
+// UseTrustedProxies replaces the proxies whose X-Forwarded-For is believed.
+func UseTrustedProxies(p *TrustedProxies) {
+    trustedProxiesMu.Lock()
+    defer trustedProxiesMu.Unlock()
+    trustedProxies = p
+}
+
+func currentTrustedProxies() *TrustedProxies {
+    trustedProxiesMu.Lock()
+    defer trustedProxiesMu.Unlock()
+    return trustedProxies
+}
+
+// clientIP returns the originating client address. X-Forwarded-For is only
+// believed when the request comes from a trusted proxy, and is read from the
+// nearest hop back to the first address that is not a trusted proxy, since
+// clients can put anything at its start.
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    proxies := currentTrustedProxies()
+    if !proxies.trusts(host) {
+        return host
+    }
+    hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(hops) - 1; i >= 0; i-- {
+        hop := strings.TrimSpace(hops[i])
+        if net.ParseIP(hop) == nil {
+            break
+        }
+        host = hop
+        if !proxies.trusts(hop) {
+            break
+        }
+    }
+    return host
+}
+
+// Audit records action on streamID for the request's principal.
+func Audit(r *http.Request, action, streamID, outcome, detail string) {
+    auditor.Emit(AuditEvent{
+        Principal: PrincipalFromRequest(r),
+        Action:    action,
+        Stream:    streamID,
+        Outcome:   outcome,
+        ClientIP:  clientIP(r),
+        RequestID: RequestIDFromContext(r.Context()),
+        Detail:    detail,
+    })
+}
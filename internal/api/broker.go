@@ -0,0 +1,212 @@
+// internal/api/broker.go
+package api
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/segmentio/kafka-go"
+    "github.com/segmentio/kafka-go/sasl"
+    "github.com/segmentio/kafka-go/sasl/plain"
+    "github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const defaultBroker = "localhost:9092"
+
+// BrokerConfig holds the addresses and security settings used for every
+// connection to the Kafka cluster: topic creation, writers and readers.
+type BrokerConfig struct {
+    Brokers []string
+    TLS     *tls.Config
+    SASL    sasl.Mechanism
+}
+
+// brokerConfig is the cluster configuration used by handlers and the stream manager.
+var brokerConfig = &BrokerConfig{Brokers: []string{defaultBroker}}
+
+// UseBrokerConfig replaces the cluster configuration used by the package.
+func UseBrokerConfig(cfg *BrokerConfig) {
+    brokerConfig = cfg
+}
+
+// Dialer returns a kafka.Dialer applying the configured TLS and SASL settings.
+func (c *BrokerConfig) Dialer() *kafka.Dialer {
+    return &kafka.Dialer{
+        Timeout:       10 * time.Second,
+        DualStack:     true,
+        TLS:           c.TLS,
+        SASLMechanism: c.SASL,
+    }
+}
+
+// Client returns a kafka.Client for admin requests with the configured TLS and SASL settings.
+func (c *BrokerConfig) Client() *kafka.Client {
+    return &kafka.Client{
+        Addr:    kafka.TCP(c.Brokers...),
+        Timeout: 10 * time.Second,
+        Transport: &kafka.Transport{
+            TLS:  c.TLS,
+            SASL: c.SASL,
+        },
+    }
+}
+
+// envOrFile returns the value of name, or the trimmed contents of the file
+// named by name+"_FILE" so secrets can be mounted rather than exported.
+func envOrFile(name string) (string, error) {
+    if value := os.Getenv(name); value != "" {
+        return value, nil
+    }
+    path := os.Getenv(name + "_FILE")
+    if path == "" {
+        return "", nil
+    }
+    contents, err := os.ReadFile(path)
+    if err != nil {
+        return "", fmt.Errorf("reading %s_FILE: %w", name, err)
+    }
+    return strings.TrimSpace(string(contents)), nil
+}
+
+// brokerTLSFromEnv builds the client TLS configuration from KAFKA_TLS_ENABLED,
+// KAFKA_TLS_CA_FILE, KAFKA_TLS_CERT_FILE, KAFKA_TLS_KEY_FILE and
+// KAFKA_TLS_INSECURE_SKIP_VERIFY. Setting any file enables TLS.
+func brokerTLSFromEnv() (*tls.Config, error) {
+    enabled, _ := strconv.ParseBool(os.Getenv("KAFKA_TLS_ENABLED"))
+    caFile := os.Getenv("KAFKA_TLS_CA_FILE")
+    certFile, keyFile := os.Getenv("KAFKA_TLS_CERT_FILE"), os.Getenv("KAFKA_TLS_KEY_FILE")
+    if !enabled && caFile == "" && certFile == "" {
+        return nil, nil
+    }
+
+    insecure, _ := strconv.ParseBool(os.Getenv("KAFKA_TLS_INSECURE_SKIP_VERIFY"))
+    config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+
+    if caFile != "" {
+        caPEM, err := os.ReadFile(caFile)
+        if err != nil {
+            return nil, fmt.Errorf("reading broker CA bundle: %w", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(caPEM) {
+            return nil, fmt.Errorf("no certificates found in broker CA bundle %s", caFile)
+        }
+        config.RootCAs = pool
+    }
+    if certFile != "" {
+        cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+        if err != nil {
+            return nil, fmt.Errorf("loading broker client certificate: %w", err)
+        }
+        config.Certificates = []tls.Certificate{cert}
+    }
+    return config, nil
+}
+
+// brokerSASLFromEnv builds the SASL mechanism named by KAFKA_SASL_MECHANISM
+// ("plain", "scram-sha-256" or "scram-sha-512") with KAFKA_SASL_USERNAME and
+// KAFKA_SASL_PASSWORD, either of which may be read from a _FILE instead.
+func brokerSASLFromEnv() (sasl.Mechanism, error) {
+    mechanism := strings.ToLower(os.Getenv("KAFKA_SASL_MECHANISM"))
+    if mechanism == "" {
+        return nil, nil
+    }
+
+    username, err := envOrFile("KAFKA_SASL_USERNAME")
+    if err != nil {
+        return nil, err
+    }
+    password, err := envOrFile("KAFKA_SASL_PASSWORD")
+    if err != nil {
+        return nil, err
+    }
+    if username == "" || password == "" {
+        return nil, fmt.Errorf("KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD are required for SASL mechanism %s", mechanism)
+    }
+
+    switch mechanism {
+    case "plain":
+        return plain.Mechanism{Username: username, Password: password}, nil
+    case "scram-sha-256":
+        return scram.Mechanism(scram.SHA256, username, password)
+    case "scram-sha-512":
+        return scram.Mechanism(scram.SHA512, username, password)
+    default:
+        return nil, fmt.Errorf("unsupported KAFKA_SASL_MECHANISM %q", mechanism)
+    }
+}
+
+// BrokerConfigFromEnv reads KAFKA_BROKERS (comma-separated, default
+// localhost:9092) and the TLS and SASL settings.
+func BrokerConfigFromEnv() (*BrokerConfig, error) {
+    cfg := &BrokerConfig{Brokers: []string{defaultBroker}}
+    if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+        cfg.Brokers = nil
+        for _, broker := range strings.Split(brokers, ",") {
+            if broker = strings.TrimSpace(broker); broker != "" {
+                cfg.Brokers = append(cfg.Brokers, broker)
+            }
+        }
+    }
+
+    var err error
+    if cfg.TLS, err = brokerTLSFromEnv(); err != nil {
+        return nil, err
+    }
+    if cfg.SASL, err = brokerSASLFromEnv(); err != nil {
+        return nil, err
+    }
+    return cfg, nil
+}
+
+// CheckBrokerConnectivity connects to the first reachable broker and reads
+// cluster metadata, returning an error that distinguishes network, TLS and
+// authentication failures.
+func CheckBrokerConnectivity(ctx context.Context, cfg *BrokerConfig) error {
+    dialer := cfg.Dialer()
+    var errs []error
+    for _, broker := range cfg.Brokers {
+        conn, err := dialer.DialContext(ctx, "tcp", broker)
+        if err != nil {
+            errs = append(errs, describeBrokerError(broker, cfg, err))
+            continue
+        }
+        _, err = conn.Brokers()
+        conn.Close()
+        if err != nil {
+            errs = append(errs, describeBrokerError(broker, cfg, err))
+            continue
+        }
+        return nil
+    }
+    return errors.Join(errs...)
+}
+
+// describeBrokerError annotates err with the likely cause.
+func describeBrokerError(broker string, cfg *BrokerConfig, err error) error {
+    var netErr net.Error
+    var recordErr tls.RecordHeaderError
+    var certErr *tls.CertificateVerificationError
+    switch {
+    case errors.Is(err, kafka.SASLAuthenticationFailed):
+        return fmt.Errorf("broker %s: SASL %s authentication failed, check the username and password: %w", broker, cfg.SASL.Name(), err)
+    case errors.Is(err, kafka.UnsupportedSASLMechanism), errors.Is(err, kafka.IllegalSASLState):
+        return fmt.Errorf("broker %s: SASL mechanism rejected by the broker: %w", broker, err)
+    case errors.As(err, &certErr):
+        return fmt.Errorf("broker %s: TLS certificate verification failed, check KAFKA_TLS_CA_FILE: %w", broker, err)
+    case errors.As(err, &recordErr):
+        return fmt.Errorf("broker %s: TLS handshake failed, the listener may not be using TLS: %w", broker, err)
+    case errors.As(err, &netErr):
+        return fmt.Errorf("broker %s: unreachable: %w", broker, err)
+    default:
+        return fmt.Errorf("broker %s: %w", broker, err)
+    }
+}
@@ -0,0 +1,67 @@
+// internal/api/durability.go
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/segmentio/kafka-go"
+)
+
+// Producer acknowledgement levels, from fastest to most durable: none does
+// not wait for the broker, leader waits for the partition leader and all for
+// every in-sync replica.
+const (
+    AcksNone   = "none"
+    AcksLeader = "leader"
+    AcksAll    = "all"
+)
+
+// DurabilityQueued is the durability of async sends when they are answered:
+// the record is only held in this server's queue.
+const DurabilityQueued = "queued"
+
+var requiredAcks = map[string]kafka.RequiredAcks{AcksNone: kafka.RequireNone, AcksLeader: kafka.RequireOne, AcksAll: kafka.RequireAll}
+
+// acks returns the stream's default acknowledgement level.
+func (s StreamSpec) acks() string {
+    if s.Acks == "" {
+        return AcksAll
+    }
+    return s.Acks
+}
+
+// produceOptions reads the ?acks= and ?timeout_ms= overrides of a send,
+// falling back to the stream's acks and write_timeout_ms. A zero timeout
+// means none.
+func produceOptions(r *http.Request, info *StreamInfo, async bool) (string, time.Duration, error) {
+    query := r.URL.Query()
+    acks := query.Get("acks")
+    if _, ok := requiredAcks[acks]; acks != "" && !ok {
+        return "", 0, fmt.Errorf("acks must be one of %s, %s, %s", AcksNone, AcksLeader, AcksAll)
+    }
+    if acks == "" {
+        acks = AcksAll
+        if info.Config != nil {
+            acks = info.Config.acks()
+        }
+    }
+
+    var timeout time.Duration
+    if info.Config != nil && info.Config.WriteTimeoutMs > 0 {
+        timeout = time.Duration(info.Config.WriteTimeoutMs) * time.Millisecond
+    }
+    if value := query.Get("timeout_ms"); value != "" {
+        if async {
+            return "", 0, fmt.Errorf("timeout_ms does not apply to async sends")
+        }
+        ms, err := strconv.Atoi(value)
+        if err != nil || ms <= 0 {
+            return "", 0, fmt.Errorf("timeout_ms must be a positive number of milliseconds")
+        }
+        timeout = time.Duration(ms) * time.Millisecond
+    }
+    return acks, timeout, nil
+}
@@ -0,0 +1,183 @@
+// internal/api/errors.go
+package api
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "github.com/segmentio/kafka-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Machine-readable error codes returned in the "code" member of problem responses.
+const (
+    ErrCodeInvalidRequest         = "invalid_request"
+    ErrCodeUnauthorized           = "unauthorized"
+    ErrCodeForbidden              = "forbidden"
+    ErrCodeNotFound               = "not_found"
+    ErrCodeMethodNotAllowed       = "method_not_allowed"
+    ErrCodeStreamNotFound         = "stream_not_found"
+    ErrCodeStreamExists           = "stream_exists"
+    ErrCodeStreamReadOnly         = "stream_read_only"
+    ErrCodeTopicNotFound          = "topic_not_found"
+    ErrCodeSchemaInvalid          = "schema_invalid"
+    ErrCodeSchemaNotFound         = "schema_not_found"
+    ErrCodeSchemaMismatch         = "schema_mismatch"
+    ErrCodeSchemaIncompatible     = "schema_incompatible"
+    ErrCodeSchemaRegistryError    = "schema_registry_error"
+    ErrCodePayloadTooLarge        = "payload_too_large"
+    ErrCodeUnsupportedMediaType   = "unsupported_media_type"
+    ErrCodeRateLimited            = "rate_limited"
+    ErrCodeQuotaExceeded          = "quota_exceeded"
+    ErrCodeRateLimiterUnavailable = "rate_limiter_unavailable"
+    ErrCodeBrokerUnavailable      = "broker_unavailable"
+    ErrCodeProduceQueueFull       = "produce_queue_full"
+    ErrCodeDeliveryNotFound       = "delivery_not_found"
+    ErrCodeWebhookNotFound        = "webhook_not_found"
+    ErrCodeRouteNotFound          = "route_not_found"
+    ErrCodeBrokerTimeout          = "broker_timeout"
+    ErrCodeBrokerUnauthorized     = "broker_unauthorized"
+    ErrCodeBrokerError            = "broker_error"
+    ErrCodeInternal               = "internal_error"
+)
+
+// ProblemContentType is the media type of error responses (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// APIError is an error that knows how it should be presented to clients.
+// Err holds the underlying cause; it is logged but never sent to clients.
+// Errors lists individual problems, such as schema incompatibilities.
+type APIError struct {
+    Status int
+    Code   string
+    Detail string
+    Errors []string
+    Err    error
+}
+
+// NewAPIError returns an APIError with the given status, code and client-facing detail.
+func NewAPIError(status int, code, detail string) *APIError {
+    return &APIError{Status: status, Code: code, Detail: detail}
+}
+
+func (e *APIError) Error() string {
+    if e.Err != nil {
+        return e.Code + ": " + e.Detail + ": " + e.Err.Error()
+    }
+    return e.Code + ": " + e.Detail
+}
+
+func (e *APIError) Unwrap() error {
+    return e.Err
+}
+
+// Problem is the RFC 7807 body sent for every error response.
+type Problem struct {
+    Type      string   `json:"type"`
+    Title     string   `json:"title"`
+    Status    int      `json:"status"`
+    Detail    string   `json:"detail,omitempty"`
+    Instance  string   `json:"instance,omitempty"`
+    Code      string   `json:"code"`
+    RequestID string   `json:"request_id,omitempty"`
+    Errors    []string `json:"errors,omitempty"`
+}
+
+// kafkaAPIError maps a kafka-go error to the status and code clients should
+// see, keeping the raw broker error only as the cause.
+func kafkaAPIError(err error) *APIError {
+    apiErr := &APIError{Err: err}
+    switch producerErrorCause(err) {
+    case "timeout":
+        apiErr.Status, apiErr.Code, apiErr.Detail = http.StatusGatewayTimeout, ErrCodeBrokerTimeout, "Timed out waiting for Kafka"
+    case "message_too_large":
+        apiErr.Status, apiErr.Code, apiErr.Detail = http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Record exceeds the broker's maximum message size"
+    case "unknown_topic":
+        apiErr.Status, apiErr.Code, apiErr.Detail = http.StatusNotFound, ErrCodeStreamNotFound, "Stream topic does not exist"
+    case "broker_unavailable", "network":
+        apiErr.Status, apiErr.Code, apiErr.Detail = http.StatusServiceUnavailable, ErrCodeBrokerUnavailable, "Kafka is temporarily unavailable"
+    case "unauthorized":
+        apiErr.Status, apiErr.Code, apiErr.Detail = http.StatusBadGateway, ErrCodeBrokerUnauthorized, "Server is not authorized on the Kafka cluster"
+    default:
+        apiErr.Status, apiErr.Code, apiErr.Detail = http.StatusBadGateway, ErrCodeBrokerError, "Kafka rejected the request"
+    }
+    return apiErr
+}
+
+// firstWriteError returns the first error of a kafka.WriteErrors, which
+// Writer.WriteMessages returns for records the brokers refused and which does
+// not unwrap to them, and err itself otherwise.
+func firstWriteError(err error) error {
+    var writeErrs kafka.WriteErrors
+    if !errors.As(err, &writeErrs) {
+        return err
+    }
+    for _, writeErr := range writeErrs {
+        if writeErr != nil {
+            return writeErr
+        }
+    }
+    return err
+}
+
+// WriteError sends err as an application/problem+json response. Errors that
+// are not an *APIError are reported as internal errors without their text.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) {
+        apiErr = &APIError{Status: http.StatusInternalServerError, Code: ErrCodeInternal, Detail: "Internal server error", Err: err}
+    }
+
+    if apiErr.Status >= http.StatusInternalServerError {
+        entry := requestLogger(r).WithFields(logrus.Fields{"code": apiErr.Code, "status": apiErr.Status})
+        if apiErr.Err != nil {
+            entry = entry.WithField("error", apiErr.Err.Error())
+        }
+        entry.Error(apiErr.Detail)
+    }
+
+    problem := Problem{
+        Type:      "urn:kafnodex:problem:" + apiErr.Code,
+        Title:     http.StatusText(apiErr.Status),
+        Status:    apiErr.Status,
+        Detail:    apiErr.Detail,
+        Instance:  r.URL.Path,
+        Code:      apiErr.Code,
+        RequestID: RequestIDFromContext(r.Context()),
+        Errors:    apiErr.Errors,
+    }
+    if apiErr.Status == http.StatusTooManyRequests || apiErr.Status == http.StatusServiceUnavailable {
+        w.Header().Set("Retry-After", "1")
+    }
+    w.Header().Set("Content-Type", ProblemContentType)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(apiErr.Status)
+    json.NewEncoder(w).Encode(problem)
+}
+
+// writeError is shorthand for WriteError with a new APIError.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+    WriteError(w, r, NewAPIError(status, code, detail))
+}
+
+// writeJSON sends v as a JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+// NotFoundHandler answers unmatched routes with a problem response.
+func NotFoundHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "No route matches "+r.URL.Path)
+    })
+}
+
+// MethodNotAllowedHandler answers routes matched with the wrong method with a problem response.
+func MethodNotAllowedHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+    })
+}
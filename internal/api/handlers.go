@@ -3,8 +3,10 @@ package api
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
     "net/http"
+    "strconv"
     "sync"
     "io"
 	
@@ -13,6 +15,7 @@ import (
     "github.com/gorilla/mux"
     "github.com/gorilla/websocket"
     "github.com/segmentio/kafka-go"
+    "github.com/sirupsen/logrus"
     "time"
 
 )
@@ -20,127 +23,424 @@ import (
 
 
 var (
-    streamManager   = NewStreamManager()
-    wsConnections   = make(map[string]*websocket.Conn) // Store WebSocket connections per stream
+    streamManager   = NewStreamManager(nil)
+    wsConnections   = make(map[string]*wsSubscriber) // Store WebSocket subscribers per stream
     wsMutex         = sync.Mutex{}
     upgrader        = websocket.Upgrader{
         ReadBufferSize:  1024,
         WriteBufferSize: 1024,
         CheckOrigin: func(r *http.Request) bool { return true }, // Allow connections from any origin
+        EnableCompression: true, // Negotiate permessage-deflate with clients that offer it
+        Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+            writeError(w, r, status, ErrCodeInvalidRequest, reason.Error())
+        },
     }
 )
 
 
 
+// StartStreamRequest is the optional body of POST /stream/start: a
+// client-chosen name, an optional schema binding and the topic settings.
+type StartStreamRequest struct {
+    Name   string         `json:"name,omitempty"`
+    Schema *SchemaBinding `json:"schema,omitempty"`
+    StreamSpec
+}
+
 // Handler for starting a new data stream
 func StartStream(w http.ResponseWriter, r *http.Request) {
-	streamID := uuid.New().String()
+    // The body is optional; without one the stream gets a generated id and a
+    // topic with a single partition and replica
+    var request StartStreamRequest
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid stream spec: "+err.Error())
+        return
+    }
+    spec := request.StreamSpec.WithDefaults()
+    if err := spec.Validate(); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+
+    streamID := request.Name
+    if streamID == "" {
+        streamID = uuid.New().String()
+    } else if err := ValidateStreamID(streamID); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid stream name: "+err.Error())
+        return
+    }
+    tenant := tenantFromRequest(r)
+    topic, err := TopicName(streamID, tenant)
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+    if err := streamManager.CheckAvailable(streamID, topic, tenant); err != nil {
+        Audit(r, AuditActionStreamStart, streamID, AuditOutcomeRejected, err.Error())
+        writeError(w, r, http.StatusConflict, ErrCodeStreamExists, err.Error())
+        return
+    }
+    var schema *StreamSchema
+    if request.Schema != nil {
+        if schema, err = bindSchema(topic, tenant, *request.Schema); err != nil {
+            Audit(r, AuditActionStreamStart, streamID, AuditOutcomeRejected, err.Error())
+            WriteError(w, r, schemaAPIError(err))
+            return
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), topicAdminTimeout)
+    defer cancel()
+    if err := CreateStreamTopic(ctx, topic, spec); err != nil {
+        Audit(r, AuditActionStreamStart, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, streamSpecAPIError(err))
+        return
+    }
 
-    producer := streamManager.CreateProducer([]string{"localhost:9092"}, streamID)
-	if producer == nil {
-        http.Error(w, "Failed to initialize Kafka producer", http.StatusInternalServerError)
+    info := StreamInfo{ID: streamID, Topic: topic, Tenant: tenant, Owner: PrincipalFromRequest(r), Config: &spec, Schema: schema}
+    if _, err := streamManager.RegisterStream(info); err != nil {
+        Audit(r, AuditActionStreamStart, streamID, AuditOutcomeFailure, err.Error())
+        if errors.Is(err, ErrStreamExists) {
+            writeError(w, r, http.StatusConflict, ErrCodeStreamExists, err.Error())
+            return
+        }
+        WriteError(w, r, err)
         return
     }
 
+    // The producer is created on the first send, so a broker that fails now
+    // cannot leave a topic behind without its stream
+    Audit(r, AuditActionStreamStart, streamID, AuditOutcomeSuccess, "")
+
 	
 
-	response := map[string]string{"message": "New stream started", "stream_id": streamID}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "New stream started", "stream_id": streamID})
 }
 
 
 func SendData(w http.ResponseWriter, r *http.Request, streamID string) {
-    start := time.Now() // Start timing the request
+    logger := requestLogger(r)
 
     // Log to confirm the `streamID` value
     if streamID == "" {
-        http.Error(w, "Invalid stream ID", http.StatusBadRequest)
-        log.Println("Error: Received empty streamID in SendData")
-        httpRequestsTotal.WithLabelValues("400", "POST").Inc() // Log failed request
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid stream ID")
+        logger.Warn("Received empty streamID in SendData")
+        return
+    }
+    logger = logger.WithField("stream_id", streamID)
+    logger.Debug("Processing SendData")
+    info, ok := requireStream(w, r, streamID, AuditActionStreamSend)
+    if !ok {
         return
     }
-    log.Printf("Processing SendData for streamID: %s", streamID)
 
     
 
-    //  Creating a producer for the stream
-    producer := streamManager.CreateProducer([]string{"localhost:9092"}, streamID)
-    if producer == nil {
-        http.Error(w, "Failed to initialize Kafka producer", http.StatusInternalServerError)
-        log.Printf("Error: Failed to create Kafka producer for streamID %s", streamID)
-        httpRequestsTotal.WithLabelValues("500", "POST").Inc()
+    contentType, err := sendContentType(r)
+    if err != nil {
+        writeError(w, r, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, err.Error())
         return
     }
-	log.Println("Kafka producer initialized successfully")
 
-	// Decode JSON request body
-    var requestBody map[string]string
-    err := json.NewDecoder(r.Body).Decode(&requestBody)
+    body, err := decodedBody(r)
+    if errors.Is(err, ErrUnsupportedContentEncoding) {
+        writeError(w, r, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType, err.Error())
+        return
+    }
     if err != nil {
-        http.Error(w, "Invalid request payload", http.StatusBadRequest)
-        httpRequestsTotal.WithLabelValues("400", "POST").Inc()
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid compressed body: "+err.Error())
         return
     }
-    data, exists := requestBody["data"]
-    if !exists {
-        http.Error(w, "Missing 'data' field in request body", http.StatusBadRequest)
-        httpRequestsTotal.WithLabelValues("400", "POST").Inc()
+    defer body.Close()
+    r.Body = body
+
+	// Read the request body, refusing anything larger than the body limit
+    if quotaManager.MaxBodyBytes > 0 {
+        r.Body = http.MaxBytesReader(w, r.Body, quotaManager.MaxBodyBytes)
+    }
+    var data string
+    var value []byte
+    var bodyHeaders map[string]string
+    var maxBytesErr *http.MaxBytesError
+    if contentType != ContentTypeJSON {
+        // Binary bodies are the record itself, stored as sent
+        value, err = readBinaryRecord(r.Body, info, contentType)
+        if errors.As(err, &maxBytesErr) {
+            Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, "request body too large")
+            writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large")
+            return
+        }
+        if err != nil {
+            Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, err.Error())
+            WriteError(w, r, err)
+            return
+        }
+        data = textPayload(value, contentType)
+    } else {
+        var requestBody map[string]json.RawMessage
+        err = json.NewDecoder(r.Body).Decode(&requestBody)
+        if err != nil {
+            if errors.As(err, &maxBytesErr) {
+                Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, "request body too large")
+                writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large")
+                return
+            }
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request payload")
+            return
+        }
+        raw, exists := requestBody["data"]
+        if !exists {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Missing 'data' field in request body")
+            return
+        }
+        if rawHeaders, ok := requestBody["headers"]; ok {
+            if err := json.Unmarshal(rawHeaders, &bodyHeaders); err != nil {
+                writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Field 'headers' must map names to strings")
+                return
+            }
+        }
+
+        // Schema-bound streams take the record as any JSON value and validate and
+        // frame it; other streams take a string sent as is
+        if info.Schema != nil {
+            data = string(raw)
+            if value, err = EncodeRecord(info.Schema.ID, raw); err != nil {
+                Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, err.Error())
+                WriteError(w, r, schemaAPIError(err))
+                return
+            }
+        } else {
+            if err := json.Unmarshal(raw, &data); err != nil {
+                writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Field 'data' must be a string")
+                return
+            }
+            value = []byte(data)
+            contentType = ContentTypeText
+        }
+    }
+    headers, err := customHeaders(r, bodyHeaders)
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid record headers: "+err.Error())
+        return
+    }
+    async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+    acks, timeout, err := produceOptions(r, info, async)
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+    if quotaManager.MaxRecordBytes > 0 && int64(len(value)) > quotaManager.MaxRecordBytes {
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, "record too large")
+        writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Record too large")
+        return
+    }
+
+    // Enforce the tenant's byte quotas before anything reaches Kafka
+    tenant := tenantFromRequest(r)
+    if err := quotaManager.Reserve(tenant, int64(len(value))); err != nil {
+        logger.WithFields(logrus.Fields{"tenant": tenant, "error": err.Error()}).Warn("Rejected record by ingest quota")
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, err.Error())
+        if errors.Is(err, errRecordExceedsBurst) {
+            writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, err.Error())
+            return
+        }
+        writeError(w, r, http.StatusTooManyRequests, ErrCodeQuotaExceeded, err.Error())
+        return
+    }
+
+    //  Creating a producer for the stream and acknowledgement level; async
+    // sends go through a batching producer and return before Kafka
+    // acknowledges them
+    var producer *kafka.Writer
+    var queue *asyncProducer
+    if async {
+        queue = streamManager.CreateAsyncProducer(brokerConfig.Brokers, streamID, acks)
+    } else {
+        producer = streamManager.CreateProducer(brokerConfig.Brokers, streamID, acks)
+    }
+    if producer == nil && queue == nil {
+        quotaManager.Release(tenant, int64(len(value)))
+        writeError(w, r, http.StatusServiceUnavailable, ErrCodeBrokerUnavailable, "Failed to initialize Kafka producer")
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeFailure, "failed to initialize Kafka producer")
         return
     }
+    logger.Debug("Kafka producer initialized successfully")
 
     // Sending the raw data to Kafka
-    err = producer.WriteMessages(context.Background(),
-        kafka.Message{
-            Key:   []byte("key"),
-            Value: []byte(data),
-        },
-    )
+    metrics := currentMetrics()
+    label := metrics.streamLabel(streamID)
+    produceCtx, produceSpan := startProduceSpan(r.Context(), streamID)
+    message := kafka.Message{
+        Key:   []byte("key"),
+        Value: value,
+        Headers: append(headers, standardHeaders(r, contentType)...),
+    }
+    var deliveryID string
+    if async {
+        deliveryID = uuid.New().String()
+        message.Headers = append(message.Headers, kafka.Header{Key: DeliveryIDHeader, Value: []byte(deliveryID)})
+    }
+    injectTraceContext(produceCtx, &message)
+    if async {
+        err = queue.enqueue(produceCtx, streamID, deliveryID, tenant, message)
+    } else {
+        writeCtx := produceCtx
+        if timeout > 0 {
+            var cancelWrite context.CancelFunc
+            writeCtx, cancelWrite = context.WithTimeout(produceCtx, timeout)
+            defer cancelWrite()
+        }
+        produceStart := time.Now()
+        err = producer.WriteMessages(writeCtx, message)
+        metrics.kafkaProduceDuration.WithLabelValues(label).Observe(time.Since(produceStart).Seconds())
+    }
+    if err != nil {
+        // The record was not produced, so it does not count against the quota
+        quotaManager.Release(tenant, int64(len(value)))
+    }
+    if errors.Is(err, ErrProduceQueueFull) {
+        recordSpanError(produceSpan, err)
+        produceSpan.End()
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeRejected, err.Error())
+        writeError(w, r, http.StatusServiceUnavailable, ErrCodeProduceQueueFull, "Stream "+streamID+" has too many records queued; retry later")
+        return
+    }
     if err != nil {
-        http.Error(w, "Failed to send data to Kafka: "+err.Error(), http.StatusInternalServerError)
-        httpRequestsTotal.WithLabelValues("500", "POST").Inc()
+        recordSpanError(produceSpan, err)
+        produceSpan.End()
+        metrics.kafkaProducerErrors.WithLabelValues(label, producerErrorCause(err)).Inc()
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeFailure, err.Error())
+        apiErr := kafkaAPIError(err)
+        if apiErr.Code == ErrCodeBrokerTimeout {
+            // The write may still complete after the deadline, so the
+            // record's durability is unknown rather than failed
+            apiErr.Detail += "; durability unknown, the record may still be written and a retry may duplicate it"
+        }
+        WriteError(w, r, apiErr)
+        return
+    }
+
+    produceSpan.End()
+    if async {
+        logger.WithFields(logrus.Fields{"delivery_id": deliveryID, "data": redactPayload(data)}).Info("Queued message for Kafka")
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeSuccess, "queued as delivery "+deliveryID)
+    } else {
+        logger.WithField("data", redactPayload(data)).Info("Successfully wrote message to Kafka")
+        Audit(r, AuditActionStreamSend, streamID, AuditOutcomeSuccess, "")
+
+        // Increment Kafka messages produced counter; async records are
+        // counted and pushed to subscribers once delivered
+        metrics.kafkaMessagesProduced.Inc()
+        metrics.streamBytesIn.WithLabelValues(label).Add(float64(len(value)))
+        pushRecord(r.Context(), logger, streamID, value, data, message.Headers)
+    }
+
+    // Sending a response indicating the data was processed and sent, or
+    // accepted with the id to ask for its delivery report. Durability is the
+    // acknowledgement level the record reached before the response.
+    if async {
+        writeJSON(w, http.StatusAccepted, map[string]string{
+            "message":     fmt.Sprintf("Data queued and processed for stream %s", streamID),
+            "stream_id":   streamID,
+            "delivery_id": deliveryID,
+            "durability":  DurabilityQueued,
+        })
         return
     }
+    writeJSON(w, http.StatusOK, map[string]string{
+        "message":    fmt.Sprintf("Data sent and processed for stream %s", streamID),
+        "stream_id":  streamID,
+        "durability": acks,
+    })
+}
+
+
+
+
+
 
-	log.Println("Successfully wrote message to Kafka")
 
-    // Increment Kafka messages produced counter
-    kafkaMessagesProduced.Inc()
 
+// pushRecord processes a record Kafka accepted and pushes it to the stream's
+// websocket subscriber, if there is one and its header filter matches.
+func pushRecord(ctx context.Context, logger *logrus.Entry, streamID string, value []byte, data string, headers []kafka.Header) {
     // Processing the data in real-time
+    _, processSpan := startStreamSpan(ctx, "process", streamID)
     processedData := ProcessData(data)
+    processSpan.End()
 
     // Pushing the processed data back to the client via WebSocket if a connection exists
     wsMutex.Lock()
-    conn, exists := wsConnections[streamID]
+    subscriber, exists := wsConnections[streamID]
     wsMutex.Unlock()
 
-    if exists && conn != nil {
-        err = conn.WriteMessage(websocket.TextMessage, []byte(processedData))
-        if err != nil {
-            log.Printf("Failed to send data to WebSocket for stream %s: %v", streamID, err)
-        }
-    } else {
-        log.Printf("No WebSocket connection found for stream %s", streamID)
+    delivered := recordHeaders(headers)
+    if !exists || subscriber == nil || !subscriber.filter.matches(delivered) {
+        logger.Debug("No WebSocket connection found for stream")
+        return
     }
-
-    // Sending a response indicating the data was processed and sent
-    response := fmt.Sprintf("Data sent and processed for stream %s", streamID)
-    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-    w.WriteHeader(http.StatusOK)
-    w.Write([]byte(response))
-
-    // Record the total time taken for the request
-    duration := time.Since(start).Seconds()
-    httpRequestDuration.WithLabelValues("POST").Observe(duration)
-    httpRequestsTotal.WithLabelValues("200", "POST").Inc()
+    _, writeSpan := startStreamSpan(ctx, "websocket.write", streamID)
+    defer writeSpan.End()
+    written, err := subscriber.writeRecord(value, processedData, delivered)
+    if err != nil {
+        recordSpanError(writeSpan, err)
+        logger.WithField("error", err.Error()).Warn("Failed to send data to WebSocket")
+        return
+    }
+    metrics := currentMetrics()
+    metrics.streamBytesOut.WithLabelValues(metrics.streamLabel(streamID)).Add(float64(written))
 }
 
+// ListStreams handles GET /streams, listing the streams of the caller's tenant.
+func ListStreams(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{"streams": streamManager.tenantStreams(tenantFromRequest(r))})
+}
 
+// DescribeStream handles GET /stream/{stream_id}.
+func DescribeStream(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    info, exists := streamManager.tenantStream(streamID, tenantFromRequest(r))
+    if !exists {
+        writeError(w, r, http.StatusNotFound, ErrCodeStreamNotFound, "Stream "+streamID+" does not exist")
+        return
+    }
+    writeJSON(w, http.StatusOK, info)
+}
 
-
-
+// requireStream rejects requests for malformed or unknown stream ids, so a typo
+// never creates a new topic, and sends to read-only streams. It returns the
+// stream when the request may proceed.
+func requireStream(w http.ResponseWriter, r *http.Request, streamID, action string) (*StreamInfo, bool) {
+    if err := ValidateStreamID(streamID); err != nil {
+        Audit(r, action, streamID, AuditOutcomeRejected, err.Error())
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid stream ID: "+err.Error())
+        return nil, false
+    }
+    info, err := streamManager.lookupStream(streamID, tenantFromRequest(r), PrincipalFromRequest(r))
+    if err != nil {
+        outcome := AuditOutcomeFailure
+        var apiErr *APIError
+        if errors.As(err, &apiErr) {
+            outcome = AuditOutcomeRejected
+        }
+        Audit(r, action, streamID, outcome, err.Error())
+        WriteError(w, r, err)
+        return nil, false
+    }
+    if info == nil {
+        Audit(r, action, streamID, AuditOutcomeRejected, "unknown stream")
+        writeError(w, r, http.StatusNotFound, ErrCodeStreamNotFound, "Stream "+streamID+" does not exist; create it with POST /stream/start")
+        return nil, false
+    }
+    if info.ReadOnly && action == AuditActionStreamSend {
+        Audit(r, action, streamID, AuditOutcomeRejected, "read-only stream")
+        writeError(w, r, http.StatusForbidden, ErrCodeStreamReadOnly, "Stream "+streamID+" is attached to an existing topic and is read-only")
+        return nil, false
+    }
+    return info, true
+}
 
 
 
@@ -148,31 +448,66 @@ func SendData(w http.ResponseWriter, r *http.Request, streamID string) {
 func GetResults(w http.ResponseWriter, r *http.Request) {
     vars := mux.Vars(r)
     streamID := vars["stream_id"]
+    logger := requestLogger(r)
+    info, ok := requireStream(w, r, streamID, AuditActionStreamSubscribe)
+    if !ok {
+        return
+    }
+    projection, err := readerSchema(r, info)
+    if err != nil {
+        WriteError(w, r, err)
+        return
+    }
+    // Binary subscribers get each record's raw value, schema framing included
+    binaryFrames := r.URL.Query().Get("frames") == FramesBinary
+    if binaryFrames && projection != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "schema_version only applies to text frames")
+        return
+    }
+    // Text subscribers can ask for each record's headers in a JSON envelope
+    var withHeaders bool
+    if value := r.URL.Query().Get("headers"); value != "" {
+        if withHeaders, err = strconv.ParseBool(value); err != nil {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "headers must be true or false")
+            return
+        }
+    }
+    if binaryFrames && withHeaders {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "headers only apply to text frames")
+        return
+    }
 
     // Upgrade the HTTP connection to a WebSocket connection
     conn, err := upgrader.Upgrade(w, r, nil)
     if err != nil {
-        log.Printf("Failed to upgrade to WebSocket: %v", err)
-        http.Error(w, "Failed to open WebSocket connection", http.StatusInternalServerError)
+        logger.WithField("error", err.Error()).Warn("Failed to upgrade to WebSocket")
+        Audit(r, AuditActionStreamSubscribe, streamID, AuditOutcomeFailure, err.Error())
         return
     }
 
-    // Store the WebSocket connection for this stream ID
+    // Store the WebSocket subscriber for this stream ID
+    subscriber := &wsSubscriber{conn: conn, binary: binaryFrames, headers: withHeaders, filter: parseHeaderFilter(r)}
     wsMutex.Lock()
-    wsConnections[streamID] = conn
+    wsConnections[streamID] = subscriber
     wsMutex.Unlock()
+    metrics := currentMetrics()
+    label := metrics.streamLabel(streamID)
+    metrics.websocketSubscribers.WithLabelValues(label).Inc()
+    Audit(r, AuditActionStreamSubscribe, streamID, AuditOutcomeSuccess, "")
 
     // Ensure connection cleanup
     defer func() {
         wsMutex.Lock()
         delete(wsConnections, streamID)
         wsMutex.Unlock()
+        metrics.websocketSubscribers.WithLabelValues(label).Dec()
         conn.Close()
-        log.Printf("WebSocket connection for stream %s closed", streamID)
+        logger.Info("WebSocket connection closed")
+        Audit(r, AuditActionStreamUnsubscribe, streamID, AuditOutcomeSuccess, "")
     }()
 
     // Create or get a Kafka consumer for the stream ID topic
-    consumer := streamManager.CreateConsumer([]string{"localhost:9092"}, streamID, "group-"+streamID)
+    consumer := streamManager.CreateConsumer(brokerConfig.Brokers, streamID, "group-"+streamID)
     defer consumer.Close() // Ensure the consumer is closed when done
 
     // Context to handle cancellation
@@ -180,7 +515,7 @@ func GetResults(w http.ResponseWriter, r *http.Request) {
     defer cancel() // Ensure context cancellation
 
     // Inform the WebSocket client that consumption has started
-    conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Started consuming messages for stream %s", streamID)))
+    subscriber.writeStatus(fmt.Sprintf("Started consuming messages for stream %s", streamID))
 
     // Launch a goroutine to read messages from Kafka and send to WebSocket
     go func() {
@@ -189,27 +524,60 @@ func GetResults(w http.ResponseWriter, r *http.Request) {
             m, err := consumer.ReadMessage(ctx)
             if err != nil {
                 if err == io.EOF {
-                    log.Println("No new messages available.")
-                    conn.WriteMessage(websocket.TextMessage, []byte("No new messages available."))
+                    logger.Debug("No new messages available")
+                    subscriber.writeStatus("No new messages available.")
                     return
                 }
-                log.Printf("Error reading messages for stream %s: %v", streamID, err)
-                conn.WriteMessage(websocket.TextMessage, []byte("Error reading messages: "+err.Error()))
+                // Broker errors stay in the logs; the subscriber gets the
+                // request id to find them with
+                logger.WithField("error", err.Error()).Error("Error reading messages")
+                subscriber.writeStatus("Error reading messages (request ID " + RequestIDFromContext(r.Context()) + ")")
                 return
             }
 
+            metrics.kafkaMessagesConsumed.Inc()
+            metrics.kafkaConsumeLatency.WithLabelValues(label).Observe(time.Since(m.Time).Seconds())
+            metrics.kafkaConsumerLag.WithLabelValues(label).Set(float64(consumer.Stats().Lag))
+
+            // Records without the headers the subscriber filters on are skipped
+            headers := recordHeaders(m.Headers)
+            if !subscriber.filter.matches(headers) {
+                continue
+            }
+
+            // Each record gets its own trace, linked to the request that produced it
+            consumeCtx, consumeSpan := startConsumeSpan(ctx, streamID, m)
+
             // Process the message
-            processedMessage := ProcessData(string(m.Value))
+            _, processSpan := startStreamSpan(consumeCtx, "process", streamID)
+            record := m.Value
+            contentType := recordContentType(&m)
+            if !binaryFrames {
+                // Subscribers see schema-encoded records as JSON, in the
+                // shape of the schema version they asked for if any
+                if record, contentType, err = subscriberRecord(info, projection, &m); err != nil {
+                    logger.WithFields(logrus.Fields{"offset": m.Offset, "error": err.Error()}).Warn("Failed to decode record with its schema")
+                }
+            }
+            processedMessage := ProcessData(textPayload(record, contentType))
+            processSpan.End()
 
             // Send the processed message to WebSocket
-            err = conn.WriteMessage(websocket.TextMessage, []byte(processedMessage))
+            _, writeSpan := startStreamSpan(consumeCtx, "websocket.write", streamID)
+            written, err := subscriber.writeRecord(record, processedMessage, headers)
             if err != nil {
-                log.Printf("Failed to send message to WebSocket for stream %s: %v", streamID, err)
+                recordSpanError(writeSpan, err)
+                writeSpan.End()
+                consumeSpan.End()
+                logger.WithField("error", err.Error()).Warn("Failed to send message to WebSocket")
                 cancel() // Cancel Kafka reading on WebSocket error
                 return
             }
+            writeSpan.End()
+            consumeSpan.End()
+            metrics.streamBytesOut.WithLabelValues(label).Add(float64(written))
 
-            log.Printf("Sent message to WebSocket for stream %s: %s", streamID, processedMessage)
+            logger.WithFields(logrus.Fields{"offset": m.Offset, "data": redactPayload(processedMessage)}).Debug("Sent message to WebSocket")
         }
     }()
 
@@ -217,7 +585,7 @@ func GetResults(w http.ResponseWriter, r *http.Request) {
     for {
         _, _, err := conn.ReadMessage()
         if err != nil {
-            log.Printf("WebSocket connection for stream %s closed by client: %v", streamID, err)
+            logger.WithField("error", err.Error()).Info("WebSocket connection closed by client")
             break
         }
     }
@@ -0,0 +1,233 @@
+// internal/api/health.go
+package api
+
+import (
+    "context"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "github.com/segmentio/kafka-go"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+var draining atomic.Bool
+
+// SetDraining marks the server as shutting down so /readyz fails and load
+// balancers stop routing new requests to it.
+func SetDraining(value bool) {
+    draining.Store(value)
+}
+
+// HealthCheck is the result of a single readiness check.
+type HealthCheck struct {
+    Status     string `json:"status"`
+    Detail     string `json:"detail,omitempty"`
+    DurationMs int64  `json:"duration_ms"`
+}
+
+// ReadinessReport is the body returned by /readyz.
+type ReadinessReport struct {
+    Status string                 `json:"status"`
+    Checks map[string]HealthCheck `json:"checks"`
+}
+
+// requiredTopics lists topics that must exist for the server to be ready:
+// REQUIRED_TOPICS (comma-separated) plus the audit topic when configured.
+func requiredTopics() []string {
+    var topics []string
+    for _, topic := range strings.Split(os.Getenv("REQUIRED_TOPICS"), ",") {
+        if topic = strings.TrimSpace(topic); topic != "" {
+            topics = append(topics, topic)
+        }
+    }
+    if topic := os.Getenv("AUDIT_KAFKA_TOPIC"); topic != "" {
+        topics = append(topics, topic)
+    }
+    return topics
+}
+
+// dialBroker connects to the first reachable broker with the configured security settings.
+func dialBroker(ctx context.Context) (*kafka.Conn, error) {
+    dialer := brokerConfig.Dialer()
+    var lastErr error
+    for _, broker := range brokerConfig.Brokers {
+        conn, err := dialer.DialContext(ctx, "tcp", broker)
+        if err != nil {
+            lastErr = describeBrokerError(broker, brokerConfig, err)
+            continue
+        }
+        if deadline, ok := ctx.Deadline(); ok {
+            conn.SetDeadline(deadline)
+        }
+        return conn, nil
+    }
+    return nil, lastErr
+}
+
+// Healthz handles GET /healthz: the process is up and serving requests.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz handles GET /readyz: broker metadata is reachable, required topics
+// exist and the server is not draining.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+    defer cancel()
+
+    report := ReadinessReport{Status: "ready", Checks: make(map[string]HealthCheck)}
+    fail := func(name string, check HealthCheck) {
+        check.Status = "fail"
+        report.Checks[name] = check
+        report.Status = "not_ready"
+    }
+
+    if draining.Load() {
+        fail("draining", HealthCheck{Detail: "server is shutting down"})
+    } else {
+        report.Checks["draining"] = HealthCheck{Status: "ok"}
+    }
+
+    start := time.Now()
+    conn, err := dialBroker(ctx)
+    if err == nil {
+        defer conn.Close()
+        _, err = conn.Brokers()
+    }
+    brokerCheck := HealthCheck{DurationMs: time.Since(start).Milliseconds()}
+    if err != nil {
+        brokerCheck.Detail = err.Error()
+        fail("broker", brokerCheck)
+        fail("topics", HealthCheck{Detail: "broker unreachable"})
+    } else {
+        brokerCheck.Status = "ok"
+        report.Checks["broker"] = brokerCheck
+
+        if topics := requiredTopics(); len(topics) > 0 {
+            start = time.Now()
+            var missing []string
+            for _, topic := range topics {
+                if partitions, err := conn.ReadPartitions(topic); err != nil || len(partitions) == 0 {
+                    missing = append(missing, topic)
+                }
+            }
+            topicCheck := HealthCheck{DurationMs: time.Since(start).Milliseconds()}
+            if len(missing) > 0 {
+                topicCheck.Detail = "missing topics: " + strings.Join(missing, ", ")
+                fail("topics", topicCheck)
+            } else {
+                topicCheck.Status = "ok"
+                report.Checks["topics"] = topicCheck
+            }
+        } else {
+            report.Checks["topics"] = HealthCheck{Status: "ok", Detail: "no required topics configured"}
+        }
+    }
+
+    status := http.StatusOK
+    if report.Status != "ready" {
+        status = http.StatusServiceUnavailable
+    }
+    writeJSON(w, status, report)
+}
+
+// BrokerInfo describes a broker in the cluster metadata.
+type BrokerInfo struct {
+    ID   int    `json:"id"`
+    Host string `json:"host"`
+    Port int    `json:"port"`
+    Rack string `json:"rack,omitempty"`
+}
+
+// PartitionInfo describes a topic partition and its replica placement.
+type PartitionInfo struct {
+    ID       int   `json:"id"`
+    Leader   int   `json:"leader"`
+    Replicas []int `json:"replicas"`
+    ISR      []int `json:"isr"`
+}
+
+// TopicInfo describes a topic and its partitions.
+type TopicInfo struct {
+    Name       string          `json:"name"`
+    Partitions []PartitionInfo `json:"partitions"`
+}
+
+// BrokerDiagnostics is the body returned by /debug/broker.
+type BrokerDiagnostics struct {
+    Brokers    []BrokerInfo `json:"brokers"`
+    Controller BrokerInfo   `json:"controller"`
+    Topics     []TopicInfo  `json:"topics"`
+}
+
+func brokerIDs(brokers []kafka.Broker) []int {
+    ids := make([]int, len(brokers))
+    for i, broker := range brokers {
+        ids[i] = broker.ID
+    }
+    return ids
+}
+
+// DebugBroker handles GET /debug/broker, reporting the cluster as seen by kafka-go.
+func DebugBroker(w http.ResponseWriter, r *http.Request) {
+    ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+    defer cancel()
+
+    conn, err := dialBroker(ctx)
+    if err != nil {
+        WriteError(w, r, &APIError{Status: http.StatusServiceUnavailable, Code: ErrCodeBrokerUnavailable, Detail: "Broker unavailable", Err: err})
+        return
+    }
+    defer conn.Close()
+
+    brokers, err := conn.Brokers()
+    if err != nil {
+        WriteError(w, r, kafkaAPIError(err))
+        return
+    }
+    controller, err := conn.Controller()
+    if err != nil {
+        WriteError(w, r, kafkaAPIError(err))
+        return
+    }
+    partitions, err := conn.ReadPartitions()
+    if err != nil {
+        WriteError(w, r, kafkaAPIError(err))
+        return
+    }
+
+    diagnostics := BrokerDiagnostics{
+        Controller: BrokerInfo{ID: controller.ID, Host: controller.Host, Port: controller.Port, Rack: controller.Rack},
+    }
+    for _, broker := range brokers {
+        diagnostics.Brokers = append(diagnostics.Brokers, BrokerInfo{ID: broker.ID, Host: broker.Host, Port: broker.Port, Rack: broker.Rack})
+    }
+    sort.Slice(diagnostics.Brokers, func(i, j int) bool { return diagnostics.Brokers[i].ID < diagnostics.Brokers[j].ID })
+
+    topics := make(map[string]*TopicInfo)
+    for _, partition := range partitions {
+        topic, exists := topics[partition.Topic]
+        if !exists {
+            topic = &TopicInfo{Name: partition.Topic}
+            topics[partition.Topic] = topic
+        }
+        topic.Partitions = append(topic.Partitions, PartitionInfo{
+            ID:       partition.ID,
+            Leader:   partition.Leader.ID,
+            Replicas: brokerIDs(partition.Replicas),
+            ISR:      brokerIDs(partition.Isr),
+        })
+    }
+    for _, topic := range topics {
+        sort.Slice(topic.Partitions, func(i, j int) bool { return topic.Partitions[i].ID < topic.Partitions[j].ID })
+        diagnostics.Topics = append(diagnostics.Topics, *topic)
+    }
+    sort.Slice(diagnostics.Topics, func(i, j int) bool { return diagnostics.Topics[i].Name < diagnostics.Topics[j].Name })
+
+    writeJSON(w, http.StatusOK, diagnostics)
+}
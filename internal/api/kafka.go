@@ -4,9 +4,11 @@ import (
     "context"
     "github.com/segmentio/kafka-go"
     "github.com/sirupsen/logrus"
+    "sync"
     "time"
     "io"
 	"fmt"
+    "errors"
 )
 var log = logrus.New()
 
@@ -24,8 +26,9 @@ func KafkaWriter(brokers []string, topic string) *kafka.Writer {
         return nil
     }
 
+    dialer := brokerConfig.Dialer()
     log.Printf("Attempting to dial Kafka broker at: %s", brokers[0])     // Connect to Kafka broker
-    conn, err := kafka.Dial("tcp", brokers[0])
+    conn, err := dialController(context.Background(), dialer, brokers)
     if err != nil {
         log.WithFields(logrus.Fields{
             "broker": brokers[0],
@@ -42,7 +45,9 @@ func KafkaWriter(brokers []string, topic string) *kafka.Writer {
         NumPartitions:     1,
         ReplicationFactor: 1,
     })
-    if err != nil {
+    if errors.Is(err, kafka.TopicAlreadyExists) {
+        log.WithField("topic", topic).Debug("Kafka topic already exists")
+    } else if err != nil {
         log.WithFields(logrus.Fields{
             "topic": topic,
             "error": err.Error(),
@@ -51,11 +56,17 @@ func KafkaWriter(brokers []string, topic string) *kafka.Writer {
         log.WithField("topic", topic).Info("Successfully created Kafka topic")         // Confirm successful topic creation
     }
 
+    return newKafkaWriter(brokers, topic)
+}
+
+// newKafkaWriter creates a writer for a topic that already exists.
+func newKafkaWriter(brokers []string, topic string) *kafka.Writer {
     log.Println("Initializing Kafka writer")
     writer := kafka.NewWriter(kafka.WriterConfig{
         Brokers:  brokers,
         Topic:    topic,
         Balancer: &kafka.LeastBytes{},
+        Dialer:   brokerConfig.Dialer(),
     })
 
     if writer == nil {
@@ -69,6 +80,41 @@ func KafkaWriter(brokers []string, topic string) *kafka.Writer {
 
 
 
+// WriterFunc creates the writer the stream manager produces to a topic with,
+// creating the topic first when createTopic is set.
+type WriterFunc func(brokers []string, topic string, createTopic bool) *kafka.Writer
+
+var (
+    writerFunc   WriterFunc = streamWriter
+    writerFuncMu sync.Mutex
+)
+
+// streamWriter creates topic with KafkaWriter when asked to, and otherwise
+// only the writer.
+func streamWriter(brokers []string, topic string, createTopic bool) *kafka.Writer {
+    if createTopic {
+        return KafkaWriter(brokers, topic)
+    }
+    return newKafkaWriter(brokers, topic)
+}
+
+// UseWriterFunc replaces how producers created afterwards are made; nil
+// restores the default.
+func UseWriterFunc(f WriterFunc) {
+    writerFuncMu.Lock()
+    defer writerFuncMu.Unlock()
+    if f == nil {
+        f = streamWriter
+    }
+    writerFunc = f
+}
+
+func currentWriterFunc() WriterFunc {
+    writerFuncMu.Lock()
+    defer writerFuncMu.Unlock()
+    return writerFunc
+}
+
 // KafkaReader sets up a new Kafka consumer
 func KafkaReader(brokers []string, topic string, groupID string) *kafka.Reader {
     reader := kafka.NewReader(kafka.ReaderConfig{
@@ -78,6 +124,7 @@ func KafkaReader(brokers []string, topic string, groupID string) *kafka.Reader {
         MinBytes:    10e3,  // 10KB
         MaxBytes:    10e6,  // 10MB
         StartOffset: kafka.FirstOffset,
+        Dialer:      brokerConfig.Dialer(),
     })
 
 	log.WithFields(logrus.Fields{
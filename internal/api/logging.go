@@ -0,0 +1,114 @@
+// internal/api/logging.go
+package api
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/google/uuid"
+    "github.com/gorilla/mux"
+    "github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the correlation id on requests, responses and Kafka records.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern bounds what we accept from clients before echoing it into
+// logs, headers and Kafka records.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+// logPayloads controls whether record contents may appear in logs.
+var logPayloads = false
+
+// ConfigureLoggingFromEnv applies LOG_LEVEL (debug, info, warn, error; default
+// info), LOG_FORMAT (json, the default, or text), LOG_OUTPUT (stdout, the
+// default, stderr, or a file path) and LOG_PAYLOADS (log record contents
+// instead of redacting them; default false).
+func ConfigureLoggingFromEnv() error {
+    if value := os.Getenv("LOG_LEVEL"); value != "" {
+        level, err := logrus.ParseLevel(value)
+        if err != nil {
+            return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+        }
+        log.SetLevel(level)
+    }
+
+    switch strings.ToLower(os.Getenv("LOG_FORMAT")) {
+    case "", "json":
+        log.SetFormatter(&logrus.JSONFormatter{})
+    case "text":
+        log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+    default:
+        return fmt.Errorf("unknown LOG_FORMAT %q", os.Getenv("LOG_FORMAT"))
+    }
+
+    var output io.Writer
+    switch path := os.Getenv("LOG_OUTPUT"); path {
+    case "", "stdout":
+        output = os.Stdout
+    case "stderr":
+        output = os.Stderr
+    default:
+        file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+        if err != nil {
+            return fmt.Errorf("opening LOG_OUTPUT: %w", err)
+        }
+        output = file
+    }
+    log.SetOutput(output)
+
+    logPayloads, _ = strconv.ParseBool(os.Getenv("LOG_PAYLOADS"))
+    return nil
+}
+
+// redactPayload returns data for logging, or only its size unless LOG_PAYLOADS is set.
+func redactPayload(data string) string {
+    if logPayloads {
+        return data
+    }
+    return fmt.Sprintf("[redacted %d bytes]", len(data))
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the correlation id of the request that ctx belongs to.
+func RequestIDFromContext(ctx context.Context) string {
+    requestID, _ := ctx.Value(requestIDKey{}).(string)
+    return requestID
+}
+
+// RequestIDMiddleware assigns every request a correlation id, honoring a
+// well-formed incoming X-Request-ID, and echoes it on the response.
+func RequestIDMiddleware() func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            requestID := r.Header.Get(RequestIDHeader)
+            if !requestIDPattern.MatchString(requestID) {
+                requestID = uuid.New().String()
+            }
+            r.Header.Set(RequestIDHeader, requestID)
+            w.Header().Set(RequestIDHeader, requestID)
+
+            next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, requestID)))
+        })
+    }
+}
+
+// requestLogger returns a logger carrying the request id, stream id and
+// principal of r.
+func requestLogger(r *http.Request) *logrus.Entry {
+    fields := logrus.Fields{
+        "request_id": RequestIDFromContext(r.Context()),
+        "principal":  PrincipalFromRequest(r),
+    }
+    if streamID := mux.Vars(r)["stream_id"]; streamID != "" {
+        fields["stream_id"] = streamID
+    }
+    return log.WithFields(fields)
+}
@@ -2,65 +2,403 @@
 package api
 
 import (
+    "bufio"
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "strconv"
     "sync"
+    "time"
+
+    "github.com/gorilla/mux"
     "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
     "github.com/prometheus/client_golang/prometheus/promhttp"
-    "net/http"
+    "github.com/segmentio/kafka-go"
 )
 
-var (
+// Stream IDs beyond this many distinct values are reported as "other" so a
+// flood of new streams cannot explode series cardinality.
+const defaultMaxStreamLabels = 100
+
+// Metrics holds every collector the API records into, registered on its own
+// registry so independent instances (one per test, for example) never clash.
+type Metrics struct {
+    registry *prometheus.Registry
+
     httpRequestsTotal       *prometheus.CounterVec
     httpRequestDuration     *prometheus.HistogramVec
     kafkaMessagesProduced   prometheus.Counter
     kafkaMessagesConsumed   prometheus.Counter
+    tenantIngestBytes       *prometheus.CounterVec
+    quotaRejections         *prometheus.CounterVec
+    kafkaProduceDuration    *prometheus.HistogramVec
+    kafkaConsumeLatency     *prometheus.HistogramVec
+    streamBytesIn           *prometheus.CounterVec
+    streamBytesOut          *prometheus.CounterVec
+    activeStreams           prometheus.Gauge
+    websocketSubscribers    *prometheus.GaugeVec
+    kafkaProducerErrors     *prometheus.CounterVec
+    kafkaConsumerLag        *prometheus.GaugeVec
 
-    registerMetricsOnce sync.Once
+    streamLabels *streamLabelLimiter
+}
+
+// MetricsOptions configures NewMetrics.
+type MetricsOptions struct {
+    // RuntimeCollectors adds the Go runtime and process collectors.
+    RuntimeCollectors bool
+    // MaxStreamLabels caps distinct stream label values; zero uses
+    // METRICS_MAX_STREAM_LABELS or the default.
+    MaxStreamLabels int
+}
+
+// installedMetrics is the instance handlers record into. It is always
+// initialized so handlers can be called without any setup. Like the broker
+// config and the stores, it is installed rather than passed to handlers,
+// which are package functions; components with a constructor, such as
+// StreamManager, can be given their own instance instead.
+var (
+    installedMetrics = NewMetrics(MetricsOptions{})
+    metricsMu        sync.Mutex
 )
 
-func initMetrics() {
-    httpRequestsTotal = prometheus.NewCounterVec(
+// UseMetrics makes handlers and the stream manager record into m, returning
+// the instance they recorded into before so callers can restore it.
+func UseMetrics(m *Metrics) *Metrics {
+    metricsMu.Lock()
+    defer metricsMu.Unlock()
+    previous := installedMetrics
+    installedMetrics = m
+    return previous
+}
+
+// currentMetrics returns the instance to record into. Handlers read it once
+// per request so a request's series all land in the same instance.
+func currentMetrics() *Metrics {
+    metricsMu.Lock()
+    defer metricsMu.Unlock()
+    return installedMetrics
+}
+
+// NewMetrics creates the API collectors on a fresh registry.
+func NewMetrics(opts MetricsOptions) *Metrics {
+    if opts.MaxStreamLabels <= 0 {
+        opts.MaxStreamLabels = int(envInt64("METRICS_MAX_STREAM_LABELS", defaultMaxStreamLabels))
+    }
+    m := &Metrics{
+        registry:     prometheus.NewRegistry(),
+        streamLabels: newStreamLabelLimiter(opts.MaxStreamLabels),
+    }
+
+    m.httpRequestsTotal = prometheus.NewCounterVec(
         prometheus.CounterOpts{
             Name: "http_requests_total",
-            Help: "Total number of HTTP requests processed, labeled by status and method",
+            Help: "Total number of HTTP requests processed, labeled by route template, method and status",
         },
-        []string{"status", "method"},
+        []string{"route", "method", "status"},
     )
 
-    httpRequestDuration = prometheus.NewHistogramVec(
+    m.httpRequestDuration = prometheus.NewHistogramVec(
         prometheus.HistogramOpts{
             Name:    "http_request_duration_seconds",
-            Help:    "Histogram of latencies for HTTP requests",
+            Help:    "Histogram of latencies for HTTP requests, labeled by route template and method",
             Buckets: prometheus.DefBuckets,
         },
-        []string{"method"},
+        []string{"route", "method"},
     )
 
-    kafkaMessagesProduced = prometheus.NewCounter(
+    m.kafkaMessagesProduced = prometheus.NewCounter(
         prometheus.CounterOpts{
             Name: "kafka_messages_produced_total",
             Help: "Total number of messages produced to Kafka",
         },
     )
 
-    kafkaMessagesConsumed = prometheus.NewCounter(
+    m.kafkaMessagesConsumed = prometheus.NewCounter(
         prometheus.CounterOpts{
             Name: "kafka_messages_consumed_total",
             Help: "Total number of messages consumed from Kafka",
         },
     )
 
-    prometheus.MustRegister(httpRequestsTotal)
-    prometheus.MustRegister(httpRequestDuration)
-    prometheus.MustRegister(kafkaMessagesProduced)
-    prometheus.MustRegister(kafkaMessagesConsumed)
+    m.tenantIngestBytes = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "tenant_ingest_bytes_total",
+            Help: "Total number of record bytes accepted for ingest, labeled by tenant",
+        },
+        []string{"tenant"},
+    )
+
+    m.quotaRejections = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "tenant_quota_rejections_total",
+            Help: "Total number of records rejected by ingest quotas, labeled by tenant and quota",
+        },
+        []string{"tenant", "quota"},
+    )
+
+    m.kafkaProduceDuration = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "kafka_produce_duration_seconds",
+            Help:    "Histogram of Kafka write latencies, labeled by stream",
+            Buckets: prometheus.DefBuckets,
+        },
+        []string{"stream"},
+    )
+
+    m.kafkaConsumeLatency = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "kafka_consume_latency_seconds",
+            Help:    "Histogram of time between a record being produced and consumed, labeled by stream",
+            Buckets: prometheus.DefBuckets,
+        },
+        []string{"stream"},
+    )
+
+    m.streamBytesIn = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "stream_bytes_in_total",
+            Help: "Total number of record bytes produced, labeled by stream",
+        },
+        []string{"stream"},
+    )
+
+    m.streamBytesOut = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "stream_bytes_out_total",
+            Help: "Total number of bytes delivered to websocket subscribers, labeled by stream",
+        },
+        []string{"stream"},
+    )
+
+    m.activeStreams = prometheus.NewGauge(
+        prometheus.GaugeOpts{
+            Name: "active_streams",
+            Help: "Number of streams with an open Kafka producer",
+        },
+    )
+
+    m.websocketSubscribers = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "websocket_subscribers",
+            Help: "Number of connected websocket subscribers, labeled by stream",
+        },
+        []string{"stream"},
+    )
+
+    m.kafkaProducerErrors = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "kafka_producer_errors_total",
+            Help: "Total number of failed Kafka writes, labeled by stream and cause",
+        },
+        []string{"stream", "cause"},
+    )
+
+    m.kafkaConsumerLag = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "kafka_consumer_lag",
+            Help: "Number of records the stream's consumer is behind the partition end",
+        },
+        []string{"stream"},
+    )
+
+    m.registry.MustRegister(
+        m.httpRequestsTotal,
+        m.httpRequestDuration,
+        m.kafkaMessagesProduced,
+        m.kafkaMessagesConsumed,
+        m.tenantIngestBytes,
+        m.quotaRejections,
+        m.kafkaProduceDuration,
+        m.kafkaConsumeLatency,
+        m.streamBytesIn,
+        m.streamBytesOut,
+        m.activeStreams,
+        m.websocketSubscribers,
+        m.kafkaProducerErrors,
+        m.kafkaConsumerLag,
+    )
+    if opts.RuntimeCollectors {
+        m.registry.MustRegister(
+            collectors.NewGoCollector(),
+            collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        )
+    }
+    return m
 }
 
-// RegisterMetrics initializes and registers Prometheus metrics only once
-func RegisterMetrics() {
-    registerMetricsOnce.Do(initMetrics)
+// Registry returns the registry the collectors are registered on.
+func (m *Metrics) Registry() *prometheus.Registry {
+    return m.registry
+}
+
+// Handler exposes the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+    return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
 }
 
 // MetricsHandler exposes the /metrics endpoint
 func MetricsHandler() http.Handler {
-    return promhttp.Handler()
+    return currentMetrics().Handler()
+}
+
+// Value returns the current value of the series name whose labels include
+// every name/value pair in labels: the value of a counter or gauge, or the
+// sample count of a histogram. It is intended for asserting on metrics in tests.
+func (m *Metrics) Value(name string, labels ...string) (float64, error) {
+    if len(labels)%2 != 0 {
+        return 0, fmt.Errorf("labels must be name/value pairs")
+    }
+    families, err := m.registry.Gather()
+    if err != nil {
+        return 0, err
+    }
+    for _, family := range families {
+        if family.GetName() != name {
+            continue
+        }
+    series:
+        for _, metric := range family.GetMetric() {
+            have := make(map[string]string, len(metric.GetLabel()))
+            for _, pair := range metric.GetLabel() {
+                have[pair.GetName()] = pair.GetValue()
+            }
+            for i := 0; i < len(labels); i += 2 {
+                if have[labels[i]] != labels[i+1] {
+                    continue series
+                }
+            }
+            switch {
+            case metric.Counter != nil:
+                return metric.GetCounter().GetValue(), nil
+            case metric.Gauge != nil:
+                return metric.GetGauge().GetValue(), nil
+            case metric.Histogram != nil:
+                return float64(metric.GetHistogram().GetSampleCount()), nil
+            }
+        }
+    }
+    return 0, fmt.Errorf("no series %s matching %v", name, labels)
+}
+
+// streamLabelLimiter admits the first max distinct stream IDs as label values.
+type streamLabelLimiter struct {
+    max  int
+    mu   sync.Mutex
+    seen map[string]struct{}
+}
+
+func newStreamLabelLimiter(max int) *streamLabelLimiter {
+    return &streamLabelLimiter{max: max, seen: make(map[string]struct{})}
+}
+
+// label returns streamID if it is already tracked or there is room for it, and "other" otherwise.
+func (l *streamLabelLimiter) label(streamID string) string {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    if _, ok := l.seen[streamID]; ok {
+        return streamID
+    }
+    if len(l.seen) >= l.max {
+        return "other"
+    }
+    l.seen[streamID] = struct{}{}
+    return streamID
+}
+
+// streamLabel returns the metric label value to use for streamID.
+func (m *Metrics) streamLabel(streamID string) string {
+    return m.streamLabels.label(streamID)
+}
+
+// producerErrorCause classifies a Kafka write error for the cause label. The
+// kafka.WriteErrors of refused records is classified by its first error.
+func producerErrorCause(err error) string {
+    err = firstWriteError(err)
+    var kafkaErr kafka.Error
+    var netErr net.Error
+    switch {
+    case errors.Is(err, context.DeadlineExceeded):
+        return "timeout"
+    case errors.As(err, &kafkaErr):
+        switch kafkaErr {
+        case kafka.MessageSizeTooLarge:
+            return "message_too_large"
+        case kafka.TopicAuthorizationFailed, kafka.SASLAuthenticationFailed:
+            return "unauthorized"
+        case kafka.UnknownTopicOrPartition:
+            return "unknown_topic"
+        case kafka.LeaderNotAvailable, kafka.NotLeaderForPartition, kafka.NotEnoughReplicas, kafka.NotEnoughReplicasAfterAppend:
+            return "broker_unavailable"
+        case kafka.RequestTimedOut:
+            return "timeout"
+        }
+        return "kafka_error"
+    case errors.As(err, &netErr):
+        if netErr.Timeout() {
+            return "timeout"
+        }
+        return "network"
+    default:
+        return "unknown"
+    }
+}
+
+// statusRecorder captures the response status for instrumentation while
+// still allowing websocket upgrades through Hijack.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+    sr.status = status
+    sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+    if !ok {
+        return nil, nil, fmt.Errorf("response writer does not support hijacking")
+    }
+    // A hijacked connection is a successful websocket upgrade
+    sr.status = http.StatusSwitchingProtocols
+    return hijacker.Hijack()
+}
+
+func (sr *statusRecorder) Flush() {
+    if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+        flusher.Flush()
+    }
+}
+
+// InstrumentationMiddleware records request counts and latencies for every
+// handler, labeled by the matched route template rather than the raw path.
+func InstrumentationMiddleware() func(http.Handler) http.Handler {
+    return currentMetrics().Middleware()
+}
+
+// Middleware is InstrumentationMiddleware recording into m.
+func (m *Metrics) Middleware() func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            start := time.Now()
+            recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+            next.ServeHTTP(recorder, r)
+
+            route := "unmatched"
+            if current := mux.CurrentRoute(r); current != nil {
+                if template, err := current.GetPathTemplate(); err == nil {
+                    route = template
+                }
+            }
+            m.httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+            m.httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+        })
+    }
 }
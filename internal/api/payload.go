@@ -0,0 +1,243 @@
+// internal/api/payload.go
+package api
+
+import (
+    "compress/gzip"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "strings"
+    "sync"
+    "unicode/utf8"
+
+    "github.com/gorilla/websocket"
+    "github.com/klauspost/compress/zstd"
+    "github.com/segmentio/kafka-go"
+)
+
+// Content types accepted by POST /stream/{stream_id}/send. JSON bodies carry
+// the record in their "data" member; the others are the record itself.
+const (
+    ContentTypeJSON     = "application/json"
+    ContentTypeBinary   = "application/octet-stream"
+    ContentTypeProtobuf = "application/x-protobuf"
+    ContentTypeMsgpack  = "application/msgpack"
+    // ContentTypeText marks records sent as a JSON string in "data".
+    ContentTypeText = "text/plain; charset=utf-8"
+)
+
+// ContentTypeHeader is the Kafka record header carrying the record's content type.
+const ContentTypeHeader = "content-type"
+
+// FramesBinary is the ?frames= value subscribers use to receive records as
+// binary websocket frames holding the raw record value.
+const FramesBinary = "binary"
+
+// Content-Encoding values accepted on send bodies.
+const (
+    ContentEncodingGzip = "gzip"
+    ContentEncodingZstd = "zstd"
+)
+
+var (
+    // ErrUnsupportedContentType is returned for send bodies of an unknown media type.
+    ErrUnsupportedContentType = errors.New("unsupported content type")
+    // ErrUnsupportedContentEncoding is returned for send bodies of an unknown encoding.
+    ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+)
+
+// decodedBody returns the send body with its Content-Encoding removed. Body
+// limits apply to the decoded bytes, so small compressed bodies cannot expand
+// past them.
+func decodedBody(r *http.Request) (io.ReadCloser, error) {
+    encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+    switch encoding {
+    case "", "identity":
+        return r.Body, nil
+    case ContentEncodingGzip:
+        return gzip.NewReader(r.Body)
+    case ContentEncodingZstd:
+        decoder, _ := zstdDecoders.Get().(*zstd.Decoder)
+        if decoder == nil {
+            return nil, errors.New("zstd decoder unavailable")
+        }
+        if err := decoder.Reset(r.Body); err != nil {
+            zstdDecoders.put(decoder)
+            return nil, err
+        }
+        return &zstdBody{decoder: decoder}, nil
+    }
+    return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, encoding)
+}
+
+// zstdMinWindow is the window zstd's default compression levels use; bodies
+// compressed by common tools need it even when they are small.
+const zstdMinWindow = 8 << 20
+
+// zstdPool pools the decoders of zstd send bodies. Decoders run on the
+// request's goroutine and their window is bounded by the body limit, so a
+// hostile frame header cannot make one allocate more than that.
+type zstdPool struct {
+    sync.Pool
+}
+
+var zstdDecoders = &zstdPool{Pool: sync.Pool{New: func() interface{} {
+    maxMemory := uint64(zstdMinWindow)
+    if quotaManager.MaxBodyBytes > zstdMinWindow {
+        maxMemory = uint64(quotaManager.MaxBodyBytes)
+    }
+    decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxMemory))
+    if err != nil {
+        log.WithField("error", err.Error()).Error("Failed to create zstd decoder")
+        return nil
+    }
+    return decoder
+}}}
+
+// put releases the decoder's reader and returns it to the pool.
+func (p *zstdPool) put(decoder *zstd.Decoder) {
+    decoder.Reset(nil)
+    p.Put(decoder)
+}
+
+// zstdBody is a zstd send body; closing it returns its decoder to the pool.
+type zstdBody struct {
+    decoder *zstd.Decoder
+}
+
+func (b *zstdBody) Read(p []byte) (int, error) {
+    if b.decoder == nil {
+        return 0, io.ErrClosedPipe
+    }
+    return b.decoder.Read(p)
+}
+
+func (b *zstdBody) Close() error {
+    if b.decoder != nil {
+        zstdDecoders.put(b.decoder)
+        b.decoder = nil
+    }
+    return nil
+}
+
+// sendContentType returns the media type of a send request. Requests without
+// one, and form-encoded ones as sent by curl -d, are read as JSON.
+func sendContentType(r *http.Request) (string, error) {
+    header := r.Header.Get("Content-Type")
+    if header == "" {
+        return ContentTypeJSON, nil
+    }
+    mediaType, _, err := mime.ParseMediaType(header)
+    if err != nil {
+        return "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, header)
+    }
+    switch mediaType {
+    case ContentTypeJSON, "application/x-www-form-urlencoded":
+        return ContentTypeJSON, nil
+    case ContentTypeBinary, ContentTypeProtobuf, ContentTypeMsgpack:
+        return mediaType, nil
+    }
+    return "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+}
+
+// readBinaryRecord reads a raw send body as the record value. Schema-bound
+// streams only take raw bodies in their schema's own binary encoding, which
+// is validated and framed like JSON records.
+func readBinaryRecord(body io.Reader, info *StreamInfo, contentType string) ([]byte, error) {
+    value, err := io.ReadAll(body)
+    var maxBytesErr *http.MaxBytesError
+    if errors.As(err, &maxBytesErr) {
+        return nil, err
+    }
+    if err != nil {
+        return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "Could not read request body: "+err.Error())
+    }
+    if len(value) == 0 {
+        return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "Request body is empty")
+    }
+    if info.Schema == nil {
+        return value, nil
+    }
+    if contentType != ContentTypeProtobuf || info.Schema.Type != SchemaTypeProtobuf {
+        return nil, NewAPIError(http.StatusUnsupportedMediaType, ErrCodeUnsupportedMediaType,
+            fmt.Sprintf("Stream %s is bound to a %s schema and takes %s records", info.ID, info.Schema.Type, schemaContentTypes(info.Schema.Type)))
+    }
+    framed, err := EncodeBinaryRecord(info.Schema.ID, value)
+    if err != nil {
+        return nil, schemaAPIError(err)
+    }
+    return framed, nil
+}
+
+// schemaContentTypes names the send content types a schema type accepts.
+func schemaContentTypes(schemaType string) string {
+    if schemaType == SchemaTypeProtobuf {
+        return ContentTypeJSON + " or " + ContentTypeProtobuf
+    }
+    return ContentTypeJSON
+}
+
+// recordContentType returns the content type a record was sent with, or ""
+// for records written without one.
+func recordContentType(m *kafka.Message) string {
+    return kafkaHeaderCarrier{headers: &m.Headers}.Get(ContentTypeHeader)
+}
+
+// textPayload returns value as text for text frames and logs: records that
+// are not text are base64-encoded.
+func textPayload(value []byte, contentType string) string {
+    switch contentType {
+    case ContentTypeBinary, ContentTypeProtobuf, ContentTypeMsgpack:
+        return base64.StdEncoding.EncodeToString(value)
+    }
+    if !utf8.Valid(value) {
+        return base64.StdEncoding.EncodeToString(value)
+    }
+    return string(value)
+}
+
+// wsSubscriber is a websocket subscription, the frames it asked for and the
+// headers records must have to be delivered to it. Records reach it from the
+// subscription's consumer and from sends to the stream, so writes are
+// serialized with mu.
+type wsSubscriber struct {
+    conn    *websocket.Conn
+    binary  bool
+    headers bool
+    filter  headerFilter
+
+    mu sync.Mutex
+}
+
+// writeRecord sends a record to the subscriber in a single frame: the raw
+// value in a binary frame, its processed text form in a text frame, or a
+// Delivery text frame with the processed text and headers for subscribers
+// that asked for headers. It returns the number of bytes written.
+func (s *wsSubscriber) writeRecord(value []byte, processed string, headers map[string]string) (int, error) {
+    if s.binary {
+        return len(value), s.write(websocket.BinaryMessage, value)
+    }
+    frame := []byte(processed)
+    if s.headers {
+        var err error
+        if frame, err = json.Marshal(Delivery{Data: processed, Headers: headers}); err != nil {
+            return 0, err
+        }
+    }
+    return len(frame), s.write(websocket.TextMessage, frame)
+}
+
+// writeStatus sends a status message in a text frame.
+func (s *wsSubscriber) writeStatus(message string) error {
+    return s.write(websocket.TextMessage, []byte(message))
+}
+
+func (s *wsSubscriber) write(messageType int, data []byte) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.conn.WriteMessage(messageType, data)
+}
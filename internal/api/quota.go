@@ -0,0 +1,284 @@
+// internal/api/quota.go
+package api
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+    "golang.org/x/time/rate"
+)
+
+// Ingest size defaults, overridable through the environment
+const (
+    defaultMaxBodyBytes   = 1 << 20 // 1MB request body
+    defaultMaxRecordBytes = 1 << 20 // 1MB Kafka record value, the broker default
+    defaultTenant         = "default"
+)
+
+var (
+    errBytesPerSecondExceeded = errors.New("tenant bytes-per-second quota exceeded")
+    errDailyBytesExceeded     = errors.New("tenant daily byte quota exceeded")
+    errRecordExceedsBurst     = errors.New("record is larger than the tenant bytes-per-second quota admits at once")
+)
+
+// envInt64 reads a non-negative integer setting, falling back to def when unset or invalid.
+func envInt64(name string, def int64) int64 {
+    value, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+    if err != nil || value < 0 {
+        return def
+    }
+    return value
+}
+
+// TenantUsage is the ingest accounting for a single tenant.
+type TenantUsage struct {
+    Tenant          string `json:"tenant"`
+    Day             string `json:"day"`
+    BytesToday      int64  `json:"bytes_today"`
+    DailyByteLimit  int64  `json:"daily_byte_limit"`
+    BytesPerSecond  int64  `json:"bytes_per_second_limit"`
+    BytesTotal      int64  `json:"bytes_total"`
+    RecordsTotal    int64  `json:"records_total"`
+    RejectedRecords int64  `json:"rejected_records"`
+}
+
+type tenantQuota struct {
+    limiter *rate.Limiter
+    usage   TenantUsage
+}
+
+// QuotaManager enforces per-tenant ingest byte quotas. A limit of zero disables
+// the corresponding check.
+type QuotaManager struct {
+    MaxBodyBytes   int64
+    MaxRecordBytes int64
+    BytesPerSecond int64
+    DailyBytes     int64
+
+    mu      sync.Mutex
+    tenants map[string]*tenantQuota
+    now     func() time.Time
+}
+
+// NewQuotaManager creates a QuotaManager with explicit limits.
+func NewQuotaManager(maxBodyBytes, maxRecordBytes, bytesPerSecond, dailyBytes int64) *QuotaManager {
+    return &QuotaManager{
+        MaxBodyBytes:   maxBodyBytes,
+        MaxRecordBytes: maxRecordBytes,
+        BytesPerSecond: bytesPerSecond,
+        DailyBytes:     dailyBytes,
+        tenants:        make(map[string]*tenantQuota),
+        now:            time.Now,
+    }
+}
+
+// NewQuotaManagerFromEnv reads MAX_BODY_BYTES, MAX_RECORD_BYTES,
+// TENANT_BYTES_PER_SECOND and TENANT_DAILY_BYTES.
+func NewQuotaManagerFromEnv() *QuotaManager {
+    return NewQuotaManager(
+        envInt64("MAX_BODY_BYTES", defaultMaxBodyBytes),
+        envInt64("MAX_RECORD_BYTES", defaultMaxRecordBytes),
+        envInt64("TENANT_BYTES_PER_SECOND", 0),
+        envInt64("TENANT_DAILY_BYTES", 0),
+    )
+}
+
+// tenant returns the quota state for name, rolling the daily counter over at
+// midnight UTC. Tenants come from the configured principal mapping, so the
+// states and their metric labels are bounded by it. Callers must hold qm.mu.
+func (qm *QuotaManager) tenant(name string) *tenantQuota {
+    tq, exists := qm.tenants[name]
+    if !exists {
+        tq = &tenantQuota{usage: TenantUsage{Tenant: name}}
+        if qm.BytesPerSecond > 0 {
+            // The bucket must hold at least one maximum-size record or such a
+            // record could never be admitted. Without a record limit, records
+            // are bounded by the body limit.
+            burst := qm.BytesPerSecond
+            maxRecord := qm.MaxRecordBytes
+            if maxRecord == 0 {
+                maxRecord = qm.MaxBodyBytes
+            }
+            if maxRecord > burst {
+                burst = maxRecord
+            }
+            tq.limiter = rate.NewLimiter(rate.Limit(qm.BytesPerSecond), int(burst))
+        }
+        qm.tenants[name] = tq
+    }
+
+    today := qm.now().UTC().Format("2006-01-02")
+    if tq.usage.Day != today {
+        tq.usage.Day = today
+        tq.usage.BytesToday = 0
+    }
+    return tq
+}
+
+// Reserve admits n bytes for tenant or returns the quota that would be exceeded.
+// Records no bytes-per-second bucket can hold are refused with
+// errRecordExceedsBurst, since waiting would never admit them. Admitted bytes are counted towards the tenant's usage immediately; Release
+// gives them back when the record is not produced after all.
+func (qm *QuotaManager) Reserve(tenant string, n int64) error {
+    metrics := currentMetrics()
+    qm.mu.Lock()
+    defer qm.mu.Unlock()
+
+    tq := qm.tenant(tenant)
+    if qm.DailyBytes > 0 && tq.usage.BytesToday+n > qm.DailyBytes {
+        tq.usage.RejectedRecords++
+        metrics.quotaRejections.WithLabelValues(tenant, "daily_bytes").Inc()
+        return errDailyBytesExceeded
+    }
+    if tq.limiter != nil && n > int64(tq.limiter.Burst()) {
+        tq.usage.RejectedRecords++
+        metrics.quotaRejections.WithLabelValues(tenant, "bytes_per_second").Inc()
+        return errRecordExceedsBurst
+    }
+    if tq.limiter != nil && !tq.limiter.AllowN(qm.now(), int(n)) {
+        tq.usage.RejectedRecords++
+        metrics.quotaRejections.WithLabelValues(tenant, "bytes_per_second").Inc()
+        return errBytesPerSecondExceeded
+    }
+
+    tq.usage.BytesToday += n
+    tq.usage.BytesTotal += n
+    tq.usage.RecordsTotal++
+    metrics.tenantIngestBytes.WithLabelValues(tenant).Add(float64(n))
+    return nil
+}
+
+// Release gives back n bytes reserved for a record that was not produced.
+// The bytes-per-second budget the record used is not refunded.
+func (qm *QuotaManager) Release(tenant string, n int64) {
+    qm.mu.Lock()
+    defer qm.mu.Unlock()
+
+    tq := qm.tenant(tenant)
+    tq.usage.BytesToday -= n
+    if tq.usage.BytesToday < 0 {
+        tq.usage.BytesToday = 0
+    }
+    tq.usage.BytesTotal -= n
+    tq.usage.RecordsTotal--
+}
+
+// Usage returns a snapshot of the tenant's accounting, which is empty for
+// tenants that have not sent anything.
+func (qm *QuotaManager) Usage(tenant string) TenantUsage {
+    qm.mu.Lock()
+    defer qm.mu.Unlock()
+
+    usage := TenantUsage{Tenant: tenant}
+    if _, exists := qm.tenants[tenant]; exists {
+        usage = qm.tenant(tenant).usage
+    }
+    usage.DailyByteLimit = qm.DailyBytes
+    usage.BytesPerSecond = qm.BytesPerSecond
+    return usage
+}
+
+// TenantMapper maps authenticated principals to the tenants they are billed
+// to and whose streams they use. Unmapped principals belong to the default
+// tenant.
+type TenantMapper struct {
+    tenants map[string]string
+}
+
+// NewTenantMapper parses "principal=tenant" pairs separated by commas, where
+// principal is as authenticated, e.g. "apikey:1a2b3c4d" or a client
+// certificate's mapped principal.
+func NewTenantMapper(spec string) (*TenantMapper, error) {
+    mapper := &TenantMapper{tenants: make(map[string]string)}
+    for _, pair := range strings.Split(spec, ",") {
+        pair = strings.TrimSpace(pair)
+        if pair == "" {
+            continue
+        }
+        principal, tenant, ok := strings.Cut(pair, "=")
+        if !ok || principal == "" || tenant == "" {
+            return nil, fmt.Errorf("invalid tenant mapping %q", pair)
+        }
+        if err := ValidateStreamID(tenant); err != nil {
+            return nil, fmt.Errorf("invalid tenant %q: %w", tenant, err)
+        }
+        mapper.tenants[principal] = tenant
+    }
+    return mapper, nil
+}
+
+// Tenant returns the principal's tenant.
+func (m *TenantMapper) Tenant(principal string) string {
+    if tenant, ok := m.tenants[principal]; ok {
+        return tenant
+    }
+    return defaultTenant
+}
+
+// tenantNames returns the tenants principals are mapped to.
+func (m *TenantMapper) tenantNames() []string {
+    names := make([]string, 0, len(m.tenants))
+    for _, tenant := range m.tenants {
+        names = append(names, tenant)
+    }
+    return names
+}
+
+var (
+    tenantMapper   = &TenantMapper{}
+    tenantMapperMu sync.Mutex
+)
+
+// UseTenantMapper replaces how requests are mapped to tenants.
+func UseTenantMapper(m *TenantMapper) {
+    tenantMapperMu.Lock()
+    defer tenantMapperMu.Unlock()
+    tenantMapper = m
+}
+
+func currentTenantMapper() *TenantMapper {
+    tenantMapperMu.Lock()
+    defer tenantMapperMu.Unlock()
+    return tenantMapper
+}
+
+// tenantFromRequest identifies the tenant a request is billed to from its
+// authenticated principal; clients cannot choose it.
+func tenantFromRequest(r *http.Request) string {
+    return currentTenantMapper().Tenant(PrincipalFromRequest(r))
+}
+
+var quotaManager = NewQuotaManagerFromEnv()
+
+// UseQuotaManager replaces the quotas ingest is checked against.
+func UseQuotaManager(qm *QuotaManager) {
+    quotaManager = qm
+}
+
+// isQuotaError reports whether Reserve refused bytes for a tenant's quota.
+func isQuotaError(err error) bool {
+    return errors.Is(err, errBytesPerSecondExceeded) || errors.Is(err, errDailyBytesExceeded)
+}
+
+// GetTenantUsage handles GET /tenants/{tenant}/usage for the caller's own
+// tenant.
+func GetTenantUsage(w http.ResponseWriter, r *http.Request) {
+    tenant := mux.Vars(r)["tenant"]
+    if tenant == "" {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Tenant is required")
+        return
+    }
+    if tenant != tenantFromRequest(r) {
+        writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "Usage of tenant "+tenant+" is not visible to this principal")
+        return
+    }
+
+    writeJSON(w, http.StatusOK, quotaManager.Usage(tenant))
+}
@@ -2,7 +2,17 @@
 package api
 
 import (
+    "context"
+    "fmt"
     "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/redis/go-redis/v9"
     "golang.org/x/time/rate"
 )
 
@@ -10,25 +20,162 @@ import (
 const (
     globalRequestsPerSecond = 5  // Set a global rate limit
     globalBurstLimit        = 10  // Allow up to 2 requests in a burst
+    globalRateLimitKey      = "global"
 )
 
+// RateLimitStore decides whether one more request may be admitted for a key.
+// Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+    Allow(ctx context.Context, key string) (bool, error)
+}
+
+// memoryRateLimitStore keeps one token bucket per key inside this process.
+type memoryRateLimitStore struct {
+    limit    rate.Limit
+    burst    int
+    mu       sync.Mutex
+    limiters map[string]*rate.Limiter
+}
+
+// NewMemoryRateLimitStore returns the in-process token bucket store.
+func NewMemoryRateLimitStore(requestsPerSecond float64, burst int) RateLimitStore {
+    return &memoryRateLimitStore{
+        limit:    rate.Limit(requestsPerSecond),
+        burst:    burst,
+        limiters: make(map[string]*rate.Limiter),
+    }
+}
+
+func (s *memoryRateLimitStore) Allow(ctx context.Context, key string) (bool, error) {
+    s.mu.Lock()
+    limiter, exists := s.limiters[key]
+    if !exists {
+        limiter = rate.NewLimiter(s.limit, s.burst)
+        s.limiters[key] = limiter
+    }
+    s.mu.Unlock()
+
+    return limiter.Allow(), nil
+}
+
+// gcraScript implements the generic cell rate algorithm atomically on the
+// server. The theoretical arrival time (TAT) is stored per key in
+// milliseconds and expires once the bucket would be full again.
+var gcraScript = redis.NewScript(`
+local emission = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if tat == nil or tat < now then
+    tat = now
+end
+local newTat = tat + emission
+if newTat - tolerance > now then
+    return 0
+end
+redis.call('SET', KEYS[1], newTat, 'PX', math.ceil(newTat - now))
+return 1
+`)
+
+// redisRateLimitStore shares a GCRA budget between all replicas talking to
+// the same Redis-protocol server.
+type redisRateLimitStore struct {
+    client    redis.UniversalClient
+    prefix    string
+    emission  int64 // milliseconds between requests at the steady rate
+    tolerance int64 // milliseconds of burst allowed ahead of the steady rate
+}
+
+// NewRedisRateLimitStore returns a store that enforces requestsPerSecond with
+// the given burst across every process sharing client.
+func NewRedisRateLimitStore(client redis.UniversalClient, requestsPerSecond float64, burst int) RateLimitStore {
+    emission := int64(float64(time.Second/time.Millisecond) / requestsPerSecond)
+    if emission < 1 {
+        emission = 1
+    }
+    return &redisRateLimitStore{
+        client:    client,
+        prefix:    "ratelimit:",
+        emission:  emission,
+        tolerance: emission * int64(burst),
+    }
+}
+
+func (s *redisRateLimitStore) Allow(ctx context.Context, key string) (bool, error) {
+    allowed, err := gcraScript.Run(ctx, s.client, []string{s.prefix + key}, s.emission, s.tolerance).Int()
+    if err != nil {
+        return false, err
+    }
+    return allowed == 1, nil
+}
+
+// NewRateLimitStoreFromEnv builds the store selected by RATE_LIMIT_STORE
+// ("memory", the default, or "redis" with RATE_LIMIT_REDIS_ADDR).
+func NewRateLimitStoreFromEnv() (RateLimitStore, error) {
+    switch strings.ToLower(os.Getenv("RATE_LIMIT_STORE")) {
+    case "", "memory":
+        return NewMemoryRateLimitStore(globalRequestsPerSecond, globalBurstLimit), nil
+    case "redis":
+        addr := os.Getenv("RATE_LIMIT_REDIS_ADDR")
+        if addr == "" {
+            return nil, fmt.Errorf("RATE_LIMIT_REDIS_ADDR is required when RATE_LIMIT_STORE=redis")
+        }
+        client := redis.NewClient(&redis.Options{
+            Addr:        addr,
+            Password:    os.Getenv("RATE_LIMIT_REDIS_PASSWORD"),
+            DialTimeout: 500 * time.Millisecond,
+            ReadTimeout: 500 * time.Millisecond,
+        })
+        return NewRedisRateLimitStore(client, globalRequestsPerSecond, globalBurstLimit), nil
+    default:
+        return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", os.Getenv("RATE_LIMIT_STORE"))
+    }
+}
+
+// RateLimitFailOpen reports whether requests are admitted when the store is
+// unreachable. RATE_LIMIT_FAIL_OPEN defaults to true.
+func RateLimitFailOpen() bool {
+    failOpen, err := strconv.ParseBool(os.Getenv("RATE_LIMIT_FAIL_OPEN"))
+    if err != nil {
+        return true
+    }
+    return failOpen
+}
+
 // Global rate limiter instance
-var globalLimiter = rate.NewLimiter(rate.Limit(globalRequestsPerSecond), globalBurstLimit)
+var globalLimiter = NewMemoryRateLimitStore(globalRequestsPerSecond, globalBurstLimit)
 
 // RateLimiterMiddleware applies a global rate limit for all requests
 func RateLimiterMiddleware() func(http.Handler) http.Handler {
+    return RateLimiterMiddlewareWithStore(globalLimiter, RateLimitFailOpen())
+}
+
+// RateLimiterMiddlewareWithStore applies a global rate limit backed by store.
+// When the store returns an error the request is admitted if failOpen is set
+// and rejected with 503 otherwise.
+func RateLimiterMiddlewareWithStore(store RateLimitStore, failOpen bool) func(http.Handler) http.Handler {
     return func(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-            log.Println("RateLimiterMiddleware invoked")  // Log every request
 
             // Check if the request should be allowed by the global limiter
-            if !globalLimiter.Allow() {
-                log.Println("Rate limit exceeded")  // Log when the rate limit is triggered
-                http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+            allowed, err := store.Allow(r.Context(), globalRateLimitKey)
+            if err != nil {
+                requestLogger(r).WithField("error", err.Error()).Error("Rate limit store unavailable")
+                if !failOpen {
+                    Audit(r, AuditActionRateLimit, mux.Vars(r)["stream_id"], AuditOutcomeRejected, "rate limit store unavailable")
+                    writeError(w, r, http.StatusServiceUnavailable, ErrCodeRateLimiterUnavailable, "Rate limiter unavailable")
+                    return
+                }
+                allowed = true
+            }
+            if !allowed {
+                requestLogger(r).Debug("Rate limit exceeded")  // Rejections are counted in metrics and audited
+                Audit(r, AuditActionRateLimit, mux.Vars(r)["stream_id"], AuditOutcomeRejected, "rate limit exceeded")
+                writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, "Too many requests, slow down")
                 return
             }
 
-            log.Println("Request allowed")  // Log allowed requests
             next.ServeHTTP(w, r)
         })
     }
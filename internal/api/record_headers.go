@@ -0,0 +1,142 @@
+// internal/api/record_headers.go
+package api
+
+import (
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/segmentio/kafka-go"
+)
+
+// Standard Kafka record headers added by the server to every record sent,
+// alongside RequestIDHeader and ContentTypeHeader.
+const (
+    ProducerPrincipalHeader = "producer-principal"
+    ProducedAtHeader        = "produced-at"
+)
+
+// CustomHeaderPrefix marks HTTP request headers copied onto the record; the
+// rest of the name, lowercased, is the record header key.
+const CustomHeaderPrefix = "X-Header-"
+
+// HeaderFilterPrefix marks ?header.<key>=<value> subscription filters.
+const HeaderFilterPrefix = "header."
+
+// maxCustomHeaders caps the headers a client may add to one record.
+const maxCustomHeaders = 32
+
+// headerKeyPattern limits custom header keys to token characters.
+var headerKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// reservedHeaders are set by the server or the tracing propagator and cannot
+// be supplied by clients.
+var reservedHeaders = map[string]bool{
+    strings.ToLower(RequestIDHeader): true,
+    ContentTypeHeader:                true,
+    ProducerPrincipalHeader:          true,
+    ProducedAtHeader:                 true,
+    DeliveryIDHeader:                 true,
+    RoutedByHeader:                   true,
+    RouteHopsHeader:                  true,
+    RouteErrorHeader:                 true,
+    RouteTargetHeader:                true,
+    "traceparent":                    true,
+    "tracestate":                     true,
+    "baggage":                        true,
+}
+
+// customHeaders returns the record headers a client supplied, from the JSON
+// body's "headers" member and from X-Header-* request headers.
+func customHeaders(r *http.Request, fromBody map[string]string) ([]kafka.Header, error) {
+    supplied := make(map[string]string, len(fromBody))
+    for key, value := range fromBody {
+        supplied[key] = value
+    }
+    for name, values := range r.Header {
+        if len(name) > len(CustomHeaderPrefix) && strings.EqualFold(name[:len(CustomHeaderPrefix)], CustomHeaderPrefix) {
+            supplied[strings.ToLower(name[len(CustomHeaderPrefix):])] = values[len(values)-1]
+        }
+    }
+    if len(supplied) > maxCustomHeaders {
+        return nil, fmt.Errorf("at most %d custom headers are allowed", maxCustomHeaders)
+    }
+
+    headers := make([]kafka.Header, 0, len(supplied))
+    for _, key := range sortedKeys(supplied) {
+        if !headerKeyPattern.MatchString(key) {
+            return nil, fmt.Errorf("invalid header name %q", key)
+        }
+        if reservedHeaders[strings.ToLower(key)] {
+            return nil, fmt.Errorf("header %q is set by the server", key)
+        }
+        headers = append(headers, kafka.Header{Key: key, Value: []byte(supplied[key])})
+    }
+    return headers, nil
+}
+
+// standardHeaders returns the headers the server adds to every record sent.
+func standardHeaders(r *http.Request, contentType string) []kafka.Header {
+    return []kafka.Header{
+        {Key: RequestIDHeader, Value: []byte(RequestIDFromContext(r.Context()))},
+        {Key: ContentTypeHeader, Value: []byte(contentType)},
+        {Key: ProducerPrincipalHeader, Value: []byte(PrincipalFromRequest(r))},
+        {Key: ProducedAtHeader, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+    }
+}
+
+// recordHeaders returns a record's headers as delivered to subscribers. Values
+// that are not UTF-8 are base64-encoded; for repeated keys the last one wins.
+func recordHeaders(headers []kafka.Header) map[string]string {
+    if len(headers) == 0 {
+        return nil
+    }
+    values := make(map[string]string, len(headers))
+    for _, header := range headers {
+        if utf8.Valid(header.Value) {
+            values[header.Key] = string(header.Value)
+        } else {
+            values[header.Key] = base64.StdEncoding.EncodeToString(header.Value)
+        }
+    }
+    return values
+}
+
+// headerFilter holds the header values a subscriber asked records to have.
+type headerFilter map[string]string
+
+// parseHeaderFilter reads ?header.<key>=<value> parameters from a subscription.
+func parseHeaderFilter(r *http.Request) headerFilter {
+    var filter headerFilter
+    for param, values := range r.URL.Query() {
+        if !strings.HasPrefix(param, HeaderFilterPrefix) || len(param) == len(HeaderFilterPrefix) {
+            continue
+        }
+        if filter == nil {
+            filter = make(headerFilter)
+        }
+        filter[param[len(HeaderFilterPrefix):]] = values[len(values)-1]
+    }
+    return filter
+}
+
+// matches reports whether a record with the given headers passes every
+// condition of the filter.
+func (f headerFilter) matches(headers map[string]string) bool {
+    for key, want := range f {
+        if got, ok := headers[key]; !ok || got != want {
+            return false
+        }
+    }
+    return true
+}
+
+// Delivery is the JSON text frame a subscriber receives for each record.
+type Delivery struct {
+    Data    string            `json:"data,omitempty"`
+    Headers map[string]string `json:"headers,omitempty"`
+}
@@ -0,0 +1,515 @@
+// internal/api/schema_codec.go
+package api
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+
+    "github.com/bufbuild/protocompile"
+    "github.com/linkedin/goavro/v2"
+    "github.com/santhosh-tekuri/jsonschema/v5"
+    "google.golang.org/protobuf/encoding/protojson"
+    "google.golang.org/protobuf/proto"
+    "google.golang.org/protobuf/reflect/protoreflect"
+    "google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+    // ErrInvalidSchema is returned for schema definitions that do not compile.
+    ErrInvalidSchema = errors.New("invalid schema")
+    // ErrSchemaMismatch is returned for records that do not match their stream's schema.
+    ErrSchemaMismatch = errors.New("record does not match schema")
+)
+
+// wireMagicByte starts every record in the Confluent wire format, followed by
+// the big-endian schema id and the encoded payload.
+const wireMagicByte = 0
+
+// schemaCodec converts between JSON records and a schema's encoding.
+type schemaCodec interface {
+    // Encode validates a JSON record and returns its encoded payload.
+    Encode(record []byte) ([]byte, error)
+    // Decode returns the JSON form of an encoded payload.
+    Decode(payload []byte) ([]byte, error)
+}
+
+// newSchemaCodec compiles a schema definition.
+func newSchemaCodec(schema Schema) (schemaCodec, error) {
+    switch schema.schemaType() {
+    case SchemaTypeAvro:
+        codec, err := goavro.NewCodec(schema.Definition)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+        }
+        parsed, err := parseAvroSchema(schema.Definition)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+        }
+        return avroCodec{codec: codec, schema: parsed}, nil
+    case SchemaTypeJSON:
+        compiled, err := compileJSONSchema(schema.Definition)
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+        }
+        var raw interface{}
+        json.Unmarshal([]byte(schema.Definition), &raw)
+        return jsonCodec{schema: compiled, raw: raw}, nil
+    case SchemaTypeProtobuf:
+        compiler := protocompile.Compiler{
+            Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+                Accessor: protocompile.SourceAccessorFromMap(map[string]string{"schema.proto": schema.Definition}),
+            }),
+        }
+        files, err := compiler.Compile(context.Background(), "schema.proto")
+        if err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+        }
+        if files[0].Messages().Len() == 0 {
+            return nil, fmt.Errorf("%w: protobuf schema defines no messages", ErrInvalidSchema)
+        }
+        return protobufCodec{file: files[0]}, nil
+    default:
+        return nil, fmt.Errorf("%w: unknown schema type %q", ErrInvalidSchema, schema.Type)
+    }
+}
+
+// errExternalSchemaRef is returned for JSON schemas referring to documents
+// other than themselves and the standard meta-schemas.
+var errExternalSchemaRef = errors.New("schemas cannot refer to external documents")
+
+// compileJSONSchema compiles a JSON schema without loading anything it refers
+// to, so definitions cannot make the server read files or fetch URLs.
+func compileJSONSchema(definition string) (*jsonschema.Schema, error) {
+    compiler := jsonschema.NewCompiler()
+    compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+        return nil, fmt.Errorf("%w: %s", errExternalSchemaRef, url)
+    }
+    if err := compiler.AddResource("schema.json", strings.NewReader(definition)); err != nil {
+        return nil, err
+    }
+    return compiler.Compile("schema.json")
+}
+
+type avroCodec struct {
+    codec  *goavro.Codec
+    schema *avroType
+}
+
+func (c avroCodec) Encode(record []byte) ([]byte, error) {
+    native, _, err := c.codec.NativeFromTextual(record)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    payload, err := c.codec.BinaryFromNative(nil, native)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    return payload, nil
+}
+
+func (c avroCodec) Decode(payload []byte) ([]byte, error) {
+    native, _, err := c.codec.NativeFromBinary(payload)
+    if err != nil {
+        return nil, err
+    }
+    return c.codec.TextualFromNative(nil, native)
+}
+
+type jsonCodec struct {
+    schema *jsonschema.Schema
+    raw    interface{}
+}
+
+func (c jsonCodec) Encode(record []byte) ([]byte, error) {
+    decoder := json.NewDecoder(bytes.NewReader(record))
+    decoder.UseNumber()
+    var value interface{}
+    if err := decoder.Decode(&value); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    if err := c.schema.Validate(value); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    var compact bytes.Buffer
+    if err := json.Compact(&compact, record); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    return compact.Bytes(), nil
+}
+
+func (c jsonCodec) Decode(payload []byte) ([]byte, error) {
+    if !json.Valid(payload) {
+        return nil, errors.New("payload is not valid JSON")
+    }
+    return payload, nil
+}
+
+// protobufCodec encodes records as the first message of the schema; decoding
+// follows the message indexes in the wire format.
+type protobufCodec struct {
+    file protoreflect.FileDescriptor
+}
+
+func (c protobufCodec) Encode(record []byte) ([]byte, error) {
+    message := dynamicpb.NewMessage(c.file.Messages().Get(0))
+    if err := protojson.Unmarshal(record, message); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    payload, err := proto.Marshal(message)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    // A single zero stands for the message index path [0]
+    return append([]byte{0}, payload...), nil
+}
+
+// EncodeBinary takes a serialized message of the schema's first message type.
+func (c protobufCodec) EncodeBinary(record []byte) ([]byte, error) {
+    message := dynamicpb.NewMessage(c.file.Messages().Get(0))
+    if err := proto.Unmarshal(record, message); err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrSchemaMismatch, err)
+    }
+    return append([]byte{0}, record...), nil
+}
+
+func (c protobufCodec) Decode(payload []byte) ([]byte, error) {
+    count, n := binary.Varint(payload)
+    if n <= 0 || count < 0 {
+        return nil, errors.New("malformed protobuf message indexes")
+    }
+    payload = payload[n:]
+    descriptor := c.file.Messages().Get(0)
+    for i := int64(0); i < count; i++ {
+        index, n := binary.Varint(payload)
+        if n <= 0 {
+            return nil, errors.New("malformed protobuf message indexes")
+        }
+        payload = payload[n:]
+        var messages protoreflect.MessageDescriptors = c.file.Messages()
+        if i > 0 {
+            messages = descriptor.Messages()
+        }
+        if index < 0 || int(index) >= messages.Len() {
+            return nil, fmt.Errorf("protobuf message index %d out of range", index)
+        }
+        descriptor = messages.Get(int(index))
+    }
+    message := dynamicpb.NewMessage(descriptor)
+    if err := proto.Unmarshal(payload, message); err != nil {
+        return nil, err
+    }
+    return protojson.Marshal(message)
+}
+
+// schemaCodecs caches compiled codecs by schema id, which never change.
+var schemaCodecs sync.Map
+
+// codecForID returns the codec for a registered schema id.
+func codecForID(id int) (schemaCodec, error) {
+    if codec, ok := schemaCodecs.Load(id); ok {
+        return codec.(schemaCodec), nil
+    }
+    schema, err := currentSchemaStore().ByID(id)
+    if err != nil {
+        return nil, err
+    }
+    codec, err := newSchemaCodec(schema)
+    if err != nil {
+        return nil, err
+    }
+    schemaCodecs.Store(id, codec)
+    return codec, nil
+}
+
+// EncodeRecord validates a JSON record against the schema and frames it in
+// the Confluent wire format.
+func EncodeRecord(schemaID int, record []byte) ([]byte, error) {
+    codec, err := codecForID(schemaID)
+    if err != nil {
+        return nil, err
+    }
+    payload, err := codec.Encode(record)
+    if err != nil {
+        return nil, err
+    }
+    return frameRecord(schemaID, payload), nil
+}
+
+// binaryEncoder is implemented by codecs that accept records already in the
+// schema's binary encoding.
+type binaryEncoder interface {
+    // EncodeBinary validates an encoded record and returns its payload.
+    EncodeBinary(record []byte) ([]byte, error)
+}
+
+// EncodeBinaryRecord validates a record in the schema's binary encoding and
+// frames it in the Confluent wire format.
+func EncodeBinaryRecord(schemaID int, record []byte) ([]byte, error) {
+    codec, err := codecForID(schemaID)
+    if err != nil {
+        return nil, err
+    }
+    encoder, ok := codec.(binaryEncoder)
+    if !ok {
+        return nil, fmt.Errorf("%w: schema %d does not take binary records", ErrSchemaMismatch, schemaID)
+    }
+    payload, err := encoder.EncodeBinary(record)
+    if err != nil {
+        return nil, err
+    }
+    return frameRecord(schemaID, payload), nil
+}
+
+// frameRecord prefixes an encoded payload with the magic byte and schema id.
+func frameRecord(schemaID int, payload []byte) []byte {
+    framed := make([]byte, 5, 5+len(payload))
+    framed[0] = wireMagicByte
+    binary.BigEndian.PutUint32(framed[1:5], uint32(schemaID))
+    return append(framed, payload...)
+}
+
+// DecodeRecord returns the JSON form of a record in the Confluent wire format,
+// using whichever schema id the record was framed with.
+func DecodeRecord(value []byte) ([]byte, error) {
+    if !isFramedRecord(value) {
+        return nil, errors.New("record is not in the schema registry wire format")
+    }
+    codec, err := codecForID(int(binary.BigEndian.Uint32(value[1:5])))
+    if err != nil {
+        return nil, err
+    }
+    return codec.Decode(value[5:])
+}
+
+// ProjectRecord decodes a record in the Confluent wire format as a consumer
+// using the reader schema would see it: fields the reader does not know are
+// dropped and fields the writer did not set take the reader's defaults.
+func ProjectRecord(value []byte, reader Schema) ([]byte, error) {
+    if !isFramedRecord(value) {
+        return nil, errors.New("record is not in the schema registry wire format")
+    }
+    writerID := int(binary.BigEndian.Uint32(value[1:5]))
+    if writerID == reader.ID {
+        return DecodeRecord(value)
+    }
+    writerCodec, err := codecForID(writerID)
+    if err != nil {
+        return nil, err
+    }
+    readerCodec, err := codecForID(reader.ID)
+    if err != nil {
+        return nil, err
+    }
+
+    switch readerCodec := readerCodec.(type) {
+    case avroCodec:
+        writerCodec, ok := writerCodec.(avroCodec)
+        if !ok {
+            return nil, errors.New("record was not written with an Avro schema")
+        }
+        native, _, err := writerCodec.codec.NativeFromBinary(value[5:])
+        if err != nil {
+            return nil, err
+        }
+        projected, err := projectAvro(native, readerCodec.schema, writerCodec.schema)
+        if err != nil {
+            return nil, err
+        }
+        // Encoding with the reader fills in its defaults for missing fields
+        payload, err := readerCodec.codec.BinaryFromNative(nil, projected)
+        if err != nil {
+            return nil, err
+        }
+        return readerCodec.Decode(payload)
+    case jsonCodec:
+        record, err := writerCodec.Decode(value[5:])
+        if err != nil {
+            return nil, err
+        }
+        decoder := json.NewDecoder(bytes.NewReader(record))
+        decoder.UseNumber()
+        var document interface{}
+        if err := decoder.Decode(&document); err != nil {
+            return nil, err
+        }
+        return json.Marshal(projectJSON(document, readerCodec.raw))
+    case protobufCodec:
+        if _, ok := writerCodec.(protobufCodec); !ok {
+            return nil, errors.New("record was not written with a Protobuf schema")
+        }
+        // The Protobuf wire format already tolerates added and removed fields
+        return readerCodec.Decode(value[5:])
+    }
+    return nil, errors.New("unsupported reader schema")
+}
+
+// projectAvro converts a goavro native value written with writer into the
+// shape expected by reader, leaving missing record fields for their defaults.
+func projectAvro(value interface{}, reader, writer *avroType) (interface{}, error) {
+    if writer.kind == "union" {
+        branch, inner := writer.branches[0], value
+        if wrapped, ok := value.(map[string]interface{}); ok && len(wrapped) == 1 {
+            for name, v := range wrapped {
+                for _, candidate := range writer.branches {
+                    if candidate.describe() == name {
+                        branch, inner = candidate, v
+                    }
+                }
+            }
+        } else if value == nil {
+            for _, candidate := range writer.branches {
+                if candidate.kind == "null" {
+                    branch = candidate
+                }
+            }
+        }
+        return projectAvro(inner, reader, branch)
+    }
+    if reader.kind == "union" {
+        branch := avroUnionBranch(reader, writer)
+        if branch == nil {
+            return nil, fmt.Errorf("%s cannot be read as %s", writer.describe(), reader.describe())
+        }
+        projected, err := projectAvro(value, branch, writer)
+        if err != nil || branch.kind == "null" {
+            return nil, err
+        }
+        return goavro.Union(branch.describe(), projected), nil
+    }
+
+    switch reader.kind {
+    case "record":
+        record, _ := value.(map[string]interface{})
+        projected := make(map[string]interface{}, len(reader.fields))
+        for _, field := range reader.fields {
+            written := writer.field(field.name, field.aliases)
+            if written == nil {
+                continue
+            }
+            v, err := projectAvro(record[written.name], field.typ, written.typ)
+            if err != nil {
+                return nil, err
+            }
+            projected[field.name] = v
+        }
+        return projected, nil
+    case "array":
+        items, _ := value.([]interface{})
+        projected := make([]interface{}, len(items))
+        for i, item := range items {
+            v, err := projectAvro(item, reader.items, writer.items)
+            if err != nil {
+                return nil, err
+            }
+            projected[i] = v
+        }
+        return projected, nil
+    case "map":
+        values, _ := value.(map[string]interface{})
+        projected := make(map[string]interface{}, len(values))
+        for key, item := range values {
+            v, err := projectAvro(item, reader.values, writer.values)
+            if err != nil {
+                return nil, err
+            }
+            projected[key] = v
+        }
+        return projected, nil
+    case "enum":
+        if symbol, _ := value.(string); !containsString(reader.symbols, symbol) && reader.enumDefault != "" {
+            return reader.enumDefault, nil
+        }
+        return value, nil
+    }
+    return promoteAvro(value, reader.kind), nil
+}
+
+// promoteAvro applies the Avro type promotions to a native value.
+func promoteAvro(value interface{}, kind string) interface{} {
+    switch v := value.(type) {
+    case int32:
+        switch kind {
+        case "long":
+            return int64(v)
+        case "float":
+            return float32(v)
+        case "double":
+            return float64(v)
+        }
+    case int64:
+        switch kind {
+        case "float":
+            return float32(v)
+        case "double":
+            return float64(v)
+        }
+    case float32:
+        if kind == "double" {
+            return float64(v)
+        }
+    case string:
+        if kind == "bytes" {
+            return []byte(v)
+        }
+    case []byte:
+        if kind == "string" {
+            return string(v)
+        }
+    }
+    return value
+}
+
+// projectJSON keeps the properties the reader schema declares, filling in
+// their defaults when the record does not have them.
+func projectJSON(value, reader interface{}) interface{} {
+    schema, ok := reader.(map[string]interface{})
+    if !ok {
+        return value
+    }
+    switch v := value.(type) {
+    case map[string]interface{}:
+        properties, ok := schema["properties"].(map[string]interface{})
+        if !ok {
+            return v
+        }
+        projected := make(map[string]interface{}, len(properties))
+        for name, property := range properties {
+            if field, ok := v[name]; ok {
+                projected[name] = projectJSON(field, property)
+            } else if propertySchema, ok := property.(map[string]interface{}); ok {
+                if fallback, ok := propertySchema["default"]; ok {
+                    projected[name] = fallback
+                }
+            }
+        }
+        return projected
+    case []interface{}:
+        projected := make([]interface{}, len(v))
+        for i, item := range v {
+            projected[i] = projectJSON(item, schema["items"])
+        }
+        return projected
+    }
+    return value
+}
+
+// isFramedRecord reports whether value looks like a Confluent wire-format record.
+func isFramedRecord(value []byte) bool {
+    return len(value) >= 5 && value[0] == wireMagicByte
+}
+
+// schemaType returns the normalized type, which is Avro when unset as in the
+// Confluent registry.
+func (s Schema) schemaType() string {
+    if s.Type == "" {
+        return SchemaTypeAvro
+    }
+    return strings.ToUpper(s.Type)
+}
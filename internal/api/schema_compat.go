@@ -0,0 +1,506 @@
+// internal/api/schema_compat.go
+package api
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+
+    "google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Compatibility modes, named as in the Confluent schema registry. BACKWARD
+// means the new schema can read records written with the previous one,
+// FORWARD that the previous schema can read records written with the new one
+// and FULL both.
+const (
+    CompatibilityNone     = "NONE"
+    CompatibilityBackward = "BACKWARD"
+    CompatibilityForward  = "FORWARD"
+    CompatibilityFull     = "FULL"
+)
+
+// defaultCompatibility matches the Confluent registry default.
+const defaultCompatibility = CompatibilityBackward
+
+// normalizeCompatibility returns the upper-cased mode, or an error for unknown modes.
+func normalizeCompatibility(mode string) (string, error) {
+    if mode == "" {
+        return defaultCompatibility, nil
+    }
+    mode = strings.ToUpper(mode)
+    switch mode {
+    case CompatibilityNone, CompatibilityBackward, CompatibilityForward, CompatibilityFull:
+        return mode, nil
+    }
+    return "", fmt.Errorf("%w: compatibility must be NONE, BACKWARD, FORWARD or FULL", ErrInvalidSchema)
+}
+
+// CheckCompatibility returns why next cannot replace previous under mode, one
+// entry per incompatibility. An empty result means the change is allowed.
+func CheckCompatibility(mode string, previous, next Schema) ([]string, error) {
+    mode, err := normalizeCompatibility(mode)
+    if err != nil || mode == CompatibilityNone {
+        return nil, err
+    }
+    if previous.schemaType() != next.schemaType() {
+        return []string{fmt.Sprintf("schema type changed from %s to %s", previous.schemaType(), next.schemaType())}, nil
+    }
+    previousCodec, err := newSchemaCodec(previous)
+    if err != nil {
+        return nil, err
+    }
+    nextCodec, err := newSchemaCodec(next)
+    if err != nil {
+        return nil, err
+    }
+
+    // readErrors lists what stops the reader schema reading the writer's records
+    var readErrors func(reader, writer schemaCodec) []string
+    switch previous.schemaType() {
+    case SchemaTypeAvro:
+        readErrors = func(reader, writer schemaCodec) []string {
+            return avroReadErrors(reader.(avroCodec).schema, writer.(avroCodec).schema, reader.(avroCodec).schema.describe(), map[[2]*avroType]bool{})
+        }
+    case SchemaTypeJSON:
+        readErrors = func(reader, writer schemaCodec) []string {
+            return jsonReadErrors(reader.(jsonCodec).raw, writer.(jsonCodec).raw, "$")
+        }
+    case SchemaTypeProtobuf:
+        readErrors = func(reader, writer schemaCodec) []string {
+            return protobufReadErrors(reader.(protobufCodec).file.Messages().Get(0), writer.(protobufCodec).file.Messages().Get(0))
+        }
+    }
+
+    var issues []string
+    if mode == CompatibilityBackward || mode == CompatibilityFull {
+        for _, issue := range readErrors(nextCodec, previousCodec) {
+            issues = append(issues, "backward: "+issue)
+        }
+    }
+    if mode == CompatibilityForward || mode == CompatibilityFull {
+        for _, issue := range readErrors(previousCodec, nextCodec) {
+            issues = append(issues, "forward: "+issue)
+        }
+    }
+    return issues, nil
+}
+
+// avroType is the parsed form of an Avro schema used for compatibility checks
+// and projection; goavro does not expose one.
+type avroType struct {
+    kind        string // a primitive name, "record", "enum", "array", "map", "fixed" or "union"
+    name        string
+    fullName    string
+    aliases     []string
+    fields      []avroField
+    symbols     []string
+    enumDefault string
+    items       *avroType
+    values      *avroType
+    size        int
+    branches    []*avroType
+}
+
+type avroField struct {
+    name       string
+    aliases    []string
+    typ        *avroType
+    hasDefault bool
+}
+
+var avroPrimitives = map[string]bool{"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true}
+
+// parseAvroSchema parses an Avro schema definition, resolving named types.
+func parseAvroSchema(definition string) (*avroType, error) {
+    var raw interface{}
+    if err := json.Unmarshal([]byte(definition), &raw); err != nil {
+        // A bare primitive name such as string is also a valid schema
+        raw = strings.Trim(definition, ` "`)
+    }
+    named := make(map[string]*avroType)
+    return parseAvroType(raw, "", named)
+}
+
+func parseAvroType(raw interface{}, namespace string, named map[string]*avroType) (*avroType, error) {
+    switch v := raw.(type) {
+    case string:
+        if avroPrimitives[v] {
+            return &avroType{kind: v}, nil
+        }
+        if t, ok := named[qualifyAvroName(v, namespace)]; ok {
+            return t, nil
+        }
+        if t, ok := named[v]; ok {
+            return t, nil
+        }
+        return nil, fmt.Errorf("unknown Avro type %q", v)
+    case []interface{}:
+        union := &avroType{kind: "union"}
+        for _, branch := range v {
+            t, err := parseAvroType(branch, namespace, named)
+            if err != nil {
+                return nil, err
+            }
+            union.branches = append(union.branches, t)
+        }
+        return union, nil
+    case map[string]interface{}:
+        kind, ok := v["type"].(string)
+        if !ok {
+            return parseAvroType(v["type"], namespace, named)
+        }
+        switch kind {
+        case "record", "error", "enum", "fixed":
+            name, _ := v["name"].(string)
+            if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+                namespace = ns
+            }
+            fullName := qualifyAvroName(name, namespace)
+            if i := strings.LastIndex(fullName, "."); i >= 0 {
+                namespace, name = fullName[:i], fullName[i+1:]
+            }
+            t := &avroType{kind: kind, name: name, fullName: fullName, aliases: avroStrings(v["aliases"])}
+            if kind == "error" {
+                t.kind = "record"
+            }
+            named[fullName] = t
+            switch t.kind {
+            case "record":
+                fields, _ := v["fields"].([]interface{})
+                for _, field := range fields {
+                    f, _ := field.(map[string]interface{})
+                    fieldType, err := parseAvroType(f["type"], namespace, named)
+                    if err != nil {
+                        return nil, err
+                    }
+                    fieldName, _ := f["name"].(string)
+                    _, hasDefault := f["default"]
+                    t.fields = append(t.fields, avroField{name: fieldName, aliases: avroStrings(f["aliases"]), typ: fieldType, hasDefault: hasDefault})
+                }
+            case "enum":
+                t.symbols = avroStrings(v["symbols"])
+                t.enumDefault, _ = v["default"].(string)
+            case "fixed":
+                size, _ := v["size"].(float64)
+                t.size = int(size)
+            }
+            return t, nil
+        case "array":
+            items, err := parseAvroType(v["items"], namespace, named)
+            return &avroType{kind: "array", items: items}, err
+        case "map":
+            values, err := parseAvroType(v["values"], namespace, named)
+            return &avroType{kind: "map", values: values}, err
+        default:
+            // Primitives with attributes, such as logical types
+            return parseAvroType(kind, namespace, named)
+        }
+    }
+    return nil, fmt.Errorf("unsupported Avro schema %v", raw)
+}
+
+func qualifyAvroName(name, namespace string) string {
+    if strings.Contains(name, ".") || namespace == "" {
+        return name
+    }
+    return namespace + "." + name
+}
+
+func avroStrings(raw interface{}) []string {
+    list, _ := raw.([]interface{})
+    values := make([]string, 0, len(list))
+    for _, item := range list {
+        if s, ok := item.(string); ok {
+            values = append(values, s)
+        }
+    }
+    return values
+}
+
+// describe returns the type's name as used in union branches.
+func (t *avroType) describe() string {
+    if t.fullName != "" {
+        return t.fullName
+    }
+    return t.kind
+}
+
+// field finds the field read as name, trying the reader's aliases too.
+func (t *avroType) field(name string, aliases []string) *avroField {
+    for _, candidate := range append([]string{name}, aliases...) {
+        for i := range t.fields {
+            if t.fields[i].name == candidate {
+                return &t.fields[i]
+            }
+        }
+    }
+    return nil
+}
+
+// namesMatch follows the Avro rule that named types match on their
+// unqualified name or one of the reader's aliases.
+func (t *avroType) namesMatch(writer *avroType) bool {
+    if t.name == writer.name {
+        return true
+    }
+    for _, alias := range t.aliases {
+        if alias == writer.name || alias == writer.fullName {
+            return true
+        }
+    }
+    return false
+}
+
+// avroPromotions lists the writer types each reader type can be promoted from.
+var avroPromotions = map[string][]string{
+    "long":   {"int"},
+    "float":  {"int", "long"},
+    "double": {"int", "long", "float"},
+    "string": {"bytes"},
+    "bytes":  {"string"},
+}
+
+func avroPromotable(writer, reader string) bool {
+    for _, from := range avroPromotions[reader] {
+        if from == writer {
+            return true
+        }
+    }
+    return false
+}
+
+// avroReadErrors applies the Avro schema resolution rules: it lists what stops
+// records written with writer being read with reader.
+func avroReadErrors(reader, writer *avroType, path string, seen map[[2]*avroType]bool) []string {
+    if writer.kind == "union" {
+        var issues []string
+        for _, branch := range writer.branches {
+            issues = append(issues, avroReadErrors(reader, branch, path, seen)...)
+        }
+        return issues
+    }
+    if reader.kind == "union" {
+        if avroUnionBranch(reader, writer) == nil {
+            return []string{fmt.Sprintf("%s: %s is not accepted by the reader union", path, writer.describe())}
+        }
+        return nil
+    }
+    if avroPromotable(writer.kind, reader.kind) {
+        return nil
+    }
+    if reader.kind != writer.kind {
+        return []string{fmt.Sprintf("%s: type changed from %s to %s", path, writer.describe(), reader.describe())}
+    }
+
+    switch reader.kind {
+    case "record", "enum", "fixed":
+        if !reader.namesMatch(writer) {
+            return []string{fmt.Sprintf("%s: %s %s renamed to %s", path, reader.kind, writer.fullName, reader.fullName)}
+        }
+    }
+    var issues []string
+    switch reader.kind {
+    case "record":
+        key := [2]*avroType{reader, writer}
+        if seen[key] {
+            return nil
+        }
+        seen[key] = true
+        for _, field := range reader.fields {
+            written := writer.field(field.name, field.aliases)
+            if written == nil {
+                if !field.hasDefault {
+                    issues = append(issues, fmt.Sprintf("%s.%s: field added without a default", path, field.name))
+                }
+                continue
+            }
+            issues = append(issues, avroReadErrors(field.typ, written.typ, path+"."+field.name, seen)...)
+        }
+    case "enum":
+        if reader.enumDefault != "" {
+            return nil
+        }
+        for _, symbol := range writer.symbols {
+            if !containsString(reader.symbols, symbol) {
+                issues = append(issues, fmt.Sprintf("%s: enum symbol %s removed", path, symbol))
+            }
+        }
+    case "fixed":
+        if reader.size != writer.size {
+            issues = append(issues, fmt.Sprintf("%s: fixed size changed from %d to %d", path, writer.size, reader.size))
+        }
+    case "array":
+        issues = avroReadErrors(reader.items, writer.items, path+"[]", seen)
+    case "map":
+        issues = avroReadErrors(reader.values, writer.values, path+"{}", seen)
+    }
+    return issues
+}
+
+// avroUnionBranch returns the first reader union branch that can read writer.
+func avroUnionBranch(reader, writer *avroType) *avroType {
+    for _, branch := range reader.branches {
+        if len(avroReadErrors(branch, writer, "", map[[2]*avroType]bool{})) == 0 {
+            return branch
+        }
+    }
+    return nil
+}
+
+func containsString(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+    return false
+}
+
+// jsonReadErrors lists JSON documents that writer accepts but reader rejects,
+// as far as can be told from types, enums, required and declared properties.
+func jsonReadErrors(reader, writer interface{}, path string) []string {
+    readerSchema, ok := reader.(map[string]interface{})
+    if !ok {
+        if reader == false {
+            return []string{path + ": schema now rejects every value"}
+        }
+        return nil
+    }
+    writerSchema, _ := writer.(map[string]interface{})
+    if _, ref := readerSchema["$ref"]; ref {
+        return nil
+    }
+
+    var issues []string
+    if readerTypes := jsonTypes(readerSchema); readerTypes != nil {
+        writerTypes := jsonTypes(writerSchema)
+        if writerTypes == nil {
+            issues = append(issues, fmt.Sprintf("%s: type is now restricted to %s", path, strings.Join(sortedKeys(readerTypes), ", ")))
+        }
+        for _, t := range sortedKeys(writerTypes) {
+            if !readerTypes[t] && !(t == "integer" && readerTypes["number"]) {
+                issues = append(issues, fmt.Sprintf("%s: type %s is no longer accepted", path, t))
+            }
+        }
+    }
+
+    if readerEnum, ok := readerSchema["enum"].([]interface{}); ok {
+        writerEnum, ok := writerSchema["enum"].([]interface{})
+        if !ok {
+            issues = append(issues, fmt.Sprintf("%s: values are now restricted to an enum", path))
+        }
+        allowed := make(map[string]bool, len(readerEnum))
+        for _, value := range readerEnum {
+            encoded, _ := json.Marshal(value)
+            allowed[string(encoded)] = true
+        }
+        for _, value := range writerEnum {
+            if encoded, _ := json.Marshal(value); !allowed[string(encoded)] {
+                issues = append(issues, fmt.Sprintf("%s: enum value %s removed", path, encoded))
+            }
+        }
+    }
+
+    writerRequired := make(map[string]bool)
+    for _, name := range avroStrings(writerSchema["required"]) {
+        writerRequired[name] = true
+    }
+    for _, name := range avroStrings(readerSchema["required"]) {
+        if !writerRequired[name] {
+            issues = append(issues, fmt.Sprintf("%s: property %s is now required", path, name))
+        }
+    }
+
+    readerProperties, _ := readerSchema["properties"].(map[string]interface{})
+    writerProperties, _ := writerSchema["properties"].(map[string]interface{})
+    closed := readerSchema["additionalProperties"] == false
+    for _, name := range sortedKeys(writerProperties) {
+        if property, ok := readerProperties[name]; ok {
+            issues = append(issues, jsonReadErrors(property, writerProperties[name], path+"."+name)...)
+        } else if closed {
+            issues = append(issues, fmt.Sprintf("%s: property %s is no longer allowed", path, name))
+        }
+    }
+
+    if items, ok := readerSchema["items"].(map[string]interface{}); ok {
+        issues = append(issues, jsonReadErrors(items, writerSchema["items"], path+"[]")...)
+    }
+    return issues
+}
+
+// jsonTypes returns the set of types a schema allows, or nil for any type.
+func jsonTypes(schema map[string]interface{}) map[string]bool {
+    switch t := schema["type"].(type) {
+    case string:
+        return map[string]bool{t: true}
+    case []interface{}:
+        types := make(map[string]bool, len(t))
+        for _, name := range avroStrings(t) {
+            types[name] = true
+        }
+        return types
+    }
+    return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for key := range m {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// protobufWireGroups groups field kinds that share a wire encoding and can be
+// read as one another.
+var protobufWireGroups = map[protoreflect.Kind]string{
+    protoreflect.Int32Kind: "varint", protoreflect.Int64Kind: "varint", protoreflect.Uint32Kind: "varint",
+    protoreflect.Uint64Kind: "varint", protoreflect.BoolKind: "varint", protoreflect.EnumKind: "varint",
+    protoreflect.Sint32Kind: "zigzag", protoreflect.Sint64Kind: "zigzag",
+    protoreflect.Fixed32Kind: "fixed32", protoreflect.Sfixed32Kind: "fixed32",
+    protoreflect.Fixed64Kind: "fixed64", protoreflect.Sfixed64Kind: "fixed64",
+    protoreflect.StringKind: "bytes", protoreflect.BytesKind: "bytes",
+}
+
+// protobufReadErrors lists field changes that stop reader decoding messages
+// written with writer. Added and removed fields are always readable.
+func protobufReadErrors(reader, writer protoreflect.MessageDescriptor) []string {
+    if reader.FullName() != writer.FullName() {
+        return []string{fmt.Sprintf("message %s renamed to %s", writer.FullName(), reader.FullName())}
+    }
+    return protobufFieldErrors(reader, writer, string(reader.Name()), map[protoreflect.FullName]bool{})
+}
+
+func protobufFieldErrors(reader, writer protoreflect.MessageDescriptor, path string, seen map[protoreflect.FullName]bool) []string {
+    if seen[writer.FullName()] {
+        return nil
+    }
+    seen[writer.FullName()] = true
+
+    var issues []string
+    fields := writer.Fields()
+    for i := 0; i < fields.Len(); i++ {
+        written := fields.Get(i)
+        read := reader.Fields().ByNumber(written.Number())
+        if read == nil {
+            continue
+        }
+        fieldPath := fmt.Sprintf("%s.%s", path, read.Name())
+        if read.IsList() != written.IsList() || read.IsMap() != written.IsMap() {
+            issues = append(issues, fmt.Sprintf("%s: field %d changed between repeated and singular", fieldPath, written.Number()))
+            continue
+        }
+        sameKind := read.Kind() == written.Kind()
+        if !sameKind && (protobufWireGroups[read.Kind()] == "" || protobufWireGroups[read.Kind()] != protobufWireGroups[written.Kind()]) {
+            issues = append(issues, fmt.Sprintf("%s: field %d changed type from %s to %s", fieldPath, written.Number(), written.Kind(), read.Kind()))
+            continue
+        }
+        if read.Message() != nil && written.Message() != nil {
+            issues = append(issues, protobufFieldErrors(read.Message(), written.Message(), fieldPath, seen)...)
+        }
+    }
+    return issues
+}
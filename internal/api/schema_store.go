@@ -0,0 +1,441 @@
+// internal/api/schema_store.go
+package api
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+)
+
+// Schema types, named as in the Confluent schema registry.
+const (
+    SchemaTypeAvro     = "AVRO"
+    SchemaTypeJSON     = "JSON"
+    SchemaTypeProtobuf = "PROTOBUF"
+)
+
+// ErrSchemaNotFound is returned for unknown subjects and schema ids.
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// Schema is a registered schema version.
+type Schema struct {
+    ID         int    `json:"id"`
+    Subject    string `json:"subject"`
+    Version    int    `json:"version"`
+    Type       string `json:"schemaType,omitempty"`
+    Definition string `json:"schema"`
+}
+
+// SchemaStore holds schemas by subject and id, either locally or in a
+// Confluent-compatible schema registry.
+type SchemaStore interface {
+    // Register adds the schema as the next version of subject, returning the
+    // existing version when an identical schema is already registered.
+    Register(subject string, schema Schema) (Schema, error)
+    Latest(subject string) (Schema, error)
+    Version(subject string, version int) (Schema, error)
+    Versions(subject string) ([]int, error)
+    ByID(id int) (Schema, error)
+}
+
+// LocalSchemaStore keeps schemas in process memory, optionally persisted to a
+// JSON file so streams bound to them survive restarts.
+type LocalSchemaStore struct {
+    mu      sync.Mutex
+    path    string
+    schemas []Schema
+}
+
+// NewLocalSchemaStore opens a local store, loading the file at path if there
+// is one. An empty path keeps schemas in memory only.
+func NewLocalSchemaStore(path string) (*LocalSchemaStore, error) {
+    s := &LocalSchemaStore{path: path}
+    if path == "" {
+        return s, nil
+    }
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return s, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("reading schema store: %w", err)
+    }
+    if err := json.Unmarshal(data, &s.schemas); err != nil {
+        return nil, fmt.Errorf("parsing schema store %s: %w", path, err)
+    }
+    return s, nil
+}
+
+func (s *LocalSchemaStore) Register(subject string, schema Schema) (Schema, error) {
+    schema.Type = schema.schemaType()
+    if _, err := newSchemaCodec(schema); err != nil {
+        return Schema{}, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    id, version := 0, 0
+    for _, existing := range s.schemas {
+        same := existing.Type == schema.Type && existing.Definition == schema.Definition
+        if existing.Subject == subject {
+            if same {
+                return existing, nil
+            }
+            version = existing.Version
+        }
+        if same {
+            id = existing.ID
+        }
+    }
+    if id == 0 {
+        id = s.nextIDLocked()
+    }
+    schema.ID, schema.Subject, schema.Version = id, subject, version+1
+    s.schemas = append(s.schemas, schema)
+    if s.path != "" {
+        data, err := json.MarshalIndent(s.schemas, "", "  ")
+        if err == nil {
+            err = writeFileAtomic(s.path, data)
+        }
+        if err != nil {
+            s.schemas = s.schemas[:len(s.schemas)-1]
+            return Schema{}, fmt.Errorf("writing schema store: %w", err)
+        }
+    }
+    return schema, nil
+}
+
+func (s *LocalSchemaStore) nextIDLocked() int {
+    max := 0
+    for _, existing := range s.schemas {
+        if existing.ID > max {
+            max = existing.ID
+        }
+    }
+    return max + 1
+}
+
+func (s *LocalSchemaStore) Latest(subject string) (Schema, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var latest *Schema
+    for i := range s.schemas {
+        if s.schemas[i].Subject == subject && (latest == nil || s.schemas[i].Version > latest.Version) {
+            latest = &s.schemas[i]
+        }
+    }
+    if latest == nil {
+        return Schema{}, fmt.Errorf("%w: subject %s", ErrSchemaNotFound, subject)
+    }
+    return *latest, nil
+}
+
+func (s *LocalSchemaStore) Version(subject string, version int) (Schema, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, existing := range s.schemas {
+        if existing.Subject == subject && existing.Version == version {
+            return existing, nil
+        }
+    }
+    return Schema{}, fmt.Errorf("%w: subject %s version %d", ErrSchemaNotFound, subject, version)
+}
+
+func (s *LocalSchemaStore) Versions(subject string) ([]int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var versions []int
+    for _, existing := range s.schemas {
+        if existing.Subject == subject {
+            versions = append(versions, existing.Version)
+        }
+    }
+    if len(versions) == 0 {
+        return nil, fmt.Errorf("%w: subject %s", ErrSchemaNotFound, subject)
+    }
+    sort.Ints(versions)
+    return versions, nil
+}
+
+func (s *LocalSchemaStore) ByID(id int) (Schema, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, existing := range s.schemas {
+        if existing.ID == id {
+            return existing, nil
+        }
+    }
+    return Schema{}, fmt.Errorf("%w: id %d", ErrSchemaNotFound, id)
+}
+
+// subjects returns the registered subject names in order.
+func (s *LocalSchemaStore) subjects() []string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    seen := make(map[string]bool)
+    var subjects []string
+    for _, existing := range s.schemas {
+        if !seen[existing.Subject] {
+            seen[existing.Subject] = true
+            subjects = append(subjects, existing.Subject)
+        }
+    }
+    sort.Strings(subjects)
+    return subjects
+}
+
+// registryContentType is the media type spoken by Confluent-compatible registries.
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// RegistrySchemaStore talks to a Confluent-compatible schema registry.
+type RegistrySchemaStore struct {
+    URL      string
+    Username string
+    Password string
+    Client   *http.Client
+}
+
+// NewRegistrySchemaStore returns a client for the registry at baseURL.
+func NewRegistrySchemaStore(baseURL string) *RegistrySchemaStore {
+    return &RegistrySchemaStore{URL: strings.TrimSuffix(baseURL, "/"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// registryError is the error body returned by the registry.
+type registryError struct {
+    ErrorCode int    `json:"error_code"`
+    Message   string `json:"message"`
+}
+
+func (s *RegistrySchemaStore) do(method, path string, body, out interface{}) error {
+    var reader io.Reader
+    if body != nil {
+        data, err := json.Marshal(body)
+        if err != nil {
+            return err
+        }
+        reader = bytes.NewReader(data)
+    }
+    req, err := http.NewRequest(method, s.URL+path, reader)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", registryContentType)
+    if body != nil {
+        req.Header.Set("Content-Type", registryContentType)
+    }
+    if s.Username != "" {
+        req.SetBasicAuth(s.Username, s.Password)
+    }
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return fmt.Errorf("schema registry: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        var regErr registryError
+        json.NewDecoder(resp.Body).Decode(&regErr)
+        switch {
+        case resp.StatusCode == http.StatusNotFound:
+            return fmt.Errorf("%w: %s", ErrSchemaNotFound, regErr.Message)
+        case resp.StatusCode == http.StatusUnprocessableEntity:
+            return fmt.Errorf("%w: %s", ErrInvalidSchema, regErr.Message)
+        default:
+            return fmt.Errorf("schema registry returned %d: %s", resp.StatusCode, regErr.Message)
+        }
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (s *RegistrySchemaStore) Register(subject string, schema Schema) (Schema, error) {
+    body := map[string]string{"schema": schema.Definition, "schemaType": schema.schemaType()}
+    var registered struct {
+        ID int `json:"id"`
+    }
+    path := "/subjects/" + url.PathEscape(subject) + "/versions"
+    if err := s.do(http.MethodPost, path, body, &registered); err != nil {
+        return Schema{}, err
+    }
+    // Registration only answers with the id; look the version up under the subject
+    var found Schema
+    if err := s.do(http.MethodPost, "/subjects/"+url.PathEscape(subject), body, &found); err != nil {
+        return Schema{}, err
+    }
+    found.ID = registered.ID
+    return found, nil
+}
+
+func (s *RegistrySchemaStore) Latest(subject string) (Schema, error) {
+    var schema Schema
+    err := s.do(http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &schema)
+    return schema, err
+}
+
+func (s *RegistrySchemaStore) Version(subject string, version int) (Schema, error) {
+    var schema Schema
+    err := s.do(http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/"+strconv.Itoa(version), nil, &schema)
+    return schema, err
+}
+
+func (s *RegistrySchemaStore) Versions(subject string) ([]int, error) {
+    var versions []int
+    err := s.do(http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions", nil, &versions)
+    return versions, err
+}
+
+func (s *RegistrySchemaStore) ByID(id int) (Schema, error) {
+    var schema Schema
+    if err := s.do(http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &schema); err != nil {
+        return Schema{}, err
+    }
+    schema.ID = id
+    return schema, nil
+}
+
+// SchemaRegistryHandler serves a LocalSchemaStore over the subset of the
+// Confluent schema registry API used by RegistrySchemaStore, as a local
+// stand-in for a real registry.
+func SchemaRegistryHandler(store *LocalSchemaStore) http.Handler {
+    router := mux.NewRouter()
+    writeRegistry := func(w http.ResponseWriter, status int, v interface{}) {
+        w.Header().Set("Content-Type", registryContentType)
+        w.WriteHeader(status)
+        json.NewEncoder(w).Encode(v)
+    }
+    fail := func(w http.ResponseWriter, err error) {
+        switch {
+        case errors.Is(err, ErrSchemaNotFound):
+            writeRegistry(w, http.StatusNotFound, registryError{ErrorCode: 40401, Message: err.Error()})
+        case errors.Is(err, ErrInvalidSchema):
+            writeRegistry(w, http.StatusUnprocessableEntity, registryError{ErrorCode: 42201, Message: err.Error()})
+        default:
+            writeRegistry(w, http.StatusInternalServerError, registryError{ErrorCode: 50001, Message: err.Error()})
+        }
+    }
+    decode := func(r *http.Request) (Schema, error) {
+        var schema Schema
+        if err := json.NewDecoder(r.Body).Decode(&schema); err != nil {
+            return Schema{}, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+        }
+        return schema, nil
+    }
+
+    router.HandleFunc("/subjects", func(w http.ResponseWriter, r *http.Request) {
+        writeRegistry(w, http.StatusOK, store.subjects())
+    }).Methods("GET")
+    router.HandleFunc("/subjects/{subject}/versions", func(w http.ResponseWriter, r *http.Request) {
+        schema, err := decode(r)
+        if err == nil {
+            schema, err = store.Register(mux.Vars(r)["subject"], schema)
+        }
+        if err != nil {
+            fail(w, err)
+            return
+        }
+        writeRegistry(w, http.StatusOK, map[string]int{"id": schema.ID})
+    }).Methods("POST")
+    router.HandleFunc("/subjects/{subject}/versions", func(w http.ResponseWriter, r *http.Request) {
+        versions, err := store.Versions(mux.Vars(r)["subject"])
+        if err != nil {
+            fail(w, err)
+            return
+        }
+        writeRegistry(w, http.StatusOK, versions)
+    }).Methods("GET")
+    router.HandleFunc("/subjects/{subject}/versions/{version}", func(w http.ResponseWriter, r *http.Request) {
+        vars := mux.Vars(r)
+        var schema Schema
+        var err error
+        if vars["version"] == "latest" {
+            schema, err = store.Latest(vars["subject"])
+        } else {
+            version, _ := strconv.Atoi(vars["version"])
+            schema, err = store.Version(vars["subject"], version)
+        }
+        if err != nil {
+            fail(w, err)
+            return
+        }
+        writeRegistry(w, http.StatusOK, schema)
+    }).Methods("GET")
+    router.HandleFunc("/subjects/{subject}", func(w http.ResponseWriter, r *http.Request) {
+        lookup, err := decode(r)
+        if err != nil {
+            fail(w, err)
+            return
+        }
+        lookup.Type = lookup.schemaType()
+        store.mu.Lock()
+        defer store.mu.Unlock()
+        for _, existing := range store.schemas {
+            if existing.Subject == mux.Vars(r)["subject"] && existing.Type == lookup.Type && existing.Definition == lookup.Definition {
+                writeRegistry(w, http.StatusOK, existing)
+                return
+            }
+        }
+        fail(w, fmt.Errorf("%w: schema not registered under subject", ErrSchemaNotFound))
+    }).Methods("POST")
+    router.HandleFunc("/schemas/ids/{id}", func(w http.ResponseWriter, r *http.Request) {
+        id, _ := strconv.Atoi(mux.Vars(r)["id"])
+        schema, err := store.ByID(id)
+        if err != nil {
+            fail(w, err)
+            return
+        }
+        writeRegistry(w, http.StatusOK, map[string]string{"schema": schema.Definition, "schemaType": schema.Type})
+    }).Methods("GET")
+    return router
+}
+
+// SchemaStoreFromEnv builds the schema store: the Confluent-compatible
+// registry at SCHEMA_REGISTRY_URL (with SCHEMA_REGISTRY_USERNAME and
+// SCHEMA_REGISTRY_PASSWORD, or their _FILE variants), otherwise a local store
+// persisted to SCHEMA_STORE_PATH when set.
+func SchemaStoreFromEnv() (SchemaStore, error) {
+    if registryURL := os.Getenv("SCHEMA_REGISTRY_URL"); registryURL != "" {
+        store := NewRegistrySchemaStore(registryURL)
+        var err error
+        if store.Username, err = envOrFile("SCHEMA_REGISTRY_USERNAME"); err != nil {
+            return nil, err
+        }
+        if store.Password, err = envOrFile("SCHEMA_REGISTRY_PASSWORD"); err != nil {
+            return nil, err
+        }
+        return store, nil
+    }
+    return NewLocalSchemaStore(os.Getenv("SCHEMA_STORE_PATH"))
+}
+
+var (
+    schemaStoreMu sync.RWMutex
+    schemaStore   SchemaStore = &LocalSchemaStore{}
+)
+
+// UseSchemaStore replaces the schema store used to bind and validate streams.
+func UseSchemaStore(store SchemaStore) {
+    schemaStoreMu.Lock()
+    defer schemaStoreMu.Unlock()
+    schemaStore = store
+    schemaCodecs.Range(func(key, _ interface{}) bool {
+        schemaCodecs.Delete(key)
+        return true
+    })
+}
+
+func currentSchemaStore() SchemaStore {
+    schemaStoreMu.RLock()
+    defer schemaStoreMu.RUnlock()
+    return schemaStore
+}
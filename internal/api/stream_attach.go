@@ -0,0 +1,355 @@
+// internal/api/stream_attach.go
+package api
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "sort"
+    "sync"
+
+    "github.com/segmentio/kafka-go"
+)
+
+// Start positions for attached streams.
+const (
+    StartOffsetEarliest = "earliest"
+    StartOffsetLatest   = "latest"
+)
+
+// ErrTopicNotFound is returned when attaching to a topic the cluster does not have.
+var ErrTopicNotFound = errors.New("topic does not exist")
+
+// AttachStreamRequest is the body of POST /streams/attach. Name defaults to
+// the topic; Partitions defaults to every partition and StartOffset to earliest.
+// A schema binding decodes the topic's wire-format records for subscribers.
+type AttachStreamRequest struct {
+    Name        string         `json:"name,omitempty"`
+    Topic       string         `json:"topic"`
+    Partitions  []int          `json:"partitions,omitempty"`
+    StartOffset string         `json:"start_offset,omitempty"`
+    Schema      *SchemaBinding `json:"schema,omitempty"`
+}
+
+// Validate checks the request without contacting the cluster.
+func (a AttachStreamRequest) Validate() error {
+    if a.Topic == "" {
+        return errors.New("topic is required")
+    }
+    if err := ValidateStreamID(a.Topic); err != nil {
+        return fmt.Errorf("topic %q is not a valid Kafka topic name", a.Topic)
+    }
+    if a.Name != "" {
+        if err := ValidateStreamID(a.Name); err != nil {
+            return fmt.Errorf("invalid stream name: %w", err)
+        }
+    }
+    if a.StartOffset != "" && a.StartOffset != StartOffsetEarliest && a.StartOffset != StartOffsetLatest {
+        return fmt.Errorf("start_offset must be %s or %s", StartOffsetEarliest, StartOffsetLatest)
+    }
+    seen := make(map[int]bool, len(a.Partitions))
+    for _, partition := range a.Partitions {
+        if partition < 0 || seen[partition] {
+            return fmt.Errorf("partitions must be distinct non-negative partition ids")
+        }
+        seen[partition] = true
+    }
+    return nil
+}
+
+// topicPartitions returns the partition ids of an existing topic.
+func topicPartitions(ctx context.Context, topic string) ([]int, error) {
+    conn, err := dialBroker(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
+
+    partitions, err := conn.ReadPartitions(topic)
+    if errors.Is(err, kafka.UnknownTopicOrPartition) || (err == nil && len(partitions) == 0) {
+        return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic)
+    }
+    if err != nil {
+        return nil, err
+    }
+    ids := make([]int, len(partitions))
+    for i, partition := range partitions {
+        ids[i] = partition.ID
+    }
+    return ids, nil
+}
+
+// AttachStream handles POST /streams/attach, registering an existing topic as
+// a read-only stream. The topic is never created, altered or written to. Only
+// admin principals may attach, and not to the audit topic or to topics under
+// another tenant's topic prefix.
+func AttachStream(w http.ResponseWriter, r *http.Request) {
+    if !isAdmin(r) {
+        Audit(r, AuditActionStreamAttach, "", AuditOutcomeDenied, "not an admin principal")
+        writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "Attaching topics requires an admin principal")
+        return
+    }
+    var request AttachStreamRequest
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&request); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid attach request: "+err.Error())
+        return
+    }
+    if err := request.Validate(); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+    streamID := request.Name
+    if streamID == "" {
+        streamID = request.Topic
+    }
+    if request.StartOffset == "" {
+        request.StartOffset = StartOffsetEarliest
+    }
+    tenant := tenantFromRequest(r)
+    if auditTopic := os.Getenv("AUDIT_KAFKA_TOPIC"); auditTopic != "" && topicCollisionKey(request.Topic) == topicCollisionKey(auditTopic) {
+        Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeDenied, "audit topic")
+        writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "Topic "+request.Topic+" is the audit topic and cannot be attached")
+        return
+    }
+    if streamManager.topicOwnedByOtherTenant(request.Topic, tenant) {
+        Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeDenied, "topic of another tenant")
+        writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "Topic "+request.Topic+" belongs to another tenant's streams")
+        return
+    }
+    if err := streamManager.CheckAvailable(streamID, request.Topic, tenant); err != nil {
+        Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeRejected, err.Error())
+        writeError(w, r, http.StatusConflict, ErrCodeStreamExists, err.Error())
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(r.Context(), topicAdminTimeout)
+    defer cancel()
+    available, err := topicPartitions(ctx, request.Topic)
+    if errors.Is(err, ErrTopicNotFound) {
+        Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeRejected, err.Error())
+        writeError(w, r, http.StatusNotFound, ErrCodeTopicNotFound, "Kafka topic "+request.Topic+" does not exist")
+        return
+    }
+    if err != nil {
+        Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, kafkaAPIError(err))
+        return
+    }
+    exists := make(map[int]bool, len(available))
+    for _, partition := range available {
+        exists[partition] = true
+    }
+    for _, partition := range request.Partitions {
+        if !exists[partition] {
+            writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Topic %s has no partition %d", request.Topic, partition))
+            return
+        }
+    }
+    sort.Ints(request.Partitions)
+    var schema *StreamSchema
+    if request.Schema != nil {
+        if schema, err = bindSchema(request.Topic, tenant, *request.Schema); err != nil {
+            Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeRejected, err.Error())
+            WriteError(w, r, schemaAPIError(err))
+            return
+        }
+    }
+
+    info := StreamInfo{
+        ID:          streamID,
+        Topic:       request.Topic,
+        Tenant:      tenant,
+        Owner:       PrincipalFromRequest(r),
+        ReadOnly:    true,
+        Partitions:  request.Partitions,
+        StartOffset: request.StartOffset,
+        Schema:      schema,
+    }
+    registered, err := streamManager.RegisterStream(info)
+    if err != nil {
+        Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeFailure, err.Error())
+        if errors.Is(err, ErrStreamExists) {
+            writeError(w, r, http.StatusConflict, ErrCodeStreamExists, err.Error())
+            return
+        }
+        WriteError(w, r, err)
+        return
+    }
+    Audit(r, AuditActionStreamAttach, streamID, AuditOutcomeSuccess, "")
+    writeJSON(w, http.StatusCreated, registered)
+}
+
+// streamReader is what GetResults consumes from: a consumer group reader for
+// whole topics, or merged partition readers for attached partition subsets.
+type streamReader interface {
+    ReadMessage(ctx context.Context) (kafka.Message, error)
+    Stats() kafka.ReaderStats
+    Close() error
+}
+
+// CommittingReader is a streamReader whose offsets are committed by its
+// caller once records are handled. The server's own consumers, webhooks and
+// routing rules, read with one so records they have not finished with are
+// read again after a restart. Partition-subset readers have no consumer group
+// and commit nothing.
+type CommittingReader interface {
+    streamReader
+    FetchMessage(ctx context.Context) (kafka.Message, error)
+    CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// attachedReader reads a read-only stream from its start offset. Partition
+// subsets are read without a consumer group, so every subscription starts
+// again from the start offset.
+func attachedReader(brokers []string, info *StreamInfo, groupID string) CommittingReader {
+    startOffset := kafka.FirstOffset
+    if info.StartOffset == StartOffsetLatest {
+        startOffset = kafka.LastOffset
+    }
+    if len(info.Partitions) == 0 {
+        return kafka.NewReader(kafka.ReaderConfig{
+            Brokers:     brokers,
+            Topic:       info.topicName(),
+            GroupID:     groupID,
+            MinBytes:    10e3,
+            MaxBytes:    10e6,
+            StartOffset: startOffset,
+            Dialer:      brokerConfig.Dialer(),
+        })
+    }
+
+    readers := make([]*kafka.Reader, 0, len(info.Partitions))
+    for _, partition := range info.Partitions {
+        reader := kafka.NewReader(kafka.ReaderConfig{
+            Brokers:   brokers,
+            Topic:     info.topicName(),
+            Partition: partition,
+            MinBytes:  10e3,
+            MaxBytes:  10e6,
+            Dialer:    brokerConfig.Dialer(),
+        })
+        reader.SetOffset(startOffset)
+        readers = append(readers, reader)
+    }
+    log.WithField("topic", info.topicName()).WithField("partitions", info.Partitions).Info("Kafka partition readers initialized")
+    return newPartitionReaders(readers)
+}
+
+// GroupReaderFunc opens the reader the server's own consumers read a stream
+// with, under their consumer group.
+type GroupReaderFunc func(info *StreamInfo, groupID string) CommittingReader
+
+var (
+    groupReaderFunc GroupReaderFunc = groupReader
+    groupReaderMu   sync.Mutex
+)
+
+// groupReader reads attached streams like subscribers do and others from
+// their topic's first offset.
+func groupReader(info *StreamInfo, groupID string) CommittingReader {
+    if info.ReadOnly {
+        return attachedReader(brokerConfig.Brokers, info, groupID)
+    }
+    return KafkaReader(brokerConfig.Brokers, info.topicName(), groupID)
+}
+
+// UseGroupReader replaces how webhooks and routing rules started afterwards
+// read their streams; nil restores Kafka consumer groups.
+func UseGroupReader(f GroupReaderFunc) {
+    groupReaderMu.Lock()
+    defer groupReaderMu.Unlock()
+    if f == nil {
+        f = groupReader
+    }
+    groupReaderFunc = f
+}
+
+func currentGroupReader() GroupReaderFunc {
+    groupReaderMu.Lock()
+    defer groupReaderMu.Unlock()
+    return groupReaderFunc
+}
+
+type readResult struct {
+    message kafka.Message
+    err     error
+}
+
+// partitionReaders merges several single-partition readers into one stream.
+type partitionReaders struct {
+    readers []*kafka.Reader
+    results chan readResult
+    cancel  context.CancelFunc
+}
+
+func newPartitionReaders(readers []*kafka.Reader) *partitionReaders {
+    ctx, cancel := context.WithCancel(context.Background())
+    pr := &partitionReaders{readers: readers, results: make(chan readResult), cancel: cancel}
+    for _, reader := range readers {
+        go func(reader *kafka.Reader) {
+            for {
+                m, err := reader.ReadMessage(ctx)
+                select {
+                case pr.results <- readResult{message: m, err: err}:
+                case <-ctx.Done():
+                    return
+                }
+                if err != nil {
+                    return
+                }
+            }
+        }(reader)
+    }
+    return pr
+}
+
+// ReadMessage returns the next message from any of the partitions.
+func (pr *partitionReaders) ReadMessage(ctx context.Context) (kafka.Message, error) {
+    select {
+    case result := <-pr.results:
+        return result.message, result.err
+    case <-ctx.Done():
+        return kafka.Message{}, ctx.Err()
+    }
+}
+
+// FetchMessage is ReadMessage: partition readers have no offsets to commit.
+func (pr *partitionReaders) FetchMessage(ctx context.Context) (kafka.Message, error) {
+    return pr.ReadMessage(ctx)
+}
+
+// CommitMessages does nothing; partition subsets are always read from the
+// stream's start offset.
+func (pr *partitionReaders) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+    return nil
+}
+
+// Stats sums the statistics of the partition readers.
+func (pr *partitionReaders) Stats() kafka.ReaderStats {
+    var total kafka.ReaderStats
+    for _, reader := range pr.readers {
+        stats := reader.Stats()
+        total.Topic = stats.Topic
+        total.Messages += stats.Messages
+        total.Bytes += stats.Bytes
+        total.Lag += stats.Lag
+    }
+    return total
+}
+
+// Close stops reading and closes every partition reader.
+func (pr *partitionReaders) Close() error {
+    pr.cancel()
+    var firstErr error
+    for _, reader := range pr.readers {
+        if err := reader.Close(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
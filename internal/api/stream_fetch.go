@@ -0,0 +1,172 @@
+// internal/api/stream_fetch.go
+package api
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Long-poll fetch limits
+const (
+    defaultFetchRecords = 100
+    maxFetchRecords     = 1000
+    defaultFetchWait    = 10 * time.Second
+    maxFetchWait        = 30 * time.Second
+    // fetchLinger is how long a fetch that has records waits for the next one
+    fetchLinger = 50 * time.Millisecond
+)
+
+// FetchedRecord is a record returned by a long-poll fetch. Data is what a
+// text websocket subscriber would receive for it.
+type FetchedRecord struct {
+    Partition int               `json:"partition"`
+    Offset    int64             `json:"offset"`
+    Timestamp time.Time         `json:"timestamp"`
+    Data      string            `json:"data"`
+    Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// FetchResponse is the body of GET /stream/{stream_id}/fetch.
+type FetchResponse struct {
+    StreamID string          `json:"stream_id"`
+    Records  []FetchedRecord `json:"records"`
+}
+
+// fetcher is the reader long-poll fetches of a stream share. Fetches take
+// turns, so each returns the records following the previous one's.
+type fetcher struct {
+    mu     sync.Mutex
+    reader CommittingReader
+}
+
+// fetcher returns the stream's fetcher, opening its reader under the stream's
+// fetch consumer group on first use.
+func (sm *StreamManager) fetcher(info *StreamInfo) *fetcher {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    if f, exists := sm.fetchers[info.ID]; exists {
+        return f
+    }
+    f := &fetcher{reader: currentGroupReader()(info, "fetch-"+info.ID)}
+    sm.fetchers[info.ID] = f
+    return f
+}
+
+// fetchOptions reads ?max_records= and ?wait_ms= from a fetch request.
+func fetchOptions(r *http.Request) (int, time.Duration, error) {
+    maxRecords, wait := defaultFetchRecords, defaultFetchWait
+    if value := r.URL.Query().Get("max_records"); value != "" {
+        n, err := strconv.Atoi(value)
+        if err != nil || n <= 0 || n > maxFetchRecords {
+            return 0, 0, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "max_records must be between 1 and "+strconv.Itoa(maxFetchRecords))
+        }
+        maxRecords = n
+    }
+    if value := r.URL.Query().Get("wait_ms"); value != "" {
+        ms, err := strconv.Atoi(value)
+        if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxFetchWait {
+            return 0, 0, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "wait_ms must be between 0 and "+strconv.Itoa(int(maxFetchWait/time.Millisecond)))
+        }
+        wait = time.Duration(ms) * time.Millisecond
+    }
+    return maxRecords, wait, nil
+}
+
+// FetchRecords handles GET /stream/{stream_id}/fetch, a long poll for clients
+// that cannot hold a websocket open. It waits up to wait_ms for a record and
+// returns up to max_records of those available then, filtered and decoded as
+// for websocket subscribers. The stream's fetches share a consumer group, so
+// each record is returned once; its offset is committed with the response.
+func FetchRecords(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    logger := requestLogger(r).WithField("stream_id", streamID)
+    info, ok := requireStream(w, r, streamID, AuditActionStreamFetch)
+    if !ok {
+        return
+    }
+    projection, err := readerSchema(r, info)
+    if err != nil {
+        WriteError(w, r, err)
+        return
+    }
+    maxRecords, wait, err := fetchOptions(r)
+    if err != nil {
+        WriteError(w, r, err)
+        return
+    }
+    filter := parseHeaderFilter(r)
+
+    f := streamManager.fetcher(info)
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    metrics := currentMetrics()
+    label := metrics.streamLabel(streamID)
+    ctx, cancel := context.WithTimeout(r.Context(), wait)
+    defer cancel()
+    var fetched []kafka.Message
+    records := []FetchedRecord{}
+    for len(records) < maxRecords {
+        // Once there are records, only take those that follow right away
+        readCtx, cancelRead := ctx, context.CancelFunc(func() {})
+        if len(fetched) > 0 {
+            readCtx, cancelRead = context.WithTimeout(ctx, fetchLinger)
+        }
+        m, err := f.reader.FetchMessage(readCtx)
+        cancelRead()
+        if r.Context().Err() != nil {
+            // The client left; the records stay uncommitted for the next fetch
+            return
+        }
+        if errors.Is(err, context.DeadlineExceeded) {
+            break
+        }
+        if err != nil {
+            logger.WithField("error", err.Error()).Error("Error fetching messages")
+            if len(fetched) == 0 {
+                Audit(r, AuditActionStreamFetch, streamID, AuditOutcomeFailure, err.Error())
+                WriteError(w, r, kafkaAPIError(err))
+                return
+            }
+            break
+        }
+
+        fetched = append(fetched, m)
+        metrics.kafkaMessagesConsumed.Inc()
+        metrics.kafkaConsumeLatency.WithLabelValues(label).Observe(time.Since(m.Time).Seconds())
+        headers := recordHeaders(m.Headers)
+        if !filter.matches(headers) {
+            continue
+        }
+        record, contentType, err := subscriberRecord(info, projection, &m)
+        if err != nil {
+            logger.WithFields(logrus.Fields{"offset": m.Offset, "error": err.Error()}).Warn("Failed to decode record with its schema")
+        }
+        records = append(records, FetchedRecord{
+            Partition: m.Partition,
+            Offset:    m.Offset,
+            Timestamp: m.Time,
+            Data:      ProcessData(textPayload(record, contentType)),
+            Headers:   headers,
+        })
+    }
+
+    if len(fetched) > 0 {
+        commitCtx, cancelCommit := context.WithTimeout(context.Background(), backgroundAttemptTimeout)
+        if err := f.reader.CommitMessages(commitCtx, fetched...); err != nil {
+            logger.WithField("error", err.Error()).Warn("Failed to commit fetched offsets; records may be fetched again")
+        }
+        cancelCommit()
+        metrics.kafkaConsumerLag.WithLabelValues(label).Set(float64(f.reader.Stats().Lag))
+    }
+    Audit(r, AuditActionStreamFetch, streamID, AuditOutcomeSuccess, strconv.Itoa(len(records))+" records")
+    writeJSON(w, http.StatusOK, FetchResponse{StreamID: streamID, Records: records})
+}
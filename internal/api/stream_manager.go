@@ -4,53 +4,148 @@ import (
     // "context"
     //"log"
     "sync"
+    "time"
+
     "github.com/segmentio/kafka-go"
 )
 
+// StreamManager keeps the registered streams and their Kafka clients.
+// Producers are kept per stream and acknowledgement level.
 type StreamManager struct {
-    producers map[string]*kafka.Writer
-    consumers map[string]*kafka.Reader
-    mu        sync.Mutex
+    producers  map[string]map[string]*kafka.Writer
+    async      map[string]map[string]*asyncProducer
+    consumers  map[string]streamReader
+    fetchers   map[string]*fetcher
+    streams    map[string]*StreamInfo // Streams created via StartStream (or auto-created)
+    autoCreate bool
+    store      StreamStore
+    metrics    *Metrics
+    mu         sync.Mutex
 }
 
-func NewStreamManager() *StreamManager {
+// NewStreamManager creates a stream manager recording into metrics, or into
+// the instance installed with UseMetrics when metrics is nil.
+func NewStreamManager(metrics *Metrics) *StreamManager {
     return &StreamManager{
-        producers: make(map[string]*kafka.Writer),
-        consumers: make(map[string]*kafka.Reader),
+        producers: make(map[string]map[string]*kafka.Writer),
+        async:     make(map[string]map[string]*asyncProducer),
+        consumers: make(map[string]streamReader),
+        fetchers:  make(map[string]*fetcher),
+        streams:   make(map[string]*StreamInfo),
+        store:     NewMemoryStreamStore(),
+        metrics:   metrics,
     }
 }
 
-func (sm *StreamManager) CreateProducer(brokers []string, streamID string) *kafka.Writer {
+// metricsLocked returns the instance the stream manager records into.
+// Callers must hold sm.mu.
+func (sm *StreamManager) metricsLocked() *Metrics {
+    if sm.metrics != nil {
+        return sm.metrics
+    }
+    return currentMetrics()
+}
+
+// CreateProducer returns the stream's producer for the acknowledgement level,
+// creating it on first use. An empty level uses the stream's default.
+func (sm *StreamManager) CreateProducer(brokers []string, streamID, acks string) *kafka.Writer {
     sm.mu.Lock()
     defer sm.mu.Unlock()
 
 	
 		// mostly error handling and extra logging statements
     if streamID == "" {
-        log.Println("Error: Received empty streamID for producer creation")
+        log.Error("Received empty streamID for producer creation")
         return nil
     }
 
-    if producer, exists := sm.producers[streamID]; exists {
-        log.Printf("Returning existing producer for streamID: %s", streamID)
+    acks = sm.acksLocked(streamID, acks)
+    if producer, exists := sm.producers[streamID][acks]; exists {
+        log.WithField("stream_id", streamID).Debug("Returning existing producer")
         return producer
     }
 
 	
 
-    log.Printf("Creating new producer for streamID: %s", streamID)
-    producer := KafkaWriter(brokers, streamID)
+    producer := sm.newWriterLocked(brokers, streamID, acks)
+    if producer == nil {
+        return nil
+    }
+    if sm.producers[streamID] == nil {
+        sm.producers[streamID] = make(map[string]*kafka.Writer)
+        sm.metricsLocked().activeStreams.Inc()
+    }
+    sm.producers[streamID][acks] = producer
+    return producer
+}
+
+// CreateAsyncProducer returns the stream's batching producer for sends that
+// do not wait for Kafka, creating it on first use. An empty acknowledgement
+// level uses the stream's default.
+func (sm *StreamManager) CreateAsyncProducer(brokers []string, streamID, acks string) *asyncProducer {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+
+    acks = sm.acksLocked(streamID, acks)
+    if producer, exists := sm.async[streamID][acks]; exists {
+        return producer
+    }
+    writer := sm.newWriterLocked(brokers, streamID, acks)
+    if writer == nil {
+        return nil
+    }
+    producer := newAsyncProducer(writer, streamID, acks)
+    if sm.async[streamID] == nil {
+        sm.async[streamID] = make(map[string]*asyncProducer)
+    }
+    sm.async[streamID][acks] = producer
+    return producer
+}
+
+// acksLocked resolves an empty acknowledgement level to the stream's default.
+// Callers must hold sm.mu.
+func (sm *StreamManager) acksLocked(streamID, acks string) string {
+    if acks != "" {
+        return acks
+    }
+    if info, exists := sm.streams[streamID]; exists && info.Config != nil {
+        return info.Config.acks()
+    }
+    return AcksAll
+}
+
+// newWriterLocked creates a writer for the stream's topic with the stream's
+// producer settings and the acknowledgement level. Callers must hold sm.mu.
+func (sm *StreamManager) newWriterLocked(brokers []string, streamID, acks string) *kafka.Writer {
+    // Attached topics belong to other services; KafkaWriter would create them
+    if info, exists := sm.streams[streamID]; exists && info.ReadOnly {
+        log.WithField("stream_id", streamID).Error("Refusing to create a producer for a read-only stream")
+        return nil
+    }
+    topic := sm.topicLocked(streamID)
+    log.WithField("stream_id", streamID).WithField("topic", topic).Info("Creating new producer")
+    // Streams started with a spec had their topic created from it; only
+    // auto-created streams and those saved before specs existed need theirs
+    // created here
+    info, exists := sm.streams[streamID]
+    producer := currentWriterFunc()(brokers, topic, !exists || info.Config == nil)
     if producer == nil {
-        log.Printf("Failed to create Kafka producer for streamID: %s", streamID)
+        log.WithField("stream_id", streamID).Error("Failed to create Kafka producer")
         return nil
     }
-    sm.producers[streamID] = producer
+    producer.RequiredAcks = requiredAcks[acks]
+    if info, exists := sm.streams[streamID]; exists && info.Config != nil {
+        producer.Compression = info.Config.producerCompression()
+        if info.Config.WriteTimeoutMs > 0 {
+            producer.WriteTimeout = time.Duration(info.Config.WriteTimeoutMs) * time.Millisecond
+        }
+    }
     return producer
 }
 
 
 // CreateConsumer initializes a new Kafka consumer for a given stream
-func (sm *StreamManager) CreateConsumer(brokers []string, streamID, groupID string) *kafka.Reader {
+func (sm *StreamManager) CreateConsumer(brokers []string, streamID, groupID string) streamReader {
     sm.mu.Lock()
     defer sm.mu.Unlock()
 
@@ -58,7 +153,12 @@ func (sm *StreamManager) CreateConsumer(brokers []string, streamID, groupID stri
         return consumer
     }
 
-    consumer := KafkaReader(brokers, streamID, groupID)
+    var consumer streamReader
+    if info, exists := sm.streams[streamID]; exists {
+        consumer = currentGroupReader()(info, groupID)
+    } else {
+        consumer = KafkaReader(brokers, sm.topicLocked(streamID), groupID)
+    }
     sm.consumers[streamID] = consumer
     return consumer
 }
@@ -68,12 +168,39 @@ func (sm *StreamManager) CloseStream(streamID string) {
     sm.mu.Lock()
     defer sm.mu.Unlock()
 
-    if producer, exists := sm.producers[streamID]; exists {
-        producer.Close()
+    if producers, exists := sm.producers[streamID]; exists {
+        for _, producer := range producers {
+            producer.Close()
+        }
         delete(sm.producers, streamID)
+        sm.metricsLocked().activeStreams.Dec()
+    }
+    for _, producer := range sm.async[streamID] {
+        producer.writer.Close()
     }
+    delete(sm.async, streamID)
     if consumer, exists := sm.consumers[streamID]; exists {
         consumer.Close()
         delete(sm.consumers, streamID)
     }
+    if fetcher, exists := sm.fetchers[streamID]; exists {
+        fetcher.reader.Close()
+        delete(sm.fetchers, streamID)
+    }
+}
+
+// FlushAsyncProducers delivers every queued record and closes the batching
+// producers, so records accepted with 202 are not lost on shutdown.
+func (sm *StreamManager) FlushAsyncProducers() {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+
+    for streamID, producers := range sm.async {
+        for _, producer := range producers {
+            if err := producer.writer.Close(); err != nil {
+                log.WithField("stream_id", streamID).WithField("error", err.Error()).Error("Failed to flush queued records")
+            }
+        }
+        delete(sm.async, streamID)
+    }
 }
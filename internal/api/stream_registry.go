@@ -0,0 +1,276 @@
+// internal/api/stream_registry.go
+package api
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// StreamInfo describes a stream known to the server. Topic is the Kafka topic
+// behind the public stream id; it is empty for streams registered before
+// topic naming existed, whose topic is the id itself. Read-only streams are
+// attached to existing topics and only read from Partitions (all when empty)
+// starting at StartOffset. Streams with a Schema only accept matching records.
+type StreamInfo struct {
+    ID          string        `json:"stream_id"`
+    Topic       string        `json:"topic,omitempty"`
+    Tenant      string        `json:"tenant,omitempty"`
+    Owner       string        `json:"owner"`
+    CreatedAt   time.Time     `json:"created_at"`
+    Config      *StreamSpec   `json:"config,omitempty"`
+    ReadOnly    bool          `json:"read_only,omitempty"`
+    Partitions  []int         `json:"partitions,omitempty"`
+    StartOffset string        `json:"start_offset,omitempty"`
+    Schema      *StreamSchema `json:"schema,omitempty"`
+}
+
+// topicName returns the Kafka topic behind the stream.
+func (info *StreamInfo) topicName() string {
+    if info.Topic != "" {
+        return info.Topic
+    }
+    return info.ID
+}
+
+// tenantName returns the tenant the stream belongs to. Streams registered
+// before tenants were tracked belong to the default tenant.
+func (info *StreamInfo) tenantName() string {
+    if info.Tenant != "" {
+        return info.Tenant
+    }
+    return defaultTenant
+}
+
+// streamIDPattern follows Kafka's topic naming rules, since stream ids end up in topic names.
+var streamIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+var (
+    // ErrInvalidStreamID is returned for stream ids that cannot be used as Kafka topic names.
+    ErrInvalidStreamID = errors.New("stream id must be 1-249 characters of letters, digits, '.', '_' or '-'")
+    // ErrStreamExists is returned when a stream id or its topic is already taken.
+    ErrStreamExists = errors.New("stream already exists")
+    // ErrStreamNotFound is returned when a stream is not registered.
+    ErrStreamNotFound = errors.New("stream does not exist")
+)
+
+// ValidateStreamID checks that id is a legal Kafka topic name.
+func ValidateStreamID(id string) error {
+    if !streamIDPattern.MatchString(id) || id == "." || id == ".." {
+        return ErrInvalidStreamID
+    }
+    return nil
+}
+
+// TopicName maps a stream id to its Kafka topic using STREAM_TOPIC_PREFIX,
+// in which "{tenant}" is replaced by the tenant (e.g. "{tenant}.streams.").
+func TopicName(streamID, tenant string) (string, error) {
+    topic := topicPrefix(tenant) + streamID
+    if err := ValidateStreamID(topic); err != nil {
+        return "", fmt.Errorf("topic name %q for stream %q is not a valid Kafka topic name", topic, streamID)
+    }
+    return topic, nil
+}
+
+// topicPrefix returns the prefix of the tenant's stream topics.
+func topicPrefix(tenant string) string {
+    return strings.ReplaceAll(os.Getenv("STREAM_TOPIC_PREFIX"), "{tenant}", tenant)
+}
+
+// topicOwnedByOtherTenant reports whether topic falls under another tenant's
+// topic prefix. Of the configured and registered tenants whose prefix the
+// topic starts with, the longest prefix wins, so a tenant named "a" does not
+// own the topics of tenant "a.b".
+func (sm *StreamManager) topicOwnedByOtherTenant(topic, tenant string) bool {
+    sm.mu.Lock()
+    tenants := map[string]bool{defaultTenant: true, tenant: true}
+    for _, info := range sm.streams {
+        tenants[info.tenantName()] = true
+    }
+    sm.mu.Unlock()
+    for _, name := range currentTenantMapper().tenantNames() {
+        tenants[name] = true
+    }
+
+    longest, owned := -1, false
+    for name := range tenants {
+        prefix := topicPrefix(name)
+        if prefix == "" || !strings.HasPrefix(topic, prefix) || len(prefix) < longest {
+            continue
+        }
+        if len(prefix) > longest {
+            longest, owned = len(prefix), false
+        }
+        // Prefixes without "{tenant}" are shared by every tenant
+        owned = owned || name == tenant
+    }
+    return longest >= 0 && !owned
+}
+
+// topicCollisionKey folds '.' into '_': Kafka reports metrics for both under
+// the same name, so topics differing only there collide.
+func topicCollisionKey(topic string) string {
+    return strings.ReplaceAll(topic, ".", "_")
+}
+
+// StreamAutoCreateFromEnv reports whether STREAM_AUTO_CREATE allows sends and
+// subscriptions to register unknown streams on first use (default false).
+func StreamAutoCreateFromEnv() bool {
+    autoCreate, _ := strconv.ParseBool(os.Getenv("STREAM_AUTO_CREATE"))
+    return autoCreate
+}
+
+// SetStreamAutoCreate turns auto-creation of unknown streams on or off.
+func SetStreamAutoCreate(enabled bool) {
+    streamManager.mu.Lock()
+    defer streamManager.mu.Unlock()
+    streamManager.autoCreate = enabled
+}
+
+// CheckAvailable returns ErrStreamExists if the stream id or a colliding topic
+// is taken. Stream ids are unique across tenants, but errors name the stream
+// in the way only when it belongs to tenant.
+func (sm *StreamManager) CheckAvailable(streamID, topic, tenant string) error {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    return sm.checkAvailableLocked(streamID, topic, tenant)
+}
+
+func (sm *StreamManager) checkAvailableLocked(streamID, topic, tenant string) error {
+    if _, exists := sm.streams[streamID]; exists {
+        return fmt.Errorf("%w: stream id %s is taken", ErrStreamExists, streamID)
+    }
+    key := topicCollisionKey(topic)
+    for _, info := range sm.streams {
+        if topicCollisionKey(info.topicName()) != key {
+            continue
+        }
+        if info.tenantName() != tenant {
+            return fmt.Errorf("%w: topic %s is taken", ErrStreamExists, topic)
+        }
+        return fmt.Errorf("%w: topic %s collides with stream %s", ErrStreamExists, topic, info.ID)
+    }
+    return nil
+}
+
+// RegisterStream records a new stream and persists it. It fails with
+// ErrStreamExists if the id or topic is already taken.
+func (sm *StreamManager) RegisterStream(info StreamInfo) (*StreamInfo, error) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    return sm.registerLocked(info)
+}
+
+func (sm *StreamManager) registerLocked(info StreamInfo) (*StreamInfo, error) {
+    if err := sm.checkAvailableLocked(info.ID, info.topicName(), info.tenantName()); err != nil {
+        return nil, err
+    }
+    if info.CreatedAt.IsZero() {
+        info.CreatedAt = time.Now().UTC()
+    }
+    if err := sm.store.Put(info); err != nil {
+        return nil, err
+    }
+    sm.streams[info.ID] = &info
+    return &info, nil
+}
+
+// topicLocked returns the Kafka topic for a stream id, which is the id itself
+// for streams the registry does not know.
+func (sm *StreamManager) topicLocked(streamID string) string {
+    if info, exists := sm.streams[streamID]; exists {
+        return info.topicName()
+    }
+    return streamID
+}
+
+// setSchema binds a registered stream to schema and persists it. The entry is
+// replaced rather than modified, since handlers may still hold the old one.
+func (sm *StreamManager) setSchema(streamID string, schema *StreamSchema) (*StreamInfo, error) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    current, exists := sm.streams[streamID]
+    if !exists {
+        return nil, fmt.Errorf("%w: %s", ErrStreamNotFound, streamID)
+    }
+    info := *current
+    info.Schema = schema
+    if err := sm.store.Put(info); err != nil {
+        return nil, err
+    }
+    sm.streams[streamID] = &info
+    return &info, nil
+}
+
+// Stream returns the registered stream with the given id.
+func (sm *StreamManager) Stream(streamID string) (*StreamInfo, bool) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    info, exists := sm.streams[streamID]
+    return info, exists
+}
+
+// tenantStream returns the registered stream with the given id if it belongs
+// to tenant; other tenants' streams are not visible.
+func (sm *StreamManager) tenantStream(streamID, tenant string) (*StreamInfo, bool) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    info, exists := sm.streams[streamID]
+    if !exists || info.tenantName() != tenant {
+        return nil, false
+    }
+    return info, true
+}
+
+// Streams returns every registered stream, oldest first.
+func (sm *StreamManager) Streams() []StreamInfo {
+    return sm.tenantStreams("")
+}
+
+// tenantStreams returns the streams of tenant, or of every tenant when it is
+// empty, oldest first.
+func (sm *StreamManager) tenantStreams(tenant string) []StreamInfo {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    streams := make(map[string]StreamInfo, len(sm.streams))
+    for id, info := range sm.streams {
+        if tenant == "" || info.tenantName() == tenant {
+            streams[id] = *info
+        }
+    }
+    return sortedStreams(streams)
+}
+
+// lookupStream returns the tenant's registered stream, registering it for the
+// requesting tenant and owner first when auto-creation is enabled. A nil info
+// with a nil error means the stream is unknown to the tenant, including
+// streams of other tenants. Ids that make no valid topic and topics that are
+// taken are refused with an APIError.
+func (sm *StreamManager) lookupStream(streamID, tenant, owner string) (*StreamInfo, error) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    if info, exists := sm.streams[streamID]; exists {
+        if info.tenantName() != tenant {
+            return nil, nil
+        }
+        return info, nil
+    }
+    if !sm.autoCreate {
+        return nil, nil
+    }
+    topic, err := TopicName(streamID, tenant)
+    if err != nil {
+        return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+    }
+    log.WithField("stream_id", streamID).WithField("topic", topic).Info("Auto-creating stream on first use")
+    info, err := sm.registerLocked(StreamInfo{ID: streamID, Topic: topic, Tenant: tenant, Owner: owner})
+    if errors.Is(err, ErrStreamExists) {
+        return nil, NewAPIError(http.StatusConflict, ErrCodeStreamExists, err.Error())
+    }
+    return info, err
+}
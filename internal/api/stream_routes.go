@@ -0,0 +1,909 @@
+// internal/api/stream_routes.go
+package api
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Record headers added to routed records: the id of the rule that routed the
+// record and how many rules it has passed through. Records written to a
+// rule's dead-letter stream carry the error and the target that refused them.
+const (
+    RoutedByHeader    = "routed-by"
+    RouteHopsHeader   = "route-hops"
+    RouteErrorHeader  = "route-error"
+    RouteTargetHeader = "route-target"
+)
+
+// Routing limits and defaults, overridable through the environment
+const (
+    maxRouteTargets         = 16
+    maxRouteHops            = 8
+    defaultRouteMaxAttempts = 5
+    defaultRouteBackoffMs   = 500
+)
+
+// RouteMatch is the predicate of a routing rule. Records must have every
+// header value and, when their payload is JSON, every field value; fields are
+// addressed with dot paths such as "error.level". An empty match takes every
+// record.
+type RouteMatch struct {
+    Headers map[string]string      `json:"headers,omitempty"`
+    Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// RouteTransform rewrites a record before it is routed: Select keeps only the
+// listed top-level fields of a JSON object and SetHeaders adds or replaces
+// record headers.
+type RouteTransform struct {
+    Select     []string          `json:"select,omitempty"`
+    SetHeaders map[string]string `json:"set_headers,omitempty"`
+}
+
+// RouteRequest is the body of POST /stream/{stream_id}/routes.
+type RouteRequest struct {
+    Targets    []string        `json:"targets"`
+    Match      RouteMatch      `json:"match"`
+    Transform  *RouteTransform `json:"transform,omitempty"`
+    DeadLetter string          `json:"dead_letter,omitempty"`
+}
+
+// Validate checks the rule's own fields; targets are checked against the
+// registered streams when the rule is created.
+func (q RouteRequest) Validate() error {
+    if len(q.Targets) == 0 || len(q.Targets) > maxRouteTargets {
+        return fmt.Errorf("targets must list between 1 and %d streams", maxRouteTargets)
+    }
+    seen := make(map[string]bool, len(q.Targets))
+    for _, target := range q.Targets {
+        if err := ValidateStreamID(target); err != nil {
+            return fmt.Errorf("invalid target %q: %w", target, err)
+        }
+        if seen[target] {
+            return fmt.Errorf("target %q is listed twice", target)
+        }
+        seen[target] = true
+    }
+    if q.DeadLetter != "" {
+        if err := ValidateStreamID(q.DeadLetter); err != nil {
+            return fmt.Errorf("invalid dead_letter %q: %w", q.DeadLetter, err)
+        }
+        if seen[q.DeadLetter] {
+            return fmt.Errorf("dead_letter %q cannot also be a target", q.DeadLetter)
+        }
+    }
+    for key := range q.Match.Headers {
+        if !headerKeyPattern.MatchString(key) {
+            return fmt.Errorf("invalid match header name %q", key)
+        }
+    }
+    for path := range q.Match.Fields {
+        if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+            return fmt.Errorf("invalid match field path %q", path)
+        }
+    }
+    if q.Transform != nil {
+        for _, field := range q.Transform.Select {
+            if field == "" {
+                return errors.New("transform select fields cannot be empty")
+            }
+        }
+        for key := range q.Transform.SetHeaders {
+            if !headerKeyPattern.MatchString(key) {
+                return fmt.Errorf("invalid transform header name %q", key)
+            }
+            if reservedHeaders[strings.ToLower(key)] {
+                return fmt.Errorf("header %q is set by the server", key)
+            }
+        }
+    }
+    return nil
+}
+
+// RouteRule copies or routes a stream's matching records into other streams.
+// Records a target refuses, or that the transform cannot apply to, go to the
+// DeadLetter stream; without one the rule pauses itself on them. Routed and
+// dead-lettered records count against the ingest quotas of the stream's
+// tenant, and the rule also pauses itself when its daily quota runs out.
+type RouteRule struct {
+    ID         string          `json:"id"`
+    StreamID   string          `json:"stream_id"`
+    Targets    []string        `json:"targets"`
+    Match      RouteMatch      `json:"match"`
+    Transform  *RouteTransform `json:"transform,omitempty"`
+    DeadLetter string          `json:"dead_letter,omitempty"`
+    Paused     bool            `json:"paused"`
+    CreatedAt  time.Time       `json:"created_at"`
+}
+
+// RouteStats counts a rule's records since the server started. Routed counts
+// records written per target; Failed counts records a target refused, and
+// DeadLettered those of them written to the dead-letter stream. Dropped
+// counts records past the hop limit, which routing loops produce. Lag is the number of records on the stream the
+// rule has not consumed yet.
+type RouteStats struct {
+    Matched      int64      `json:"matched"`
+    Skipped      int64      `json:"skipped"`
+    Routed       int64      `json:"routed"`
+    Failed       int64      `json:"failed"`
+    DeadLettered int64      `json:"dead_lettered"`
+    Dropped      int64      `json:"dropped"`
+    Lag          int64      `json:"lag"`
+    LastError    string     `json:"last_error,omitempty"`
+    LastRoutedAt *time.Time `json:"last_routed_at,omitempty"`
+}
+
+// RouteView is a rule with its counters, as returned by the API.
+type RouteView struct {
+    RouteRule
+    Stats RouteStats `json:"stats"`
+}
+
+// fieldValue returns the value at a dot path of a decoded JSON document.
+func fieldValue(document interface{}, path string) (interface{}, bool) {
+    value := document
+    for _, key := range strings.Split(path, ".") {
+        object, ok := value.(map[string]interface{})
+        if !ok {
+            return nil, false
+        }
+        if value, ok = object[key]; !ok {
+            return nil, false
+        }
+    }
+    return value, true
+}
+
+// jsonEqual compares two values by their JSON encoding, so that numbers
+// compare by value whatever their Go type: 5, 5.0 and int64(5) are equal.
+func jsonEqual(a, b interface{}) bool {
+    encodedA, errA := json.Marshal(a)
+    encodedB, errB := json.Marshal(b)
+    return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// Matches reports whether a record passes the predicate. document is the
+// decoded JSON payload, or nil when the payload is not JSON.
+func (m RouteMatch) Matches(headers map[string]string, document interface{}) bool {
+    if !headerFilter(m.Headers).matches(headers) {
+        return false
+    }
+    for path, want := range m.Fields {
+        if got, ok := fieldValue(document, path); !ok || !jsonEqual(got, want) {
+            return false
+        }
+    }
+    return true
+}
+
+// RouteResult is what a rule does with a record.
+type RouteResult int
+
+const (
+    // RouteSkipped records do not match the rule.
+    RouteSkipped RouteResult = iota
+    // RouteMatched records are written to the rule's targets.
+    RouteMatched
+    // RouteDropped records are past the hop limit, which routing loops produce.
+    RouteDropped
+)
+
+// Apply runs the rule on a record of its stream, returning the record to
+// write to the targets when it matches. Records from schema streams are
+// matched and routed as JSON. The error is for matched records the transform
+// cannot apply to.
+func (r RouteRule) Apply(info *StreamInfo, m kafka.Message) (kafka.Message, RouteResult, error) {
+    hops, _ := strconv.Atoi(kafkaHeaderCarrier{headers: &m.Headers}.Get(RouteHopsHeader))
+    if hops >= maxRouteHops {
+        return kafka.Message{}, RouteDropped, nil
+    }
+
+    value, contentType := m.Value, recordContentType(&m)
+    if info.Schema != nil && isFramedRecord(value) {
+        if decoded, err := DecodeRecord(value); err == nil {
+            value, contentType = decoded, ContentTypeJSON
+        }
+    }
+    var document interface{}
+    switch contentType {
+    case ContentTypeBinary, ContentTypeProtobuf, ContentTypeMsgpack:
+    default:
+        if json.Unmarshal(value, &document) != nil {
+            document = nil
+        }
+    }
+    if !r.Match.Matches(recordHeaders(m.Headers), document) {
+        return kafka.Message{}, RouteSkipped, nil
+    }
+
+    value, contentType, err := r.Transform.apply(value, contentType, document)
+    if err != nil {
+        return kafka.Message{}, RouteMatched, err
+    }
+    return kafka.Message{Key: m.Key, Value: value, Headers: r.routedHeaders(m.Headers, contentType, hops)}, RouteMatched, nil
+}
+
+// apply rewrites a matched record's payload; headers are set by routedHeaders.
+// A nil transform leaves the record as it is.
+func (t *RouteTransform) apply(value []byte, contentType string, document interface{}) ([]byte, string, error) {
+    if t == nil || len(t.Select) == 0 {
+        return value, contentType, nil
+    }
+    object, ok := document.(map[string]interface{})
+    if !ok {
+        return nil, "", errors.New("transform select needs a JSON object payload")
+    }
+    selected := make(map[string]interface{}, len(t.Select))
+    for _, field := range t.Select {
+        if v, exists := object[field]; exists {
+            selected[field] = v
+        }
+    }
+    encoded, err := json.Marshal(selected)
+    return encoded, ContentTypeJSON, err
+}
+
+// routedHeaders returns the headers of a routed record: the source record's,
+// with its content type, the transform's headers and the routing headers.
+func (r RouteRule) routedHeaders(source []kafka.Header, contentType string, hops int) []kafka.Header {
+    var set map[string]string
+    if r.Transform != nil {
+        set = r.Transform.SetHeaders
+    }
+    headers := make([]kafka.Header, 0, len(source)+len(set)+3)
+    for _, header := range source {
+        switch header.Key {
+        case ContentTypeHeader, RoutedByHeader, RouteHopsHeader:
+            continue
+        }
+        if _, replaced := set[header.Key]; replaced {
+            continue
+        }
+        headers = append(headers, header)
+    }
+    for _, key := range sortedKeys(set) {
+        headers = append(headers, kafka.Header{Key: key, Value: []byte(set[key])})
+    }
+    if contentType != "" {
+        headers = append(headers, kafka.Header{Key: ContentTypeHeader, Value: []byte(contentType)})
+    }
+    return append(headers,
+        kafka.Header{Key: RoutedByHeader, Value: []byte(r.ID)},
+        kafka.Header{Key: RouteHopsHeader, Value: []byte(strconv.Itoa(hops + 1))},
+    )
+}
+
+// routeWorker runs a rule from its own consumer group.
+type routeWorker struct {
+    rule   RouteRule
+    stall  func()
+    tenant string
+
+    mu     sync.Mutex
+    cancel context.CancelFunc
+    done   chan struct{}
+    reader CommittingReader
+    stats  RouteStats
+}
+
+// start begins consuming the stream in the background.
+func (rw *routeWorker) start(info *StreamInfo) {
+    ctx, cancel := context.WithCancel(context.Background())
+    reader, done := currentGroupReader()(info, "route-"+rw.rule.ID), make(chan struct{})
+    rw.mu.Lock()
+    rw.cancel, rw.done, rw.reader, rw.tenant = cancel, done, reader, info.tenantName()
+    rw.mu.Unlock()
+    go func() {
+        defer close(done)
+        rw.run(ctx, info, reader)
+    }()
+}
+
+// stop ends consumption, letting a write in progress finish. A record not
+// yet written to every target is left uncommitted and routed again when the
+// rule next starts, so targets it already reached may receive it twice.
+func (rw *routeWorker) stop() {
+    rw.mu.Lock()
+    cancel, done, reader := rw.cancel, rw.done, rw.reader
+    rw.cancel = nil
+    rw.mu.Unlock()
+    if cancel == nil {
+        return
+    }
+    cancel()
+    <-done
+    reader.Close()
+}
+
+func (rw *routeWorker) run(ctx context.Context, info *StreamInfo, reader CommittingReader) {
+    logger := log.WithFields(logrus.Fields{"stream_id": rw.rule.StreamID, "route_id": rw.rule.ID})
+    for {
+        m, err := reader.FetchMessage(ctx)
+        if ctx.Err() != nil {
+            return
+        }
+        if err != nil {
+            logger.WithField("error", err.Error()).Warn("Failed to read records for routing rule")
+            rw.recordError(err, 0)
+            if !sleepContext(ctx, retryBackoff("ROUTE_RETRY_BACKOFF_MS", defaultRouteBackoffMs, 1)) {
+                return
+            }
+            continue
+        }
+        if !rw.route(ctx, logger, info, m) {
+            return
+        }
+        commitCtx, cancel := context.WithTimeout(context.Background(), backgroundAttemptTimeout)
+        if err := reader.CommitMessages(commitCtx, m); err != nil {
+            logger.WithField("error", err.Error()).Warn("Failed to commit routing offsets; records may be routed again")
+            rw.recordError(err, 0)
+        }
+        cancel()
+    }
+}
+
+// route applies the rule to one record and writes it to every target,
+// sending it to the dead-letter stream when a target cannot take it. It
+// returns false when the record is left unsettled: the rule was stopped, or
+// stalled on a record it could not route or dead-letter.
+func (rw *routeWorker) route(ctx context.Context, logger *logrus.Entry, info *StreamInfo, m kafka.Message) bool {
+    routed, result, err := rw.rule.Apply(info, m)
+    switch {
+    case result == RouteDropped:
+        rw.mu.Lock()
+        rw.stats.Dropped++
+        rw.mu.Unlock()
+        logger.WithField("offset", m.Offset).Warn("Dropped record past the routing hop limit; check for rules routing in a loop")
+        return true
+    case result == RouteSkipped:
+        rw.mu.Lock()
+        rw.stats.Skipped++
+        rw.mu.Unlock()
+        return true
+    }
+    rw.mu.Lock()
+    rw.stats.Matched++
+    rw.mu.Unlock()
+    if err != nil {
+        return rw.deadLetter(ctx, logger, m, "", err)
+    }
+
+    for _, target := range rw.rule.Targets {
+        if err := rw.write(ctx, target, routed, true); err != nil {
+            if ctx.Err() != nil {
+                return false
+            }
+            // Dead-lettering would be charged to the same quota
+            if isQuotaError(err) {
+                logger.WithFields(logrus.Fields{"tenant": rw.tenant, "error": err.Error()}).Error("Pausing routing rule: its tenant's ingest quota is exceeded")
+                rw.recordError(fmt.Errorf("routing to %s: %w", target, err), 0)
+                rw.stall()
+                return false
+            }
+            logger.WithFields(logrus.Fields{"target": target, "error": err.Error()}).Error("Failed to route record")
+            if !rw.deadLetter(ctx, logger, m, target, err) {
+                return false
+            }
+            continue
+        }
+        now := time.Now()
+        rw.mu.Lock()
+        rw.stats.Routed++
+        rw.stats.LastRoutedAt = &now
+        rw.mu.Unlock()
+    }
+    return true
+}
+
+// deadLetter writes a record a target could not take to the rule's
+// dead-letter stream, as it was read, with the error and target in headers.
+// Without a dead-letter stream, or when writing to it fails, the rule pauses
+// itself and leaves the record to be routed when it is resumed.
+func (rw *routeWorker) deadLetter(ctx context.Context, logger *logrus.Entry, m kafka.Message, target string, cause error) bool {
+    if target != "" {
+        cause = fmt.Errorf("routing to %s: %w", target, cause)
+    }
+    rw.recordError(cause, 1)
+    if rw.rule.DeadLetter == "" {
+        logger.WithField("error", cause.Error()).Error("Pausing routing rule on a record it cannot route")
+        rw.stall()
+        return false
+    }
+
+    headers := make([]kafka.Header, 0, len(m.Headers)+3)
+    for _, header := range m.Headers {
+        switch header.Key {
+        case RouteErrorHeader, RouteTargetHeader, RoutedByHeader:
+            continue
+        }
+        headers = append(headers, header)
+    }
+    headers = append(headers,
+        kafka.Header{Key: RouteErrorHeader, Value: []byte(cause.Error())},
+        kafka.Header{Key: RouteTargetHeader, Value: []byte(target)},
+        kafka.Header{Key: RoutedByHeader, Value: []byte(rw.rule.ID)},
+    )
+    if err := rw.write(ctx, rw.rule.DeadLetter, kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}, false); err != nil {
+        if ctx.Err() != nil {
+            return false
+        }
+        logger.WithField("error", err.Error()).Error("Pausing routing rule: the dead-letter stream cannot take records")
+        rw.recordError(fmt.Errorf("dead-letter stream %s: %w", rw.rule.DeadLetter, err), 0)
+        rw.stall()
+        return false
+    }
+    rw.mu.Lock()
+    rw.stats.DeadLettered++
+    rw.mu.Unlock()
+    return true
+}
+
+// write produces a record to a stream with its producer, retrying with
+// exponential backoff up to ROUTE_MAX_ATTEMPTS; records the stream cannot
+// take are not retried. An attempt in progress is not interrupted by ctx.
+// Schema-bound streams take the record as JSON, validated and framed with
+// their schema, when encode is set. The record is charged to the source
+// stream's tenant like a send, and released if it is not produced.
+func (rw *routeWorker) write(ctx context.Context, target string, message kafka.Message, encode bool) error {
+    info, exists := streamManager.Stream(target)
+    if !exists {
+        return fmt.Errorf("stream %s does not exist", target)
+    }
+    if encode && info.Schema != nil {
+        if recordContentType(&message) != ContentTypeJSON {
+            return fmt.Errorf("stream %s takes JSON records for its schema", target)
+        }
+        framed, err := EncodeRecord(info.Schema.ID, message.Value)
+        if err != nil {
+            return err
+        }
+        message.Value = framed
+    }
+    n := int64(len(message.Value))
+    if err := rw.reserve(ctx, n); err != nil {
+        return err
+    }
+
+    maxAttempts := int(envInt64("ROUTE_MAX_ATTEMPTS", defaultRouteMaxAttempts))
+    for attempt := 1; ; attempt++ {
+        var err error
+        producer := streamManager.CreateProducer(brokerConfig.Brokers, target, "")
+        if producer == nil {
+            err = errors.New("failed to initialize Kafka producer")
+        } else {
+            writeCtx, cancel := context.WithTimeout(context.Background(), backgroundAttemptTimeout)
+            err = producer.WriteMessages(writeCtx, message)
+            cancel()
+        }
+        if err == nil {
+            metrics := currentMetrics()
+            metrics.kafkaMessagesProduced.Inc()
+            metrics.streamBytesIn.WithLabelValues(metrics.streamLabel(target)).Add(float64(len(message.Value)))
+            return nil
+        }
+        if attempt >= maxAttempts || !sleepContext(ctx, retryBackoff("ROUTE_RETRY_BACKOFF_MS", defaultRouteBackoffMs, attempt)) {
+            quotaManager.Release(rw.tenant, n)
+            return err
+        }
+    }
+}
+
+// reserve charges n bytes to the rule's tenant. While the tenant's
+// bytes-per-second quota is exceeded it backs off and tries again; other
+// quota errors are returned for the rule to pause on.
+func (rw *routeWorker) reserve(ctx context.Context, n int64) error {
+    for attempt := 1; ; attempt++ {
+        err := quotaManager.Reserve(rw.tenant, n)
+        if !errors.Is(err, errBytesPerSecondExceeded) {
+            return err
+        }
+        if !sleepContext(ctx, retryBackoff("ROUTE_RETRY_BACKOFF_MS", defaultRouteBackoffMs, attempt)) {
+            return err
+        }
+    }
+}
+
+// recordError keeps the last error and counts the records it failed.
+func (rw *routeWorker) recordError(err error, failed int) {
+    rw.mu.Lock()
+    defer rw.mu.Unlock()
+    rw.stats.Failed += int64(failed)
+    rw.stats.LastError = err.Error()
+}
+
+// view returns the rule with a snapshot of its counters. Callers must hold
+// the manager's lock.
+func (rw *routeWorker) view() RouteView {
+    rw.mu.Lock()
+    defer rw.mu.Unlock()
+    stats := rw.stats
+    if rw.reader != nil && rw.cancel != nil {
+        stats.Lag = rw.reader.Stats().Lag
+    }
+    return RouteView{RouteRule: rw.rule, Stats: stats}
+}
+
+// RouteManager runs the routing rules and persists them to a JSON file when
+// it has a path. lifecycle serializes starting and stopping rules, which is
+// done without holding mu: a rule pausing itself takes mu.
+type RouteManager struct {
+    lifecycle sync.Mutex
+    mu        sync.Mutex
+    path      string
+    workers   map[string]*routeWorker
+}
+
+// NewRouteManager opens the routing rules persisted at path, if any. Rules
+// start once the manager is installed with UseRoutes.
+func NewRouteManager(path string) (*RouteManager, error) {
+    m := &RouteManager{path: path, workers: make(map[string]*routeWorker)}
+    if path == "" {
+        return m, nil
+    }
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return m, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("reading route store: %w", err)
+    }
+    var rules []RouteRule
+    if err := json.Unmarshal(data, &rules); err != nil {
+        return nil, fmt.Errorf("parsing route store %s: %w", path, err)
+    }
+    for _, rule := range rules {
+        m.workers[rule.ID] = m.newWorker(rule)
+    }
+    return m, nil
+}
+
+func (m *RouteManager) newWorker(rule RouteRule) *routeWorker {
+    worker := &routeWorker{rule: rule}
+    worker.stall = func() { m.stalled(worker) }
+    return worker
+}
+
+// stalled pauses a rule from its own worker. The worker's reader is closed
+// when the rule is next stopped or resumed.
+func (m *RouteManager) stalled(worker *routeWorker) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    worker.rule.Paused = true
+    if err := m.persistLocked(); err != nil {
+        log.WithFields(logrus.Fields{"route_id": worker.rule.ID, "error": err.Error()}).Error("Failed to save paused routing rule")
+    }
+}
+
+// RouteManagerFromEnv opens the routing rules persisted at ROUTE_STORE_PATH,
+// or keeps them in memory when it is unset.
+func RouteManagerFromEnv() (*RouteManager, error) {
+    return NewRouteManager(os.Getenv("ROUTE_STORE_PATH"))
+}
+
+var (
+    routes   = &RouteManager{workers: make(map[string]*routeWorker)}
+    routesMu sync.Mutex
+)
+
+// UseRoutes stops the current routing rules and starts the unpaused rules of
+// m. Rules of streams that no longer exist stay registered but idle.
+func UseRoutes(m *RouteManager) {
+    routesMu.Lock()
+    previous := routes
+    routes = m
+    routesMu.Unlock()
+    previous.Close()
+
+    m.lifecycle.Lock()
+    defer m.lifecycle.Unlock()
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, worker := range m.workers {
+        if worker.rule.Paused {
+            continue
+        }
+        info, exists := streamManager.Stream(worker.rule.StreamID)
+        if !exists {
+            log.WithFields(logrus.Fields{"stream_id": worker.rule.StreamID, "route_id": worker.rule.ID}).Warn("Routing rule stream does not exist; not routing")
+            continue
+        }
+        worker.start(info)
+    }
+}
+
+func currentRoutes() *RouteManager {
+    routesMu.Lock()
+    defer routesMu.Unlock()
+    return routes
+}
+
+// Close stops every rule, letting writes in progress finish.
+func (m *RouteManager) Close() {
+    m.lifecycle.Lock()
+    defer m.lifecycle.Unlock()
+    m.mu.Lock()
+    workers := make([]*routeWorker, 0, len(m.workers))
+    for _, worker := range m.workers {
+        workers = append(workers, worker)
+    }
+    m.mu.Unlock()
+    for _, worker := range workers {
+        worker.stop()
+    }
+}
+
+// add registers and starts a rule.
+func (m *RouteManager) add(info *StreamInfo, rule RouteRule) error {
+    m.lifecycle.Lock()
+    defer m.lifecycle.Unlock()
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    worker := m.newWorker(rule)
+    m.workers[rule.ID] = worker
+    if err := m.persistLocked(); err != nil {
+        delete(m.workers, rule.ID)
+        return err
+    }
+    worker.start(info)
+    return nil
+}
+
+// remove stops and deletes a stream's rule, reporting whether it existed.
+func (m *RouteManager) remove(streamID, id string) (bool, error) {
+    m.lifecycle.Lock()
+    defer m.lifecycle.Unlock()
+    m.mu.Lock()
+    worker, exists := m.workers[id]
+    if !exists || worker.rule.StreamID != streamID {
+        m.mu.Unlock()
+        return false, nil
+    }
+    delete(m.workers, id)
+    err := m.persistLocked()
+    m.mu.Unlock()
+    worker.stop()
+    return true, err
+}
+
+// setPaused pauses or resumes a stream's rule, returning it, or nil when the
+// rule does not exist. A resumed rule routes the records sent while it was
+// paused, starting with any record it paused itself on.
+func (m *RouteManager) setPaused(info *StreamInfo, id string, paused bool) (*RouteView, error) {
+    m.lifecycle.Lock()
+    defer m.lifecycle.Unlock()
+    m.mu.Lock()
+    worker, exists := m.workers[id]
+    if !exists || worker.rule.StreamID != info.ID {
+        m.mu.Unlock()
+        return nil, nil
+    }
+    changed := worker.rule.Paused != paused
+    worker.rule.Paused = paused
+    if err := m.persistLocked(); err != nil {
+        worker.rule.Paused = !paused
+        m.mu.Unlock()
+        return nil, err
+    }
+    m.mu.Unlock()
+
+    if paused {
+        worker.stop()
+    } else if changed {
+        worker.stop()
+        worker.start(info)
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    view := worker.view()
+    return &view, nil
+}
+
+// get returns a stream's rule with its counters.
+func (m *RouteManager) get(streamID, id string) (RouteView, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    worker, exists := m.workers[id]
+    if !exists || worker.rule.StreamID != streamID {
+        return RouteView{}, false
+    }
+    return worker.view(), true
+}
+
+// list returns a stream's rules, oldest first.
+func (m *RouteManager) list(streamID string) []RouteView {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    views := []RouteView{}
+    for _, worker := range m.workers {
+        if worker.rule.StreamID == streamID {
+            views = append(views, worker.view())
+        }
+    }
+    sort.Slice(views, func(i, j int) bool { return views[i].CreatedAt.Before(views[j].CreatedAt) })
+    return views
+}
+
+func (m *RouteManager) persistLocked() error {
+    if m.path == "" {
+        return nil
+    }
+    rules := make([]RouteRule, 0, len(m.workers))
+    for _, id := range sortedKeys(m.workers) {
+        rules = append(rules, m.workers[id].rule)
+    }
+    data, err := json.MarshalIndent(rules, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(m.path, data)
+}
+
+// checkRouteTargets checks that a rule's targets and dead-letter stream are
+// registered streams of the source's tenant that take records. Records are
+// dead-lettered as they were read, so the dead-letter stream has no schema.
+func checkRouteTargets(source *StreamInfo, targets []string, deadLetter string) error {
+    if deadLetter != "" {
+        if err := checkRouteTargets(source, []string{deadLetter}, ""); err != nil {
+            return err
+        }
+        if info, _ := streamManager.Stream(deadLetter); info.Schema != nil {
+            return fmt.Errorf("dead-letter stream %s cannot have a schema", deadLetter)
+        }
+    }
+    for _, target := range targets {
+        if target == source.ID {
+            return fmt.Errorf("stream %s cannot route to itself", target)
+        }
+        info, exists := streamManager.Stream(target)
+        if !exists || info.tenantName() != source.tenantName() {
+            return fmt.Errorf("target stream %s does not exist", target)
+        }
+        if info.ReadOnly {
+            return fmt.Errorf("target stream %s is read-only", target)
+        }
+    }
+    return nil
+}
+
+// CreateRoute handles POST /stream/{stream_id}/routes.
+func CreateRoute(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    info, ok := requireStream(w, r, streamID, AuditActionRouteCreate)
+    if !ok {
+        return
+    }
+    var request RouteRequest
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&request); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid routing rule: "+err.Error())
+        return
+    }
+    if err := request.Validate(); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+    if err := checkRouteTargets(info, request.Targets, request.DeadLetter); err != nil {
+        Audit(r, AuditActionRouteCreate, streamID, AuditOutcomeRejected, err.Error())
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+
+    rule := RouteRule{
+        ID:         uuid.New().String(),
+        StreamID:   streamID,
+        Targets:    request.Targets,
+        Match:      request.Match,
+        Transform:  request.Transform,
+        DeadLetter: request.DeadLetter,
+        CreatedAt:  time.Now().UTC(),
+    }
+    if err := currentRoutes().add(info, rule); err != nil {
+        Audit(r, AuditActionRouteCreate, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, err)
+        return
+    }
+    Audit(r, AuditActionRouteCreate, streamID, AuditOutcomeSuccess, rule.ID)
+    writeJSON(w, http.StatusCreated, RouteView{RouteRule: rule})
+}
+
+// ListRoutes handles GET /stream/{stream_id}/routes.
+func ListRoutes(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    if _, ok := requireStream(w, r, streamID, AuditActionStreamSubscribe); !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"routes": currentRoutes().list(streamID)})
+}
+
+// routeNotFound writes the response for an unknown rule id.
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+    writeError(w, r, http.StatusNotFound, ErrCodeRouteNotFound, "Routing rule "+mux.Vars(r)["route_id"]+" does not exist")
+}
+
+// GetRoute handles GET /stream/{stream_id}/routes/{route_id}, reporting the
+// rule's counters and lag.
+func GetRoute(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    if _, ok := requireStream(w, r, vars["stream_id"], AuditActionStreamSubscribe); !ok {
+        return
+    }
+    view, exists := currentRoutes().get(vars["stream_id"], vars["route_id"])
+    if !exists {
+        routeNotFound(w, r)
+        return
+    }
+    writeJSON(w, http.StatusOK, view)
+}
+
+// PauseRoute handles POST /stream/{stream_id}/routes/{route_id}/pause.
+func PauseRoute(w http.ResponseWriter, r *http.Request) {
+    setRoutePaused(w, r, true)
+}
+
+// ResumeRoute handles POST /stream/{stream_id}/routes/{route_id}/resume.
+func ResumeRoute(w http.ResponseWriter, r *http.Request) {
+    setRoutePaused(w, r, false)
+}
+
+func setRoutePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+    vars := mux.Vars(r)
+    streamID := vars["stream_id"]
+    action := AuditActionRouteResume
+    if paused {
+        action = AuditActionRoutePause
+    }
+    info, ok := requireStream(w, r, streamID, action)
+    if !ok {
+        return
+    }
+    view, err := currentRoutes().setPaused(info, vars["route_id"], paused)
+    if err != nil {
+        Audit(r, action, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, err)
+        return
+    }
+    if view == nil {
+        routeNotFound(w, r)
+        return
+    }
+    Audit(r, action, streamID, AuditOutcomeSuccess, vars["route_id"])
+    writeJSON(w, http.StatusOK, view)
+}
+
+// DeleteRoute handles DELETE /stream/{stream_id}/routes/{route_id}.
+func DeleteRoute(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    streamID := vars["stream_id"]
+    if _, ok := requireStream(w, r, streamID, AuditActionRouteDelete); !ok {
+        return
+    }
+    removed, err := currentRoutes().remove(streamID, vars["route_id"])
+    if err != nil {
+        Audit(r, AuditActionRouteDelete, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, err)
+        return
+    }
+    if !removed {
+        routeNotFound(w, r)
+        return
+    }
+    Audit(r, AuditActionRouteDelete, streamID, AuditOutcomeSuccess, vars["route_id"])
+    w.WriteHeader(http.StatusNoContent)
+}
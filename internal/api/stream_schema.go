@@ -0,0 +1,312 @@
+// internal/api/stream_schema.go
+package api
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+)
+
+// StreamSchema is the schema a stream is bound to. Records sent to the stream
+// are validated against schema ID and framed with it; new versions must pass
+// the Compatibility check against it.
+type StreamSchema struct {
+    Subject       string `json:"subject"`
+    ID            int    `json:"id"`
+    Version       int    `json:"version"`
+    Type          string `json:"type"`
+    Compatibility string `json:"compatibility,omitempty"`
+}
+
+// compatibility returns the stream's mode, defaulting for streams bound
+// before modes existed.
+func (s *StreamSchema) compatibility() string {
+    if s.Compatibility == "" {
+        return defaultCompatibility
+    }
+    return s.Compatibility
+}
+
+// SchemaBinding is the "schema" member of stream creation requests and the
+// body of POST /stream/{stream_id}/schema. With a schema definition it is
+// registered under the subject first; without one the subject's latest
+// version is used. Subject defaults to "<topic>-value" and Compatibility to
+// BACKWARD.
+type SchemaBinding struct {
+    Subject       string `json:"subject,omitempty"`
+    Type          string `json:"schema_type,omitempty"`
+    Definition    string `json:"schema,omitempty"`
+    Compatibility string `json:"compatibility,omitempty"`
+}
+
+// bindSchema resolves a binding for the stream of tenant with the given topic.
+// A new definition must be compatible with the subject's latest version under
+// the binding's compatibility mode before it is registered.
+func bindSchema(topic, tenant string, binding SchemaBinding) (*StreamSchema, error) {
+    compatibility, err := normalizeCompatibility(binding.Compatibility)
+    if err != nil {
+        return nil, err
+    }
+    subject := binding.Subject
+    if subject == "" {
+        subject = topic + "-value"
+    }
+    if !subjectAllowed(subject, topic, tenant) {
+        return nil, NewAPIError(http.StatusForbidden, ErrCodeForbidden, "Subject "+subject+" is not named after topic "+topic+" or under the tenant's topic prefix")
+    }
+
+    var schema Schema
+    if binding.Definition != "" {
+        candidate := Schema{Type: binding.Type, Definition: binding.Definition}
+        latest, err := currentSchemaStore().Latest(subject)
+        if err != nil && !errors.Is(err, ErrSchemaNotFound) {
+            return nil, err
+        }
+        if err == nil {
+            if err := checkCompatible(compatibility, subject, latest.Version, latest, candidate); err != nil {
+                return nil, err
+            }
+        }
+        schema, err = currentSchemaStore().Register(subject, candidate)
+    } else {
+        schema, err = currentSchemaStore().Latest(subject)
+    }
+    if err != nil {
+        return nil, err
+    }
+    // Compile it now so an unusable registry schema fails the binding, not every send
+    if _, err := codecForID(schema.ID); err != nil {
+        return nil, err
+    }
+    return &StreamSchema{Subject: subject, ID: schema.ID, Version: schema.Version, Type: schema.schemaType(), Compatibility: compatibility}, nil
+}
+
+// subjectAllowed reports whether a stream of tenant with the given topic may
+// bind to subject: the topic's own "<topic>-value" and "<topic>-key" subjects,
+// or, when STREAM_TOPIC_PREFIX names the tenant, subjects under the tenant's
+// prefix. Other subjects belong to other tenants' or services' topics.
+func subjectAllowed(subject, topic, tenant string) bool {
+    if subject == topic+"-value" || subject == topic+"-key" {
+        return true
+    }
+    if !strings.Contains(os.Getenv("STREAM_TOPIC_PREFIX"), "{tenant}") {
+        return false
+    }
+    return strings.HasPrefix(subject, topicPrefix(tenant)) && !streamManager.topicOwnedByOtherTenant(subject, tenant)
+}
+
+// checkCompatible returns a schema_incompatible error when candidate cannot
+// replace previous, the given version of subject, under mode.
+func checkCompatible(mode, subject string, version int, previous, candidate Schema) error {
+    if candidate.Type == "" {
+        candidate.Type = previous.schemaType()
+    }
+    issues, err := CheckCompatibility(mode, previous, candidate)
+    if err != nil {
+        return err
+    }
+    if len(issues) > 0 {
+        return &APIError{
+            Status: http.StatusConflict,
+            Code:   ErrCodeSchemaIncompatible,
+            Detail: "Schema is not " + mode + " compatible with version " + strconv.Itoa(version) + " of subject " + subject,
+            Errors: issues,
+        }
+    }
+    return nil
+}
+
+// schemaAPIError maps schema store and validation errors to client-facing errors.
+func schemaAPIError(err error) *APIError {
+    var apiErr *APIError
+    switch {
+    case errors.As(err, &apiErr):
+        return apiErr
+    case errors.Is(err, ErrSchemaMismatch):
+        return &APIError{Status: http.StatusUnprocessableEntity, Code: ErrCodeSchemaMismatch, Detail: err.Error()}
+    case errors.Is(err, ErrInvalidSchema):
+        return &APIError{Status: http.StatusBadRequest, Code: ErrCodeSchemaInvalid, Detail: err.Error()}
+    case errors.Is(err, ErrSchemaNotFound):
+        return &APIError{Status: http.StatusNotFound, Code: ErrCodeSchemaNotFound, Detail: err.Error()}
+    }
+    return &APIError{Status: http.StatusBadGateway, Code: ErrCodeSchemaRegistryError, Detail: "Schema registry request failed", Err: err}
+}
+
+// RegisterStreamSchema handles POST /stream/{stream_id}/schema. It binds a
+// stream without a schema, or registers a new version of the stream's schema
+// after checking it against the current one under the stream's compatibility
+// mode. A body with only a compatibility mode changes the mode.
+func RegisterStreamSchema(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    info, ok := requireStream(w, r, streamID, AuditActionStreamSchema)
+    if !ok {
+        return
+    }
+    if quotaManager.MaxBodyBytes > 0 {
+        r.Body = http.MaxBytesReader(w, r.Body, quotaManager.MaxBodyBytes)
+    }
+    var binding SchemaBinding
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&binding); err != nil {
+        var maxBytesErr *http.MaxBytesError
+        if errors.As(err, &maxBytesErr) {
+            Audit(r, AuditActionStreamSchema, streamID, AuditOutcomeRejected, "request body too large")
+            writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body too large")
+            return
+        }
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid schema request: "+err.Error())
+        return
+    }
+
+    schema, err := evolveSchema(info, binding)
+    if err != nil {
+        Audit(r, AuditActionStreamSchema, streamID, AuditOutcomeRejected, err.Error())
+        WriteError(w, r, err)
+        return
+    }
+    if info, err = streamManager.setSchema(streamID, schema); err != nil {
+        Audit(r, AuditActionStreamSchema, streamID, AuditOutcomeFailure, err.Error())
+        if errors.Is(err, ErrStreamNotFound) {
+            // The stream was deleted while its schema was being registered
+            writeError(w, r, http.StatusNotFound, ErrCodeStreamNotFound, "Stream "+streamID+" does not exist")
+            return
+        }
+        WriteError(w, r, err)
+        return
+    }
+    Audit(r, AuditActionStreamSchema, streamID, AuditOutcomeSuccess, "")
+    writeJSON(w, http.StatusOK, info.Schema)
+}
+
+// evolveSchema returns the stream's binding after applying the request,
+// registering the new version when it is compatible.
+func evolveSchema(info *StreamInfo, binding SchemaBinding) (*StreamSchema, error) {
+    if info.Schema == nil {
+        if binding.Definition == "" && binding.Subject == "" {
+            return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "A schema or subject is required to bind a stream")
+        }
+        schema, err := bindSchema(info.topicName(), info.tenantName(), binding)
+        if err != nil {
+            return nil, schemaAPIError(err)
+        }
+        return schema, nil
+    }
+
+    current := *info.Schema
+    current.Compatibility = current.compatibility()
+    if binding.Subject != "" && binding.Subject != current.Subject {
+        return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "Stream is bound to subject "+current.Subject)
+    }
+    if binding.Compatibility != "" {
+        compatibility, err := normalizeCompatibility(binding.Compatibility)
+        if err != nil {
+            return nil, schemaAPIError(err)
+        }
+        current.Compatibility = compatibility
+    }
+    if binding.Definition == "" {
+        if binding.Compatibility == "" {
+            return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "A schema or compatibility mode is required")
+        }
+        return &current, nil
+    }
+
+    previous, err := currentSchemaStore().ByID(current.ID)
+    if err != nil {
+        return nil, schemaAPIError(err)
+    }
+    candidate := Schema{Type: binding.Type, Definition: binding.Definition}
+    if candidate.Type == "" {
+        candidate.Type = current.Type
+    }
+    if err := checkCompatible(current.Compatibility, current.Subject, current.Version, previous, candidate); err != nil {
+        return nil, schemaAPIError(err)
+    }
+
+    registered, err := currentSchemaStore().Register(current.Subject, candidate)
+    if err != nil {
+        return nil, schemaAPIError(err)
+    }
+    current.ID, current.Version, current.Type = registered.ID, registered.Version, registered.schemaType()
+    return &current, nil
+}
+
+// GetStreamSchemas handles GET /stream/{stream_id}/schema, listing every
+// version of the stream's subject with the one records are written with.
+func GetStreamSchemas(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    info, ok := requireStream(w, r, streamID, AuditActionStreamSchema)
+    if !ok {
+        return
+    }
+    if info.Schema == nil {
+        writeError(w, r, http.StatusNotFound, ErrCodeSchemaNotFound, "Stream "+streamID+" has no schema")
+        return
+    }
+
+    store := currentSchemaStore()
+    numbers, err := store.Versions(info.Schema.Subject)
+    if err != nil {
+        WriteError(w, r, schemaAPIError(err))
+        return
+    }
+    versions := make([]Schema, 0, len(numbers))
+    for _, number := range numbers {
+        schema, err := store.Version(info.Schema.Subject, number)
+        if err != nil {
+            WriteError(w, r, schemaAPIError(err))
+            return
+        }
+        versions = append(versions, schema)
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"current": info.Schema, "versions": versions})
+}
+
+// readerSchema returns the schema version a subscriber asked records to be
+// projected to with ?schema_version=, or nil when it did not ask.
+func readerSchema(r *http.Request, info *StreamInfo) (*Schema, error) {
+    requested := r.URL.Query().Get("schema_version")
+    if requested == "" {
+        return nil, nil
+    }
+    if info.Schema == nil {
+        return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "Stream "+info.ID+" has no schema to project to")
+    }
+    version, err := strconv.Atoi(requested)
+    if err != nil || version <= 0 {
+        return nil, NewAPIError(http.StatusBadRequest, ErrCodeInvalidRequest, "schema_version must be a positive version number")
+    }
+    schema, err := currentSchemaStore().Version(info.Schema.Subject, version)
+    if err != nil {
+        return nil, schemaAPIError(err)
+    }
+    return &schema, nil
+}
+
+// subscriberRecord returns a record's value as text subscribers see it:
+// schema-encoded records are decoded to JSON, in the shape of projection when
+// it is set. Records that fail to decode are returned as stored with the error.
+func subscriberRecord(info *StreamInfo, projection *Schema, m *kafka.Message) ([]byte, string, error) {
+    record, contentType := m.Value, recordContentType(m)
+    if info.Schema == nil || !isFramedRecord(record) {
+        return record, contentType, nil
+    }
+    var decoded []byte
+    var err error
+    if projection != nil {
+        decoded, err = ProjectRecord(record, *projection)
+    } else {
+        decoded, err = DecodeRecord(record)
+    }
+    if err != nil {
+        return record, contentType, err
+    }
+    return decoded, ContentTypeJSON, nil
+}
@@ -0,0 +1,203 @@
+// internal/api/stream_store.go
+package api
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// StreamStore persists stream metadata so the registry survives restarts.
+type StreamStore interface {
+    Put(info StreamInfo) error
+    Delete(streamID string) error
+    List() ([]StreamInfo, error)
+}
+
+// MemoryStreamStore keeps stream metadata in process memory only.
+type MemoryStreamStore struct {
+    mu      sync.Mutex
+    streams map[string]StreamInfo
+}
+
+// NewMemoryStreamStore creates an empty in-memory store.
+func NewMemoryStreamStore() *MemoryStreamStore {
+    return &MemoryStreamStore{streams: make(map[string]StreamInfo)}
+}
+
+func (s *MemoryStreamStore) Put(info StreamInfo) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.streams[info.ID] = info
+    return nil
+}
+
+func (s *MemoryStreamStore) Delete(streamID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.streams, streamID)
+    return nil
+}
+
+func (s *MemoryStreamStore) List() ([]StreamInfo, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return sortedStreams(s.streams), nil
+}
+
+// FileStreamStore keeps stream metadata in a JSON file that is rewritten
+// atomically (write to a temp file, fsync, rename) on every change.
+type FileStreamStore struct {
+    mu      sync.Mutex
+    path    string
+    streams map[string]StreamInfo
+}
+
+// NewFileStreamStore opens the store at path, loading any streams already in it.
+func NewFileStreamStore(path string) (*FileStreamStore, error) {
+    s := &FileStreamStore{path: path, streams: make(map[string]StreamInfo)}
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return s, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("reading stream store: %w", err)
+    }
+    var streams []StreamInfo
+    if err := json.Unmarshal(data, &streams); err != nil {
+        return nil, fmt.Errorf("parsing stream store %s: %w", path, err)
+    }
+    for _, info := range streams {
+        s.streams[info.ID] = info
+    }
+    return s, nil
+}
+
+func (s *FileStreamStore) Put(info StreamInfo) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    previous, existed := s.streams[info.ID]
+    s.streams[info.ID] = info
+    if err := s.flushLocked(); err != nil {
+        if existed {
+            s.streams[info.ID] = previous
+        } else {
+            delete(s.streams, info.ID)
+        }
+        return err
+    }
+    return nil
+}
+
+func (s *FileStreamStore) Delete(streamID string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    previous, existed := s.streams[streamID]
+    if !existed {
+        return nil
+    }
+    delete(s.streams, streamID)
+    if err := s.flushLocked(); err != nil {
+        s.streams[streamID] = previous
+        return err
+    }
+    return nil
+}
+
+func (s *FileStreamStore) List() ([]StreamInfo, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return sortedStreams(s.streams), nil
+}
+
+func (s *FileStreamStore) flushLocked() error {
+    data, err := json.MarshalIndent(sortedStreams(s.streams), "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := writeFileAtomic(s.path, data); err != nil {
+        return fmt.Errorf("writing stream store: %w", err)
+    }
+    return nil
+}
+
+// writeFileAtomic replaces the file at path with data by writing a temp file
+// next to it, syncing it and renaming it into place.
+func writeFileAtomic(path string, data []byte) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Sync(); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// sortedStreams returns the streams ordered by creation time, then id.
+func sortedStreams(streams map[string]StreamInfo) []StreamInfo {
+    list := make([]StreamInfo, 0, len(streams))
+    for _, info := range streams {
+        list = append(list, info)
+    }
+    sort.Slice(list, func(i, j int) bool {
+        if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+            return list[i].CreatedAt.Before(list[j].CreatedAt)
+        }
+        return list[i].ID < list[j].ID
+    })
+    return list
+}
+
+// StreamStoreFromEnv builds the store selected by STREAM_STORE: "memory" (the
+// default) or "file", which persists to STREAM_STORE_PATH (default streams.json).
+func StreamStoreFromEnv() (StreamStore, error) {
+    switch strings.ToLower(os.Getenv("STREAM_STORE")) {
+    case "", "memory":
+        return NewMemoryStreamStore(), nil
+    case "file":
+        path := os.Getenv("STREAM_STORE_PATH")
+        if path == "" {
+            path = "streams.json"
+        }
+        return NewFileStreamStore(path)
+    default:
+        return nil, fmt.Errorf("unknown STREAM_STORE %q", os.Getenv("STREAM_STORE"))
+    }
+}
+
+// UseStreamStore makes the stream manager persist to store and loads the
+// streams it already holds. Producers for them are created lazily on first send.
+func UseStreamStore(store StreamStore) error {
+    streams, err := store.List()
+    if err != nil {
+        return fmt.Errorf("loading streams: %w", err)
+    }
+
+    streamManager.mu.Lock()
+    defer streamManager.mu.Unlock()
+    streamManager.store = store
+    streamManager.streams = make(map[string]*StreamInfo, len(streams))
+    for streamID, fetcher := range streamManager.fetchers {
+        fetcher.reader.Close()
+        delete(streamManager.fetchers, streamID)
+    }
+    for i := range streams {
+        streamManager.streams[streams[i].ID] = &streams[i]
+    }
+    log.WithField("streams", len(streams)).Info("Loaded stream registry")
+    return nil
+}
@@ -0,0 +1,238 @@
+// internal/api/tls.go
+package api
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// CertReloader serves the certificate in certFile/keyFile and picks up
+// replacements on disk without restarting the listener.
+type CertReloader struct {
+    certFile string
+    keyFile  string
+
+    mu      sync.RWMutex
+    cert    *tls.Certificate
+    modTime time.Time
+}
+
+// NewCertReloader loads the initial key pair.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+    cr := &CertReloader{certFile: certFile, keyFile: keyFile}
+    if err := cr.Reload(); err != nil {
+        return nil, err
+    }
+    return cr, nil
+}
+
+// latestModTime returns the newer modification time of the two files.
+func (cr *CertReloader) latestModTime() (time.Time, error) {
+    var latest time.Time
+    for _, path := range []string{cr.certFile, cr.keyFile} {
+        info, err := os.Stat(path)
+        if err != nil {
+            return time.Time{}, err
+        }
+        if info.ModTime().After(latest) {
+            latest = info.ModTime()
+        }
+    }
+    return latest, nil
+}
+
+// Reload reads the key pair from disk. On failure the previous certificate stays in use.
+func (cr *CertReloader) Reload() error {
+    modTime, err := cr.latestModTime()
+    if err != nil {
+        return err
+    }
+    cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+    if err != nil {
+        return fmt.Errorf("loading TLS key pair: %w", err)
+    }
+
+    cr.mu.Lock()
+    cr.cert = &cert
+    cr.modTime = modTime
+    cr.mu.Unlock()
+    return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    cr.mu.RLock()
+    defer cr.mu.RUnlock()
+    return cr.cert, nil
+}
+
+// Watch polls the certificate files every interval and reloads them when they
+// change, until ctx is cancelled.
+func (cr *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            modTime, err := cr.latestModTime()
+            if err != nil {
+                log.WithField("error", err.Error()).Warn("Failed to stat TLS certificate files")
+                continue
+            }
+            cr.mu.RLock()
+            changed := modTime.After(cr.modTime)
+            cr.mu.RUnlock()
+            if !changed {
+                continue
+            }
+            if err := cr.Reload(); err != nil {
+                log.WithField("error", err.Error()).Error("Failed to reload TLS certificate; keeping previous one")
+                continue
+            }
+            log.WithField("cert_file", cr.certFile).Info("Reloaded TLS certificate")
+        }
+    }
+}
+
+// parseTLSVersion maps "1.0" ... "1.3" to the crypto/tls constants.
+func parseTLSVersion(version string) (uint16, error) {
+    switch version {
+    case "", "1.2":
+        return tls.VersionTLS12, nil
+    case "1.3":
+        return tls.VersionTLS13, nil
+    case "1.1":
+        return tls.VersionTLS11, nil
+    case "1.0":
+        return tls.VersionTLS10, nil
+    default:
+        return 0, fmt.Errorf("unsupported TLS version %q", version)
+    }
+}
+
+// parseCipherSuites maps a comma-separated list of IANA suite names to IDs.
+func parseCipherSuites(names string) ([]uint16, error) {
+    if names == "" {
+        return nil, nil
+    }
+    known := make(map[string]uint16)
+    for _, suite := range tls.CipherSuites() {
+        known[suite.Name] = suite.ID
+    }
+
+    var ids []uint16
+    for _, name := range strings.Split(names, ",") {
+        name = strings.TrimSpace(name)
+        id, ok := known[name]
+        if !ok {
+            return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+        }
+        ids = append(ids, id)
+    }
+    return ids, nil
+}
+
+// TLSConfigFromEnv builds the listener TLS configuration from TLS_CERT_FILE,
+// TLS_KEY_FILE, TLS_MIN_VERSION, TLS_CIPHER_SUITES, TLS_CLIENT_CA_FILE and
+// TLS_CLIENT_AUTH ("require", the default with a CA bundle, or "optional").
+// It returns a nil config when TLS_CERT_FILE is unset.
+func TLSConfigFromEnv() (*tls.Config, *CertReloader, error) {
+    certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+    if certFile == "" {
+        return nil, nil, nil
+    }
+    if keyFile == "" {
+        return nil, nil, fmt.Errorf("TLS_KEY_FILE is required with TLS_CERT_FILE")
+    }
+
+    reloader, err := NewCertReloader(certFile, keyFile)
+    if err != nil {
+        return nil, nil, err
+    }
+    minVersion, err := parseTLSVersion(os.Getenv("TLS_MIN_VERSION"))
+    if err != nil {
+        return nil, nil, err
+    }
+    cipherSuites, err := parseCipherSuites(os.Getenv("TLS_CIPHER_SUITES"))
+    if err != nil {
+        return nil, nil, err
+    }
+
+    config := &tls.Config{
+        GetCertificate: reloader.GetCertificate,
+        MinVersion:     minVersion,
+        CipherSuites:   cipherSuites,
+    }
+
+    if caFile := os.Getenv("TLS_CLIENT_CA_FILE"); caFile != "" {
+        caPEM, err := os.ReadFile(caFile)
+        if err != nil {
+            return nil, nil, fmt.Errorf("reading client CA bundle: %w", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(caPEM) {
+            return nil, nil, fmt.Errorf("no certificates found in client CA bundle %s", caFile)
+        }
+        config.ClientCAs = pool
+
+        switch os.Getenv("TLS_CLIENT_AUTH") {
+        case "", "require":
+            config.ClientAuth = tls.RequireAndVerifyClientCert
+        case "optional":
+            config.ClientAuth = tls.VerifyClientCertIfGiven
+        default:
+            return nil, nil, fmt.Errorf("unknown TLS_CLIENT_AUTH %q", os.Getenv("TLS_CLIENT_AUTH"))
+        }
+    }
+
+    return config, reloader, nil
+}
+
+// CertPrincipalMapper maps verified client certificate subjects to principals.
+type CertPrincipalMapper struct {
+    principals map[string]string
+}
+
+// NewCertPrincipalMapper parses "subject=principal" pairs separated by commas,
+// where subject is the certificate common name. With no pairs every verified
+// certificate is accepted as principal "cert:<common name>"; otherwise only
+// listed subjects are accepted.
+func NewCertPrincipalMapper(spec string) (*CertPrincipalMapper, error) {
+    mapper := &CertPrincipalMapper{principals: make(map[string]string)}
+    for _, pair := range strings.Split(spec, ",") {
+        pair = strings.TrimSpace(pair)
+        if pair == "" {
+            continue
+        }
+        subject, principal, ok := strings.Cut(pair, "=")
+        if !ok || subject == "" || principal == "" {
+            return nil, fmt.Errorf("invalid client principal mapping %q", pair)
+        }
+        mapper.principals[subject] = principal
+    }
+    return mapper, nil
+}
+
+// Principal returns the principal for the request's verified client
+// certificate, or false when there is none or its subject is not authorized.
+func (m *CertPrincipalMapper) Principal(r *http.Request) (string, bool) {
+    if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+        return "", false
+    }
+    subject := r.TLS.VerifiedChains[0][0].Subject.CommonName
+    if len(m.principals) == 0 {
+        return "cert:" + subject, subject != ""
+    }
+    principal, ok := m.principals[subject]
+    return principal, ok
+}
@@ -0,0 +1,196 @@
+// internal/api/tracing.go
+package api
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+    "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "my-golang-api/internal/api"
+
+// tracer returns the package tracer from the globally installed provider, so
+// spans are no-ops until InitTracing installs a real one.
+func tracer() trace.Tracer {
+    return otel.Tracer(tracerName)
+}
+
+// InitTracing installs the tracer provider selected by OTEL_TRACES_EXPORTER:
+// "otlp" (configured through the standard OTEL_EXPORTER_OTLP_* variables),
+// "stdout", or "none" (the default). W3C trace context is always propagated.
+// The returned function flushes and stops the exporter.
+func InitTracing(ctx context.Context) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+        propagation.TraceContext{},
+        propagation.Baggage{},
+    ))
+
+    var exporter sdktrace.SpanExporter
+    var err error
+    switch strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) {
+    case "", "none":
+        return func(context.Context) error { return nil }, nil
+    case "otlp":
+        exporter, err = otlptracehttp.New(ctx)
+    case "stdout":
+        exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+    default:
+        return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", os.Getenv("OTEL_TRACES_EXPORTER"))
+    }
+    if err != nil {
+        return nil, fmt.Errorf("creating trace exporter: %w", err)
+    }
+
+    serviceName := os.Getenv("OTEL_SERVICE_NAME")
+    if serviceName == "" {
+        serviceName = "kafnodex"
+    }
+    res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+        semconv.SchemaURL,
+        semconv.ServiceName(serviceName),
+    ))
+    if err != nil {
+        return nil, fmt.Errorf("creating trace resource: %w", err)
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(res),
+    )
+    otel.SetTracerProvider(provider)
+    return provider.Shutdown, nil
+}
+
+// kafkaHeaderCarrier adapts Kafka record headers to a propagation.TextMapCarrier.
+type kafkaHeaderCarrier struct {
+    headers *[]kafka.Header
+}
+
+func (c kafkaHeaderCarrier) Get(key string) string {
+    for _, header := range *c.headers {
+        if header.Key == key {
+            return string(header.Value)
+        }
+    }
+    return ""
+}
+
+func (c kafkaHeaderCarrier) Set(key, value string) {
+    for i, header := range *c.headers {
+        if header.Key == key {
+            (*c.headers)[i].Value = []byte(value)
+            return
+        }
+    }
+    *c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaHeaderCarrier) Keys() []string {
+    keys := make([]string, 0, len(*c.headers))
+    for _, header := range *c.headers {
+        keys = append(keys, header.Key)
+    }
+    return keys
+}
+
+// injectTraceContext writes the span context in ctx into the record's headers.
+func injectTraceContext(ctx context.Context, m *kafka.Message) {
+    otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{headers: &m.Headers})
+}
+
+// streamIDKey is the span attribute naming the stream a span works on. Span
+// names never include the stream, so their number stays bounded.
+const streamIDKey = attribute.Key("stream.id")
+
+// startProduceSpan starts a producer span for a write to streamID.
+func startProduceSpan(ctx context.Context, streamID string) (context.Context, trace.Span) {
+    return tracer().Start(ctx, "produce",
+        trace.WithSpanKind(trace.SpanKindProducer),
+        trace.WithAttributes(
+            streamIDKey.String(streamID),
+            semconv.MessagingSystemKafka,
+            semconv.MessagingOperationTypePublish,
+            semconv.MessagingDestinationName(streamID),
+        ))
+}
+
+// startConsumeSpan starts a consumer span for m, linked to the span that
+// produced it when the record carries trace context.
+func startConsumeSpan(ctx context.Context, streamID string, m kafka.Message) (context.Context, trace.Span) {
+    producerCtx := otel.GetTextMapPropagator().Extract(context.Background(), kafkaHeaderCarrier{headers: &m.Headers})
+    opts := []trace.SpanStartOption{
+        trace.WithSpanKind(trace.SpanKindConsumer),
+        trace.WithAttributes(
+            streamIDKey.String(streamID),
+            semconv.MessagingSystemKafka,
+            semconv.MessagingOperationTypeReceive,
+            semconv.MessagingDestinationName(streamID),
+            semconv.MessagingDestinationPartitionID(fmt.Sprint(m.Partition)),
+            semconv.MessagingKafkaMessageOffset(int(m.Offset)),
+        ),
+    }
+    if link := trace.LinkFromContext(producerCtx); link.SpanContext.IsValid() {
+        opts = append(opts, trace.WithLinks(link))
+    }
+    return tracer().Start(ctx, "consume", opts...)
+}
+
+// startStreamSpan starts an internal span named name for work on a record of
+// streamID.
+func startStreamSpan(ctx context.Context, name, streamID string) (context.Context, trace.Span) {
+    return tracer().Start(ctx, name, trace.WithAttributes(streamIDKey.String(streamID)))
+}
+
+// recordSpanError marks span as failed with err.
+func recordSpanError(span trace.Span, err error) {
+    span.RecordError(err)
+    span.SetStatus(codes.Error, err.Error())
+}
+
+// TracingMiddleware starts a server span for every request, continuing any
+// W3C trace context sent by the client and naming the span after the route template.
+func TracingMiddleware() func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            route := r.URL.Path
+            if current := mux.CurrentRoute(r); current != nil {
+                if template, err := current.GetPathTemplate(); err == nil {
+                    route = template
+                }
+            }
+
+            ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+            ctx, span := tracer().Start(ctx, r.Method+" "+route,
+                trace.WithSpanKind(trace.SpanKindServer),
+                trace.WithAttributes(
+                    semconv.HTTPRequestMethodKey.String(r.Method),
+                    semconv.HTTPRoute(route),
+                    streamIDKey.String(mux.Vars(r)["stream_id"]),
+                ))
+            defer span.End()
+
+            recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+            next.ServeHTTP(recorder, r.WithContext(ctx))
+
+            span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+            if recorder.status >= http.StatusInternalServerError {
+                span.SetStatus(codes.Error, http.StatusText(recorder.status))
+            }
+        })
+    }
+}
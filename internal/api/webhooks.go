@@ -0,0 +1,758 @@
+// internal/api/webhooks.go
+package api
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+    "github.com/sirupsen/logrus"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook's secret, prefixed "sha256=".
+const (
+    WebhookIDHeader        = "X-Webhook-ID"
+    WebhookTimestampHeader = "X-Webhook-Timestamp"
+    WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Webhook delivery defaults, overridable through the environment
+const (
+    defaultWebhookBatchSize   = 1
+    maxWebhookBatchSize       = 500
+    defaultWebhookLingerMs    = 500
+    defaultWebhookMaxAttempts = 5
+    defaultWebhookBackoffMs   = 1000
+    defaultWebhookDeadLetters = 1000
+    webhookRequestTimeout     = 10 * time.Second
+)
+
+// backgroundAttemptTimeout bounds a single write or commit by a background
+// consumer, which is left to finish when the consumer stops.
+const backgroundAttemptTimeout = 10 * time.Second
+
+// ErrWebhookAddressBlocked is returned for webhook URLs on loopback, private,
+// link-local and other internal addresses outside WEBHOOK_ALLOWED_NETWORKS.
+var ErrWebhookAddressBlocked = errors.New("webhook address is not allowed")
+
+// webhookClient posts deliveries. It dials no proxy and checks every address
+// it connects to, so names resolving to internal addresses are refused too;
+// redirects are not followed so a signed body only ever reaches the
+// registered URL.
+var webhookClient = &http.Client{
+    Timeout: webhookRequestTimeout,
+    Transport: &http.Transport{
+        DialContext: (&net.Dialer{
+            Timeout: webhookRequestTimeout,
+            Control: func(network, address string, _ syscall.RawConn) error {
+                host, _, err := net.SplitHostPort(address)
+                if err != nil {
+                    return err
+                }
+                if ip := net.ParseIP(host); ip == nil || !webhookAddressAllowed(ip) {
+                    return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+                }
+                return nil
+            },
+        }).DialContext,
+        TLSHandshakeTimeout: webhookRequestTimeout,
+        MaxIdleConnsPerHost: 4,
+    },
+    CheckRedirect: func(req *http.Request, via []*http.Request) error {
+        return http.ErrUseLastResponse
+    },
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, internal like the
+// private ranges.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// webhookAddressAllowed reports whether deliveries may connect to ip: public
+// addresses, and addresses in the comma-separated CIDRs or IPs of
+// WEBHOOK_ALLOWED_NETWORKS.
+func webhookAddressAllowed(ip net.IP) bool {
+    for _, entry := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_NETWORKS"), ",") {
+        entry = strings.TrimSpace(entry)
+        if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+            return true
+        }
+        if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+            return true
+        }
+    }
+    return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+        ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+        ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// WebhookRequest is the body of POST /stream/{stream_id}/webhooks. Filter
+// holds header values records must have, as ?header.<key>= does for websocket
+// subscribers; BatchSize defaults to one record per delivery.
+type WebhookRequest struct {
+    URL       string            `json:"url"`
+    Secret    string            `json:"secret"`
+    Filter    map[string]string `json:"filter,omitempty"`
+    BatchSize int               `json:"batch_size,omitempty"`
+}
+
+// Validate checks the request without contacting the endpoint. Internal IP
+// addresses and localhost are refused here; names resolving to internal
+// addresses are refused when delivering.
+func (w WebhookRequest) Validate() error {
+    target, err := url.Parse(w.URL)
+    if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+        return errors.New("url must be an absolute http or https URL")
+    }
+    host := strings.ToLower(target.Hostname())
+    if ip := net.ParseIP(host); ip != nil && !webhookAddressAllowed(ip) {
+        return fmt.Errorf("url must not point to an internal address: %s", host)
+    }
+    if (host == "localhost" || strings.HasSuffix(host, ".localhost")) && !webhookAddressAllowed(net.IPv4(127, 0, 0, 1)) {
+        return fmt.Errorf("url must not point to an internal address: %s", host)
+    }
+    if w.Secret == "" {
+        return errors.New("secret is required to sign deliveries")
+    }
+    for key := range w.Filter {
+        if !headerKeyPattern.MatchString(key) {
+            return fmt.Errorf("invalid filter header name %q", key)
+        }
+    }
+    if w.BatchSize < 0 || w.BatchSize > maxWebhookBatchSize {
+        return fmt.Errorf("batch_size must be between 1 and %d", maxWebhookBatchSize)
+    }
+    return nil
+}
+
+// Webhook is a push subscription to a stream. Its secret is never returned.
+type Webhook struct {
+    ID        string            `json:"id"`
+    StreamID  string            `json:"stream_id"`
+    URL       string            `json:"url"`
+    Filter    map[string]string `json:"filter,omitempty"`
+    BatchSize int               `json:"batch_size"`
+    CreatedAt time.Time         `json:"created_at"`
+}
+
+// storedWebhook is a webhook as persisted, with its secret and dead letters.
+type storedWebhook struct {
+    Webhook
+    Secret      string       `json:"secret"`
+    DeadLetters []DeadLetter `json:"dead_letters,omitempty"`
+}
+
+// WebhookStatus reports a webhook's delivery progress. Lag is the number of
+// records on the stream the webhook has not consumed yet.
+type WebhookStatus struct {
+    Delivered      int64      `json:"delivered"`
+    FailedAttempts int64      `json:"failed_attempts"`
+    DeadLettered   int64      `json:"dead_lettered"`
+    Lag            int64      `json:"lag"`
+    LastError      string     `json:"last_error,omitempty"`
+    LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"`
+}
+
+// WebhookView is a webhook with its status, as returned by the API.
+type WebhookView struct {
+    Webhook
+    Status WebhookStatus `json:"status"`
+}
+
+// WebhookRecord is one record in a delivery.
+type WebhookRecord struct {
+    Partition int               `json:"partition"`
+    Offset    int64             `json:"offset"`
+    Timestamp time.Time         `json:"timestamp"`
+    Data      string            `json:"data"`
+    Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// WebhookPayload is the JSON body of a delivery.
+type WebhookPayload struct {
+    WebhookID string          `json:"webhook_id"`
+    StreamID  string          `json:"stream_id"`
+    Records   []WebhookRecord `json:"records"`
+}
+
+// DeadLetter is a delivery that was given up on, kept for inspection.
+type DeadLetter struct {
+    Records  []WebhookRecord `json:"records"`
+    Error    string          `json:"error"`
+    Attempts int             `json:"attempts"`
+    FailedAt time.Time       `json:"failed_at"`
+}
+
+// SignWebhook returns the hex HMAC-SHA256 signature of a delivery, for
+// receivers to compare with the X-Webhook-Signature header.
+func SignWebhook(secret, timestamp string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp))
+    mac.Write([]byte("."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookWorker delivers a webhook's records from its own consumer group.
+type webhookWorker struct {
+    hook    Webhook
+    secret  string
+    persist func() error
+
+    mu          sync.Mutex
+    cancel      context.CancelFunc
+    done        chan struct{}
+    reader      CommittingReader
+    status      WebhookStatus
+    deadLetters []DeadLetter
+}
+
+// webhookDeliveryError is a failed delivery attempt; permanent ones are not retried.
+type webhookDeliveryError struct {
+    err       error
+    permanent bool
+}
+
+func (e *webhookDeliveryError) Error() string { return e.err.Error() }
+
+func (e *webhookDeliveryError) Unwrap() error { return e.err }
+
+// webhookBatch is the records fetched for one delivery: every message, to
+// commit once the delivery is settled, and the records the filter kept.
+type webhookBatch struct {
+    messages []kafka.Message
+    records  []WebhookRecord
+}
+
+// start begins consuming the stream in the background.
+func (wk *webhookWorker) start(info *StreamInfo) {
+    ctx, cancel := context.WithCancel(context.Background())
+    reader, done := currentGroupReader()(info, "webhook-"+wk.hook.ID), make(chan struct{})
+    wk.mu.Lock()
+    wk.cancel, wk.done, wk.reader = cancel, done, reader
+    wk.mu.Unlock()
+    go func() {
+        defer close(done)
+        wk.run(ctx, info, reader)
+    }()
+}
+
+// stop ends consumption, letting a delivery attempt in progress finish.
+// Records not yet delivered or dead-lettered are left uncommitted, so they
+// are delivered when the webhook next starts.
+func (wk *webhookWorker) stop() {
+    wk.mu.Lock()
+    cancel, done, reader := wk.cancel, wk.done, wk.reader
+    wk.cancel = nil
+    wk.mu.Unlock()
+    if cancel == nil {
+        return
+    }
+    cancel()
+    <-done
+    reader.Close()
+}
+
+func (wk *webhookWorker) run(ctx context.Context, info *StreamInfo, reader CommittingReader) {
+    logger := log.WithFields(logrus.Fields{"stream_id": wk.hook.StreamID, "webhook_id": wk.hook.ID})
+    for {
+        batch, err := wk.fetchBatch(ctx, info, reader)
+        if ctx.Err() != nil {
+            return
+        }
+        if err != nil {
+            logger.WithField("error", err.Error()).Warn("Failed to read records for webhook")
+            wk.recordFailure(err, false)
+            if !sleepContext(ctx, retryBackoff("WEBHOOK_RETRY_BACKOFF_MS", defaultWebhookBackoffMs, 1)) {
+                return
+            }
+            continue
+        }
+        if len(batch.records) > 0 && !wk.deliver(ctx, logger, batch.records) {
+            return
+        }
+        commitCtx, cancel := context.WithTimeout(context.Background(), backgroundAttemptTimeout)
+        if err := reader.CommitMessages(commitCtx, batch.messages...); err != nil {
+            logger.WithField("error", err.Error()).Warn("Failed to commit webhook offsets; records may be delivered again")
+            wk.recordFailure(err, false)
+        }
+        cancel()
+    }
+}
+
+// fetchBatch waits for a record, then gathers up to the batch size for as
+// long as the linger time allows. Records the filter rejects are committed
+// with the batch but not delivered.
+func (wk *webhookWorker) fetchBatch(ctx context.Context, info *StreamInfo, reader CommittingReader) (webhookBatch, error) {
+    var batch webhookBatch
+    batchCtx := ctx
+    linger := time.Duration(envInt64("WEBHOOK_BATCH_LINGER_MS", defaultWebhookLingerMs)) * time.Millisecond
+    for len(batch.records) < wk.hook.BatchSize {
+        m, err := reader.FetchMessage(batchCtx)
+        if err != nil {
+            if batchCtx != ctx && ctx.Err() == nil && batchCtx.Err() != nil {
+                // The linger ran out; deliver what passed the filter, if anything
+                return batch, nil
+            }
+            return batch, err
+        }
+        if batchCtx == ctx {
+            var cancel context.CancelFunc
+            batchCtx, cancel = context.WithTimeout(ctx, linger)
+            defer cancel()
+        }
+
+        batch.messages = append(batch.messages, m)
+        headers := recordHeaders(m.Headers)
+        if !headerFilter(wk.hook.Filter).matches(headers) {
+            continue
+        }
+        record, contentType := m.Value, recordContentType(&m)
+        if info.Schema != nil && isFramedRecord(record) {
+            if decoded, err := DecodeRecord(record); err == nil {
+                record, contentType = decoded, ContentTypeJSON
+            }
+        }
+        batch.records = append(batch.records, WebhookRecord{
+            Partition: m.Partition,
+            Offset:    m.Offset,
+            Timestamp: m.Time,
+            Data:      textPayload(record, contentType),
+            Headers:   headers,
+        })
+    }
+    return batch, nil
+}
+
+// deliver posts a batch, retrying with exponential backoff, and moves it to
+// the dead letters once retries are exhausted or the endpoint rejects it.
+// Attempts are not interrupted by ctx; it returns false when ctx ends before
+// the batch was delivered or dead-lettered.
+func (wk *webhookWorker) deliver(ctx context.Context, logger *logrus.Entry, records []WebhookRecord) bool {
+    body, err := json.Marshal(WebhookPayload{WebhookID: wk.hook.ID, StreamID: wk.hook.StreamID, Records: records})
+    if err != nil {
+        return wk.deadLetter(ctx, logger, records, err, 0)
+    }
+    maxAttempts := int(envInt64("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts))
+    for attempt := 1; ; attempt++ {
+        err := wk.post(body)
+        if err == nil {
+            now := time.Now()
+            wk.mu.Lock()
+            wk.status.Delivered += int64(len(records))
+            wk.status.LastDeliveryAt = &now
+            wk.mu.Unlock()
+            return true
+        }
+        var deliveryErr *webhookDeliveryError
+        permanent := errors.As(err, &deliveryErr) && deliveryErr.permanent
+        wk.recordFailure(err, true)
+        if permanent || attempt >= maxAttempts {
+            logger.WithFields(logrus.Fields{"attempts": attempt, "records": len(records), "error": err.Error()}).Error("Moving webhook delivery to dead letters")
+            return wk.deadLetter(ctx, logger, records, err, attempt)
+        }
+        if !sleepContext(ctx, retryBackoff("WEBHOOK_RETRY_BACKOFF_MS", defaultWebhookBackoffMs, attempt)) {
+            return false
+        }
+    }
+}
+
+// post sends one signed delivery attempt.
+func (wk *webhookWorker) post(body []byte) error {
+    req, err := http.NewRequest(http.MethodPost, wk.hook.URL, bytes.NewReader(body))
+    if err != nil {
+        return &webhookDeliveryError{err: err, permanent: true}
+    }
+    timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set(WebhookIDHeader, wk.hook.ID)
+    req.Header.Set(WebhookTimestampHeader, timestamp)
+    req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(wk.secret, timestamp, body))
+
+    resp, err := webhookClient.Do(req)
+    if err != nil {
+        return &webhookDeliveryError{err: err, permanent: errors.Is(err, ErrWebhookAddressBlocked)}
+    }
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+    resp.Body.Close()
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return nil
+    }
+    // Client errors other than timeouts and throttling will not go away on retry
+    permanent := resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+        resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests
+    return &webhookDeliveryError{err: fmt.Errorf("endpoint answered %s", resp.Status), permanent: permanent}
+}
+
+func (wk *webhookWorker) recordFailure(err error, attempt bool) {
+    wk.mu.Lock()
+    defer wk.mu.Unlock()
+    if attempt {
+        wk.status.FailedAttempts++
+    }
+    wk.status.LastError = err.Error()
+}
+
+// deadLetter keeps a failed delivery, dropping the oldest beyond
+// WEBHOOK_DEAD_LETTER_LIMIT, and saves it with the webhooks. Saving is
+// retried until it succeeds; it returns false when ctx ends first, leaving
+// the records to be delivered again.
+func (wk *webhookWorker) deadLetter(ctx context.Context, logger *logrus.Entry, records []WebhookRecord, err error, attempts int) bool {
+    limit := int(envInt64("WEBHOOK_DEAD_LETTER_LIMIT", defaultWebhookDeadLetters))
+    wk.mu.Lock()
+    wk.deadLetters = append(wk.deadLetters, DeadLetter{Records: records, Error: err.Error(), Attempts: attempts, FailedAt: time.Now().UTC()})
+    if len(wk.deadLetters) > limit {
+        wk.deadLetters = wk.deadLetters[len(wk.deadLetters)-limit:]
+    }
+    wk.mu.Unlock()
+
+    for attempt := 1; ; attempt++ {
+        err := wk.persist()
+        if err == nil {
+            break
+        }
+        logger.WithField("error", err.Error()).Error("Failed to save webhook dead letters")
+        wk.recordFailure(err, false)
+        if !sleepContext(ctx, retryBackoff("WEBHOOK_RETRY_BACKOFF_MS", defaultWebhookBackoffMs, attempt)) {
+            return false
+        }
+    }
+    wk.mu.Lock()
+    wk.status.DeadLettered += int64(len(records))
+    wk.mu.Unlock()
+    return true
+}
+
+// view returns the webhook with a snapshot of its status.
+func (wk *webhookWorker) view() WebhookView {
+    wk.mu.Lock()
+    defer wk.mu.Unlock()
+    status := wk.status
+    if wk.reader != nil && wk.cancel != nil {
+        status.Lag = wk.reader.Stats().Lag
+    }
+    return WebhookView{Webhook: wk.hook, Status: status}
+}
+
+// maxRetryBackoff caps the wait between retries of background deliveries.
+const maxRetryBackoff = 60 * time.Second
+
+// retryBackoff is the wait before retry attempt+1: the delay configured by the
+// environment variable, doubled per attempt and capped at a minute.
+func retryBackoff(variable string, defaultMs int64, attempt int) time.Duration {
+    backoff := time.Duration(envInt64(variable, defaultMs)) * time.Millisecond
+    for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+        backoff *= 2
+    }
+    if backoff > maxRetryBackoff {
+        return maxRetryBackoff
+    }
+    return backoff
+}
+
+// sleepContext waits for d, returning false if ctx ends first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return true
+    case <-ctx.Done():
+        return false
+    }
+}
+
+// WebhookManager runs the webhook workers and persists the webhooks to a JSON
+// file when it has a path.
+type WebhookManager struct {
+    mu      sync.Mutex
+    path    string
+    workers map[string]*webhookWorker
+}
+
+// NewWebhookManager opens the webhooks and dead letters persisted at path, if
+// any. Workers start once the manager is installed with UseWebhooks.
+func NewWebhookManager(path string) (*WebhookManager, error) {
+    m := &WebhookManager{path: path, workers: make(map[string]*webhookWorker)}
+    if path == "" {
+        return m, nil
+    }
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return m, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("reading webhook store: %w", err)
+    }
+    var stored []storedWebhook
+    if err := json.Unmarshal(data, &stored); err != nil {
+        return nil, fmt.Errorf("parsing webhook store %s: %w", path, err)
+    }
+    for _, hook := range stored {
+        m.workers[hook.ID] = m.newWorker(hook.Webhook, hook.Secret)
+        m.workers[hook.ID].deadLetters = hook.DeadLetters
+    }
+    return m, nil
+}
+
+func (m *WebhookManager) newWorker(hook Webhook, secret string) *webhookWorker {
+    return &webhookWorker{hook: hook, secret: secret, persist: m.persist}
+}
+
+// WebhookManagerFromEnv opens the webhooks persisted at WEBHOOK_STORE_PATH,
+// or keeps them and their dead letters in memory when it is unset.
+func WebhookManagerFromEnv() (*WebhookManager, error) {
+    return NewWebhookManager(os.Getenv("WEBHOOK_STORE_PATH"))
+}
+
+var (
+    webhooks   = &WebhookManager{workers: make(map[string]*webhookWorker)}
+    webhooksMu sync.Mutex
+)
+
+// UseWebhooks stops the current webhook workers and starts those of m.
+// Webhooks of streams that no longer exist stay registered but idle.
+func UseWebhooks(m *WebhookManager) {
+    webhooksMu.Lock()
+    previous := webhooks
+    webhooks = m
+    webhooksMu.Unlock()
+    previous.Close()
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, worker := range m.workers {
+        info, exists := streamManager.Stream(worker.hook.StreamID)
+        if !exists {
+            log.WithFields(logrus.Fields{"stream_id": worker.hook.StreamID, "webhook_id": worker.hook.ID}).Warn("Webhook stream does not exist; not delivering")
+            continue
+        }
+        worker.start(info)
+    }
+}
+
+func currentWebhooks() *WebhookManager {
+    webhooksMu.Lock()
+    defer webhooksMu.Unlock()
+    return webhooks
+}
+
+// Close stops every worker, letting delivery attempts in progress finish.
+// Workers are stopped without holding the manager's lock, which saving dead
+// letters takes.
+func (m *WebhookManager) Close() {
+    m.mu.Lock()
+    workers := make([]*webhookWorker, 0, len(m.workers))
+    for _, worker := range m.workers {
+        workers = append(workers, worker)
+    }
+    m.mu.Unlock()
+    for _, worker := range workers {
+        worker.stop()
+    }
+}
+
+// add registers and starts a webhook.
+func (m *WebhookManager) add(info *StreamInfo, hook Webhook, secret string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    worker := m.newWorker(hook, secret)
+    m.workers[hook.ID] = worker
+    if err := m.persistLocked(); err != nil {
+        delete(m.workers, hook.ID)
+        return err
+    }
+    worker.start(info)
+    return nil
+}
+
+// remove stops and deletes a stream's webhook, reporting whether it existed.
+func (m *WebhookManager) remove(streamID, id string) (bool, error) {
+    m.mu.Lock()
+    worker, exists := m.workers[id]
+    if !exists || worker.hook.StreamID != streamID {
+        m.mu.Unlock()
+        return false, nil
+    }
+    delete(m.workers, id)
+    err := m.persistLocked()
+    m.mu.Unlock()
+    worker.stop()
+    return true, err
+}
+
+// get returns a stream's webhook.
+func (m *WebhookManager) get(streamID, id string) (*webhookWorker, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    worker, exists := m.workers[id]
+    if !exists || worker.hook.StreamID != streamID {
+        return nil, false
+    }
+    return worker, true
+}
+
+// list returns a stream's webhooks, oldest first.
+func (m *WebhookManager) list(streamID string) []WebhookView {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    views := []WebhookView{}
+    for _, worker := range m.workers {
+        if worker.hook.StreamID == streamID {
+            views = append(views, worker.view())
+        }
+    }
+    sort.Slice(views, func(i, j int) bool { return views[i].CreatedAt.Before(views[j].CreatedAt) })
+    return views
+}
+
+// persist saves the webhooks and their dead letters.
+func (m *WebhookManager) persist() error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.persistLocked()
+}
+
+func (m *WebhookManager) persistLocked() error {
+    if m.path == "" {
+        return nil
+    }
+    stored := make([]storedWebhook, 0, len(m.workers))
+    for _, id := range sortedKeys(m.workers) {
+        worker := m.workers[id]
+        worker.mu.Lock()
+        deadLetters := append([]DeadLetter(nil), worker.deadLetters...)
+        worker.mu.Unlock()
+        stored = append(stored, storedWebhook{Webhook: worker.hook, Secret: worker.secret, DeadLetters: deadLetters})
+    }
+    data, err := json.MarshalIndent(stored, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(m.path, data)
+}
+
+// CreateWebhook handles POST /stream/{stream_id}/webhooks.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    info, ok := requireStream(w, r, streamID, AuditActionWebhookCreate)
+    if !ok {
+        return
+    }
+    var request WebhookRequest
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&request); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid webhook request: "+err.Error())
+        return
+    }
+    if err := request.Validate(); err != nil {
+        writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+        return
+    }
+    if request.BatchSize == 0 {
+        request.BatchSize = defaultWebhookBatchSize
+    }
+
+    hook := Webhook{
+        ID:        uuid.New().String(),
+        StreamID:  streamID,
+        URL:       request.URL,
+        Filter:    request.Filter,
+        BatchSize: request.BatchSize,
+        CreatedAt: time.Now().UTC(),
+    }
+    if err := currentWebhooks().add(info, hook, request.Secret); err != nil {
+        Audit(r, AuditActionWebhookCreate, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, err)
+        return
+    }
+    Audit(r, AuditActionWebhookCreate, streamID, AuditOutcomeSuccess, hook.ID)
+    writeJSON(w, http.StatusCreated, WebhookView{Webhook: hook})
+}
+
+// ListWebhooks handles GET /stream/{stream_id}/webhooks.
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+    streamID := mux.Vars(r)["stream_id"]
+    if _, ok := requireStream(w, r, streamID, AuditActionStreamSubscribe); !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": currentWebhooks().list(streamID)})
+}
+
+// lookupWebhook resolves the stream and webhook of a request, writing the
+// error response when either does not exist.
+func lookupWebhook(w http.ResponseWriter, r *http.Request, action string) (*webhookWorker, bool) {
+    vars := mux.Vars(r)
+    if _, ok := requireStream(w, r, vars["stream_id"], action); !ok {
+        return nil, false
+    }
+    worker, exists := currentWebhooks().get(vars["stream_id"], vars["webhook_id"])
+    if !exists {
+        writeError(w, r, http.StatusNotFound, ErrCodeWebhookNotFound, "Webhook "+vars["webhook_id"]+" does not exist")
+        return nil, false
+    }
+    return worker, true
+}
+
+// GetWebhook handles GET /stream/{stream_id}/webhooks/{webhook_id}, reporting
+// its delivery status and lag.
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+    worker, ok := lookupWebhook(w, r, AuditActionStreamSubscribe)
+    if !ok {
+        return
+    }
+    writeJSON(w, http.StatusOK, worker.view())
+}
+
+// GetWebhookDeadLetters handles GET /stream/{stream_id}/webhooks/{webhook_id}/dead-letters.
+func GetWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+    worker, ok := lookupWebhook(w, r, AuditActionStreamSubscribe)
+    if !ok {
+        return
+    }
+    worker.mu.Lock()
+    deadLetters := append([]DeadLetter{}, worker.deadLetters...)
+    worker.mu.Unlock()
+    writeJSON(w, http.StatusOK, map[string]interface{}{"dead_letters": deadLetters})
+}
+
+// DeleteWebhook handles DELETE /stream/{stream_id}/webhooks/{webhook_id}.
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+    vars := mux.Vars(r)
+    streamID := vars["stream_id"]
+    if _, ok := requireStream(w, r, streamID, AuditActionWebhookDelete); !ok {
+        return
+    }
+    removed, err := currentWebhooks().remove(streamID, vars["webhook_id"])
+    if err != nil {
+        Audit(r, AuditActionWebhookDelete, streamID, AuditOutcomeFailure, err.Error())
+        WriteError(w, r, err)
+        return
+    }
+    if !removed {
+        writeError(w, r, http.StatusNotFound, ErrCodeWebhookNotFound, "Webhook "+vars["webhook_id"]+" does not exist")
+        return
+    }
+    Audit(r, AuditActionWebhookDelete, streamID, AuditOutcomeSuccess, vars["webhook_id"])
+    w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+// tests/audit_test.go
+package tests
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "my-golang-api/internal/api"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// TestAuditRotatingFile checks that audit events are written as JSON lines and
+// that the file rotates once it passes the size limit.
+func TestAuditRotatingFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    file, err := api.NewRotatingFile(path, 200, 2)
+    if err != nil {
+        t.Fatalf("Failed to open audit log: %v", err)
+    }
+    auditor := api.NewAuditor(file)
+
+    for i := 0; i < 3; i++ {
+        auditor.Emit(api.AuditEvent{
+            Principal: "apikey:test",
+            Action:    api.AuditActionStreamSend,
+            Stream:    "orders",
+            Outcome:   api.AuditOutcomeSuccess,
+            ClientIP:  "10.0.0.1",
+        })
+    }
+    if err := auditor.Close(); err != nil {
+        t.Fatalf("Failed to close auditor: %v", err)
+    }
+
+    if _, err := os.Stat(path + ".1"); err != nil {
+        t.Errorf("Expected rotated audit log %s.1: %v", path, err)
+    }
+
+    current, err := os.Open(path)
+    if err != nil {
+        t.Fatalf("Failed to open current audit log: %v", err)
+    }
+    defer current.Close()
+
+    scanner := bufio.NewScanner(current)
+    if !scanner.Scan() {
+        t.Fatalf("Expected at least one event in the current audit log")
+    }
+    var event api.AuditEvent
+    if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+        t.Fatalf("Failed to parse audit event: %v", err)
+    }
+    if event.Action != api.AuditActionStreamSend || event.Stream != "orders" || event.Time.IsZero() {
+        t.Errorf("Unexpected audit event: %+v", event)
+    }
+}
+
+// TestAuditClientIP checks that X-Forwarded-For is only believed from trusted
+// proxies, and only up to the first address that is not one.
+func TestAuditClientIP(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "audit.log")
+    t.Setenv("AUDIT_LOG_FILE", path)
+    auditor, err := api.ConfigureAuditFromEnv()
+    if err != nil {
+        t.Fatalf("Failed to configure audit: %v", err)
+    }
+    t.Cleanup(func() {
+        auditor.Close()
+        os.Unsetenv("AUDIT_LOG_FILE")
+        api.ConfigureAuditFromEnv()
+        api.UseTrustedProxies(&api.TrustedProxies{})
+    })
+
+    proxies, err := api.NewTrustedProxies("10.0.0.0/8, 192.0.2.7")
+    if err != nil {
+        t.Fatalf("Failed to parse trusted proxies: %v", err)
+    }
+    cases := []struct {
+        trusted           bool
+        remote, xff, want string
+    }{
+        {false, "10.0.0.5:4312", "198.51.100.1", "10.0.0.5"},
+        {true, "203.0.113.9:4312", "198.51.100.1", "203.0.113.9"},
+        {true, "10.0.0.5:4312", "", "10.0.0.5"},
+        {true, "10.0.0.5:4312", "198.51.100.66, 198.51.100.1", "198.51.100.1"},
+        {true, "192.0.2.7:4312", "198.51.100.1, 10.0.0.9", "198.51.100.1"},
+        {true, "10.0.0.5:4312", "garbage, 10.0.0.9", "10.0.0.9"},
+    }
+    for _, c := range cases {
+        if c.trusted {
+            api.UseTrustedProxies(proxies)
+        } else {
+            api.UseTrustedProxies(&api.TrustedProxies{})
+        }
+        req := httptest.NewRequest("GET", "/streams", nil)
+        req.RemoteAddr = c.remote
+        if c.xff != "" {
+            req.Header.Set("X-Forwarded-For", c.xff)
+        }
+        api.Audit(req, api.AuditActionStreamSubscribe, "orders", api.AuditOutcomeSuccess, c.want)
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatalf("Failed to read audit log: %v", err)
+    }
+    lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+    if len(lines) != len(cases) {
+        t.Fatalf("Expected %d audit events, got %d", len(cases), len(lines))
+    }
+    for _, line := range lines {
+        var event api.AuditEvent
+        json.Unmarshal(line, &event)
+        if event.ClientIP != event.Detail {
+            t.Errorf("Expected client IP %s, got %s", event.Detail, event.ClientIP)
+        }
+    }
+
+    for _, spec := range []string{"proxy.internal", "10.0.0.0/33"} {
+        if _, err := api.NewTrustedProxies(spec); err == nil {
+            t.Errorf("Expected an error for %q", spec)
+        }
+    }
+}
+
+// blockingSink holds writes of events naming the slow stream until released.
+type blockingSink struct {
+    release chan struct{}
+}
+
+func (s *blockingSink) WriteEvent(event []byte) error {
+    if bytes.Contains(event, []byte(`"stream":"slow"`)) {
+        <-s.release
+    }
+    return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+// TestAuditorEmitDoesNotWaitForOtherEvents checks that a sink stuck on one
+// event does not hold up events emitted by other requests.
+func TestAuditorEmitDoesNotWaitForOtherEvents(t *testing.T) {
+    sink := &blockingSink{release: make(chan struct{})}
+    auditor := api.NewAuditor(sink)
+    defer close(sink.release)
+
+    go auditor.Emit(api.AuditEvent{Action: api.AuditActionStreamSend, Stream: "slow"})
+    time.Sleep(20 * time.Millisecond)
+
+    done := make(chan struct{})
+    go func() {
+        auditor.Emit(api.AuditEvent{Action: api.AuditActionStreamSend, Stream: "fast"})
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("Expected the event to be written while another one is stuck")
+    }
+}
@@ -0,0 +1,67 @@
+// tests/broker_test.go
+package tests
+
+import (
+    "context"
+    "my-golang-api/internal/api"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// TestBrokerConfigFromEnv checks broker list, TLS and SCRAM settings, with the
+// password read from a mounted file.
+func TestBrokerConfigFromEnv(t *testing.T) {
+    passwordFile := filepath.Join(t.TempDir(), "password")
+    if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600); err != nil {
+        t.Fatalf("Failed to write password file: %v", err)
+    }
+    t.Setenv("KAFKA_BROKERS", "kafka-1:9093, kafka-2:9093")
+    t.Setenv("KAFKA_TLS_ENABLED", "true")
+    t.Setenv("KAFKA_SASL_MECHANISM", "SCRAM-SHA-512")
+    t.Setenv("KAFKA_SASL_USERNAME", "kafnodex")
+    t.Setenv("KAFKA_SASL_PASSWORD_FILE", passwordFile)
+
+    cfg, err := api.BrokerConfigFromEnv()
+    if err != nil {
+        t.Fatalf("Failed to read broker config: %v", err)
+    }
+    if len(cfg.Brokers) != 2 || cfg.Brokers[1] != "kafka-2:9093" {
+        t.Errorf("Unexpected brokers: %v", cfg.Brokers)
+    }
+    if cfg.TLS == nil {
+        t.Errorf("Expected TLS to be enabled")
+    }
+    if cfg.SASL == nil || cfg.SASL.Name() != "SCRAM-SHA-512" {
+        t.Errorf("Expected SCRAM-SHA-512 mechanism, got %v", cfg.SASL)
+    }
+
+    dialer := cfg.Dialer()
+    if dialer.TLS != cfg.TLS || dialer.SASLMechanism != cfg.SASL {
+        t.Errorf("Expected dialer to carry the TLS and SASL settings")
+    }
+}
+
+// TestBrokerConfigRequiresCredentials checks that a SASL mechanism without credentials is rejected.
+func TestBrokerConfigRequiresCredentials(t *testing.T) {
+    t.Setenv("KAFKA_SASL_MECHANISM", "plain")
+    t.Setenv("KAFKA_SASL_USERNAME", "")
+    t.Setenv("KAFKA_SASL_PASSWORD", "")
+
+    if _, err := api.BrokerConfigFromEnv(); err == nil {
+        t.Errorf("Expected an error when SASL credentials are missing")
+    }
+}
+
+// TestCheckBrokerConnectivityUnreachable checks that an unreachable broker is reported as such.
+func TestCheckBrokerConnectivityUnreachable(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    err := api.CheckBrokerConnectivity(ctx, &api.BrokerConfig{Brokers: []string{"127.0.0.1:1"}})
+    if err == nil || !strings.Contains(err.Error(), "unreachable") {
+        t.Errorf("Expected an unreachable broker error, got %v", err)
+    }
+}
@@ -0,0 +1,216 @@
+// tests/compression_test.go
+package tests
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/websocket"
+    "github.com/klauspost/compress/zstd"
+    "github.com/segmentio/kafka-go"
+)
+
+// chattyRecord is a JSON record typical of the streams compression is for.
+var chattyRecord = []byte(`{"event": "page_view", "user": {"id": 123456, "segment": "returning", "locale": "en-US"}, "page": "/products/widgets?color=blue", "referrer": "https://example.com/search?q=widgets", "timings": {"dns": 12, "connect": 34, "ttfb": 120, "load": 860}}`)
+
+func gzipBytes(data []byte) []byte {
+    var buf bytes.Buffer
+    writer := gzip.NewWriter(&buf)
+    writer.Write(data)
+    writer.Close()
+    return buf.Bytes()
+}
+
+func zstdBytes(data []byte) []byte {
+    encoder, _ := zstd.NewWriter(nil)
+    defer encoder.Close()
+    return encoder.EncodeAll(data, nil)
+}
+
+// TestStreamSpecProducerCompression checks producer codec validation.
+func TestStreamSpecProducerCompression(t *testing.T) {
+    for _, codec := range []string{"none", "gzip", "snappy", "lz4", "zstd"} {
+        if err := (api.StreamSpec{ProducerCompression: codec}).Validate(); err != nil {
+            t.Errorf("Expected producer_compression %s to be valid, got %v", codec, err)
+        }
+    }
+    if err := (api.StreamSpec{ProducerCompression: "brotli"}).Validate(); err == nil {
+        t.Error("Expected producer_compression brotli to be rejected")
+    }
+}
+
+// TestSendDataContentEncoding checks that compressed send bodies are decoded
+// before validation, and that unknown or corrupt encodings are rejected.
+func TestSendDataContentEncoding(t *testing.T) {
+    schemas := useLocalSchemaStore(t)
+    schema, _ := schemas.Register("orders-value", api.Schema{Type: api.SchemaTypeJSON, Definition: orderJSONSchema})
+    useStreams(t, api.StreamInfo{ID: "orders", Schema: &api.StreamSchema{Subject: "orders-value", ID: schema.ID, Version: 1, Type: api.SchemaTypeJSON}})
+
+    // The record is missing its required id, which is only seen once decoded
+    mismatched := []byte(`{"data": {"item": "book"}}`)
+    cases := []struct {
+        encoding string
+        body     []byte
+        status   int
+        code     string
+    }{
+        {"gzip", gzipBytes(mismatched), http.StatusUnprocessableEntity, api.ErrCodeSchemaMismatch},
+        {"zstd", zstdBytes(mismatched), http.StatusUnprocessableEntity, api.ErrCodeSchemaMismatch},
+        {"br", mismatched, http.StatusUnsupportedMediaType, api.ErrCodeUnsupportedMediaType},
+        {"gzip", mismatched, http.StatusBadRequest, api.ErrCodeInvalidRequest},
+    }
+    for _, c := range cases {
+        req := httptest.NewRequest("POST", "/stream/orders/send", bytes.NewReader(c.body))
+        req.Header.Set("Content-Encoding", c.encoding)
+        w := httptest.NewRecorder()
+        api.SendData(w, req, "orders")
+
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != c.status || problem.Code != c.code {
+            t.Errorf("Content-Encoding %s: expected %d %s, got %d %+v", c.encoding, c.status, c.code, w.Code, problem)
+        }
+    }
+}
+
+// BenchmarkProducerCompression compares the producer codecs on a batch of
+// chatty JSON records, reporting the compressed size relative to the input.
+func BenchmarkProducerCompression(b *testing.B) {
+    batch := bytes.Repeat(chattyRecord, 100)
+    codecs := []kafka.Compression{kafka.Gzip, kafka.Snappy, kafka.Lz4, kafka.Zstd}
+    for _, compression := range codecs {
+        codec := compression.Codec()
+        b.Run(codec.Name(), func(b *testing.B) {
+            var out bytes.Buffer
+            b.SetBytes(int64(len(batch)))
+            for i := 0; i < b.N; i++ {
+                out.Reset()
+                writer := codec.NewWriter(&out)
+                writer.Write(batch)
+                writer.Close()
+            }
+            b.ReportMetric(float64(out.Len())/float64(len(batch)), "ratio")
+        })
+    }
+}
+
+// BenchmarkWebsocketCompression compares websocket throughput for chatty
+// records with and without permessage-deflate.
+func BenchmarkWebsocketCompression(b *testing.B) {
+    frame := []byte(strings.Repeat(string(chattyRecord), 4))
+    for _, compressed := range []bool{false, true} {
+        b.Run(fmt.Sprintf("deflate=%t", compressed), func(b *testing.B) {
+            upgrader := websocket.Upgrader{EnableCompression: compressed}
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                conn, err := upgrader.Upgrade(w, r, nil)
+                if err != nil {
+                    return
+                }
+                defer conn.Close()
+                for {
+                    if _, _, err := conn.ReadMessage(); err != nil {
+                        return
+                    }
+                }
+            }))
+            defer server.Close()
+
+            dialer := websocket.Dialer{EnableCompression: compressed}
+            conn, _, err := dialer.Dial("ws"+server.URL[len("http"):], nil)
+            if err != nil {
+                b.Fatalf("Failed to dial websocket: %v", err)
+            }
+            defer conn.Close()
+
+            b.SetBytes(int64(len(frame)))
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                if err := conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+                    b.Fatalf("Failed to write frame: %v", err)
+                }
+            }
+        })
+    }
+}
+
+// BenchmarkSendDataContentEncoding measures SendData on a chatty record sent
+// plain and compressed, producing to a fake broker.
+func BenchmarkSendDataContentEncoding(b *testing.B) {
+    useStreams(b, api.StreamInfo{ID: "bench-send"})
+    useFakeBroker(b, &fakeBroker{})
+
+    body, _ := json.Marshal(map[string]string{"data": string(chattyRecord)})
+    encodings := []struct {
+        name string
+        body []byte
+    }{
+        {"identity", body},
+        {api.ContentEncodingGzip, gzipBytes(body)},
+        {api.ContentEncodingZstd, zstdBytes(body)},
+    }
+    for _, encoding := range encodings {
+        b.Run(encoding.name, func(b *testing.B) {
+            b.SetBytes(int64(len(encoding.body)))
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                req := httptest.NewRequest("POST", "/stream/bench-send/send", bytes.NewReader(encoding.body))
+                req.Header.Set("Content-Encoding", encoding.name)
+                w := httptest.NewRecorder()
+                api.SendData(w, req, "bench-send")
+                if w.Code != http.StatusOK {
+                    b.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+                }
+            }
+        })
+    }
+}
+
+// benchSubscriptions numbers the streams BenchmarkGetResultsCompression
+// subscribes to, since the stream manager keeps each stream's consumer.
+var benchSubscriptions int64
+
+// BenchmarkGetResultsCompression measures GetResults delivering chatty
+// records to a subscriber with and without permessage-deflate.
+func BenchmarkGetResultsCompression(b *testing.B) {
+    for _, compressed := range []bool{false, true} {
+        b.Run(fmt.Sprintf("deflate=%t", compressed), func(b *testing.B) {
+            streamID := fmt.Sprintf("bench-results-%d", atomic.AddInt64(&benchSubscriptions, 1))
+            useStreams(b, api.StreamInfo{ID: streamID})
+            reader := useMemoryReader(b)
+            router := mux.NewRouter()
+            router.HandleFunc("/stream/{stream_id}/results", api.GetResults)
+            server := httptest.NewServer(router)
+            defer server.Close()
+
+            dialer := websocket.Dialer{EnableCompression: compressed}
+            conn, _, err := dialer.Dial("ws"+server.URL[len("http"):]+"/stream/"+streamID+"/results", nil)
+            if err != nil {
+                b.Fatalf("Failed to subscribe: %v", err)
+            }
+            defer conn.Close()
+            // The first frame announces the subscription
+            if _, _, err := conn.ReadMessage(); err != nil {
+                b.Fatalf("Failed to read the status frame: %v", err)
+            }
+
+            b.SetBytes(int64(len(chattyRecord)))
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                reader.messages <- kafka.Message{Value: chattyRecord}
+                if _, _, err := conn.ReadMessage(); err != nil {
+                    b.Fatalf("Failed to read a record: %v", err)
+                }
+            }
+        })
+    }
+}
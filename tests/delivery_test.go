@@ -0,0 +1,271 @@
+// tests/delivery_test.go
+package tests
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "my-golang-api/internal/api"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+    "github.com/segmentio/kafka-go/protocol"
+    "github.com/segmentio/kafka-go/protocol/metadata"
+    "github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// TestGetDeliveryUnknown checks that unknown delivery ids and streams are 404s.
+func TestGetDeliveryUnknown(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/deliveries/{delivery_id}", api.GetDelivery)
+    cases := []struct {
+        path, code string
+    }{
+        {"/stream/events/deliveries/0b6f5c3e-missing", api.ErrCodeDeliveryNotFound},
+        {"/stream/missing/deliveries/0b6f5c3e-missing", api.ErrCodeStreamNotFound},
+    }
+    for _, c := range cases {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != http.StatusNotFound || problem.Code != c.code {
+            t.Errorf("%s: expected 404 %s, got %d %+v", c.path, c.code, w.Code, problem)
+        }
+    }
+}
+
+// TestAsyncSendWithoutBroker checks that async sends still fail fast when no
+// producer can be created, rather than accepting records they cannot deliver.
+func TestAsyncSendWithoutBroker(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+    api.UseBrokerConfig(&api.BrokerConfig{Brokers: []string{"127.0.0.1:1"}})
+    defer api.UseBrokerConfig(&api.BrokerConfig{Brokers: []string{"localhost:9092"}})
+
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/events/send?async=true", bytes.NewBufferString(`{"data": "x"}`)), "events")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusServiceUnavailable || problem.Code != api.ErrCodeBrokerUnavailable {
+        t.Errorf("Expected 503 broker_unavailable, got %d %+v", w.Code, problem)
+    }
+}
+
+// fakeBroker answers the metadata and produce requests of writers, serving
+// every topic from a single partition and keeping the headers of the records
+// it stored. Produce requests wait while hold is set, fail with err when it
+// is set and are refused with the Kafka error code when code is set.
+type fakeBroker struct {
+    mu       sync.Mutex
+    offset   int64
+    err      error
+    code     kafka.Error
+    hold     chan struct{}
+    produced [][]kafka.Header
+}
+
+func (b *fakeBroker) RoundTrip(ctx context.Context, addr net.Addr, req protocol.Message) (protocol.Message, error) {
+    switch req := req.(type) {
+    case *metadata.Request:
+        res := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "fake", Port: 9092}}}
+        for _, topic := range req.TopicNames {
+            res.Topics = append(res.Topics, metadata.ResponseTopic{Name: topic, Partitions: []metadata.ResponsePartition{{PartitionIndex: 0, LeaderID: 1}}})
+        }
+        return res, nil
+    case *produce.Request:
+        b.mu.Lock()
+        hold, err := b.hold, b.err
+        b.mu.Unlock()
+        if hold != nil {
+            select {
+            case <-hold:
+            case <-ctx.Done():
+                return nil, ctx.Err()
+            }
+        }
+        if err != nil {
+            return nil, err
+        }
+        b.mu.Lock()
+        defer b.mu.Unlock()
+        res := &produce.Response{}
+        for _, topic := range req.Topics {
+            if b.code != 0 {
+                res.Topics = append(res.Topics, produce.ResponseTopic{Topic: topic.Topic, Partitions: []produce.ResponsePartition{{Partition: 0, ErrorCode: int16(b.code)}}})
+                continue
+            }
+            res.Topics = append(res.Topics, produce.ResponseTopic{Topic: topic.Topic, Partitions: []produce.ResponsePartition{{Partition: 0, BaseOffset: b.offset}}})
+            for _, partition := range topic.Partitions {
+                for {
+                    record, err := partition.RecordSet.Records.ReadRecord()
+                    if err != nil {
+                        break
+                    }
+                    b.produced = append(b.produced, append([]kafka.Header(nil), record.Headers...))
+                    b.offset++
+                }
+            }
+        }
+        return res, nil
+    }
+    return nil, fmt.Errorf("unexpected request %T", req)
+}
+
+// headers returns the headers of the records the broker stored.
+func (b *fakeBroker) headers() [][]kafka.Header {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return append([][]kafka.Header(nil), b.produced...)
+}
+
+// useFakeBroker makes producers created by the test write to broker.
+func useFakeBroker(t testing.TB, broker *fakeBroker) {
+    t.Helper()
+    api.UseWriterFunc(func(brokers []string, topic string, createTopic bool) *kafka.Writer {
+        return &kafka.Writer{Addr: kafka.TCP("fake:9092"), Topic: topic, Transport: broker, BatchSize: 1, MaxAttempts: 1}
+    })
+    t.Cleanup(func() {
+        api.FlushAsyncProducers()
+        api.UseWriterFunc(nil)
+    })
+}
+
+// sendAsync sends a record with ?async=true, returning the status and the
+// delivery id.
+func sendAsync(t *testing.T, streamID string) (int, string) {
+    t.Helper()
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/"+streamID+"/send?async=true", bytes.NewBufferString(`{"data": "x"}`)), streamID)
+    var accepted struct {
+        DeliveryID string `json:"delivery_id"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &accepted)
+    return w.Code, accepted.DeliveryID
+}
+
+// getDelivery returns a delivery report.
+func getDelivery(t *testing.T, streamID, deliveryID string) api.DeliveryReport {
+    t.Helper()
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/deliveries/{delivery_id}", api.GetDelivery)
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/"+streamID+"/deliveries/"+deliveryID, nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected the delivery report, got %d %s", w.Code, w.Body.String())
+    }
+    var report api.DeliveryReport
+    json.Unmarshal(w.Body.Bytes(), &report)
+    return report
+}
+
+// TestAsyncSendReportsDelivery checks that a delivered record's report
+// carries the partition and offset Kafka assigned.
+func TestAsyncSendReportsDelivery(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "async-delivered"})
+    useFakeBroker(t, &fakeBroker{offset: 41})
+
+    code, deliveryID := sendAsync(t, "async-delivered")
+    if code != http.StatusAccepted || deliveryID == "" {
+        t.Fatalf("Expected 202 with a delivery id, got %d %q", code, deliveryID)
+    }
+    var report api.DeliveryReport
+    eventually(t, "the record to be delivered", func() bool {
+        report = getDelivery(t, "async-delivered", deliveryID)
+        return report.Status != api.DeliveryPending
+    })
+    if report.Status != api.DeliveryDelivered || report.Partition == nil || *report.Partition != 0 || report.Offset == nil || *report.Offset != 41 {
+        t.Errorf("Unexpected delivery report: %+v", report)
+    }
+    if report.Durability != api.AcksAll || report.CompletedAt == nil {
+        t.Errorf("Expected the report to carry the acks level and completion time: %+v", report)
+    }
+}
+
+// defaultTenantUsage returns the usage of the tenant unauthenticated test
+// requests are billed to.
+func defaultTenantUsage(t *testing.T) api.TenantUsage {
+    t.Helper()
+    router := mux.NewRouter()
+    router.HandleFunc("/tenants/{tenant}/usage", api.GetTenantUsage)
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/tenants/default/usage", nil))
+    var usage api.TenantUsage
+    json.Unmarshal(w.Body.Bytes(), &usage)
+    return usage
+}
+
+// TestAsyncSendReportsFailure checks that a record Kafka refuses is reported
+// as failed and no longer counts against the tenant's quota.
+func TestAsyncSendReportsFailure(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "async-failed"})
+    useFakeBroker(t, &fakeBroker{err: errors.New("broker went away")})
+    before := defaultTenantUsage(t)
+
+    code, deliveryID := sendAsync(t, "async-failed")
+    if code != http.StatusAccepted {
+        t.Fatalf("Expected 202, got %d", code)
+    }
+    var report api.DeliveryReport
+    eventually(t, "the delivery to fail", func() bool {
+        report = getDelivery(t, "async-failed", deliveryID)
+        return report.Status != api.DeliveryPending
+    })
+    if report.Status != api.DeliveryFailed || report.Error == "" || report.Offset != nil {
+        t.Errorf("Unexpected delivery report: %+v", report)
+    }
+    if after := defaultTenantUsage(t); after.BytesToday != before.BytesToday || after.RecordsTotal != before.RecordsTotal {
+        t.Errorf("Expected the refused record's bytes released, usage went from %+v to %+v", before, after)
+    }
+}
+
+// TestAsyncSendShedsWhenQueueFull checks that sends beyond ASYNC_QUEUE_SIZE
+// are refused with 503 until queued records are delivered.
+func TestAsyncSendShedsWhenQueueFull(t *testing.T) {
+    t.Setenv("ASYNC_QUEUE_SIZE", "1")
+    useStreams(t, api.StreamInfo{ID: "async-shed"})
+    broker := &fakeBroker{hold: make(chan struct{})}
+    useFakeBroker(t, broker)
+
+    if code, _ := sendAsync(t, "async-shed"); code != http.StatusAccepted {
+        t.Fatalf("Expected the first record to be queued, got %d", code)
+    }
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/async-shed/send?async=true", bytes.NewBufferString(`{"data": "x"}`)), "async-shed")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusServiceUnavailable || problem.Code != api.ErrCodeProduceQueueFull {
+        t.Fatalf("Expected 503 produce_queue_full, got %d %+v", w.Code, problem)
+    }
+
+    close(broker.hold)
+    eventually(t, "the queue to drain", func() bool {
+        code, _ := sendAsync(t, "async-shed")
+        return code == http.StatusAccepted
+    })
+}
+
+// TestFlushAsyncProducers checks that flushing delivers records still
+// waiting for their batch.
+func TestFlushAsyncProducers(t *testing.T) {
+    t.Setenv("ASYNC_BATCH_TIMEOUT_MS", "600000")
+    useStreams(t, api.StreamInfo{ID: "async-flushed"})
+    useFakeBroker(t, &fakeBroker{})
+
+    _, deliveryID := sendAsync(t, "async-flushed")
+    if report := getDelivery(t, "async-flushed", deliveryID); report.Status != api.DeliveryPending {
+        t.Fatalf("Expected the record to wait for its batch, got %+v", report)
+    }
+    api.FlushAsyncProducers()
+    if report := getDelivery(t, "async-flushed", deliveryID); report.Status != api.DeliveryDelivered {
+        t.Errorf("Expected the flush to deliver the record, got %+v", report)
+    }
+}
@@ -0,0 +1,62 @@
+// tests/durability_test.go
+package tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// TestStreamSpecAcks checks validation of the durability settings.
+func TestStreamSpecAcks(t *testing.T) {
+    for _, acks := range []string{api.AcksNone, api.AcksLeader, api.AcksAll} {
+        if err := (api.StreamSpec{Acks: acks, WriteTimeoutMs: 500}).Validate(); err != nil {
+            t.Errorf("Expected acks %s to be valid, got %v", acks, err)
+        }
+    }
+    for _, spec := range []api.StreamSpec{{Acks: "quorum"}, {Acks: "1"}, {WriteTimeoutMs: -1}} {
+        if err := spec.Validate(); err == nil {
+            t.Errorf("Expected an error for %+v", spec)
+        }
+    }
+}
+
+// TestSendDataRejectsInvalidDurability checks the per-request acks and
+// timeout overrides before anything reaches Kafka.
+func TestSendDataRejectsInvalidDurability(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+
+    for _, query := range []string{"acks=quorum", "timeout_ms=0", "timeout_ms=soon", "async=true&timeout_ms=100"} {
+        w := httptest.NewRecorder()
+        api.SendData(w, httptest.NewRequest("POST", "/stream/events/send?"+query, bytes.NewBufferString(`{"data": "x"}`)), "events")
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != http.StatusBadRequest || problem.Code != api.ErrCodeInvalidRequest {
+            t.Errorf("%s: expected 400 invalid_request, got %d %+v", query, w.Code, problem)
+        }
+    }
+}
+
+// TestSendDataTimeoutDurabilityUnknown checks that a send timing out reports
+// its durability as unknown, since the broker may still write the record.
+func TestSendDataTimeoutDurabilityUnknown(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "slow-acks"})
+    broker := &fakeBroker{hold: make(chan struct{})}
+    useFakeBroker(t, broker)
+    defer close(broker.hold)
+
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/slow-acks/send?timeout_ms=50", bytes.NewBufferString(`{"data": "x"}`)), "slow-acks")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusGatewayTimeout || problem.Code != api.ErrCodeBrokerTimeout {
+        t.Fatalf("Expected 504 broker_timeout, got %d %+v", w.Code, problem)
+    }
+    if !strings.Contains(problem.Detail, "durability unknown") {
+        t.Errorf("Expected the detail to say the durability is unknown, got %q", problem.Detail)
+    }
+}
@@ -0,0 +1,136 @@
+// tests/errors_test.go
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/websocket"
+    "github.com/segmentio/kafka-go"
+)
+
+// TestWriteErrorProblemJSON checks that errors are sent as RFC 7807 problems
+// carrying the error code and request id.
+func TestWriteErrorProblemJSON(t *testing.T) {
+    handler := api.RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        api.WriteError(w, r, api.NewAPIError(http.StatusTooManyRequests, api.ErrCodeRateLimited, "slow down"))
+    }))
+    req := httptest.NewRequest("POST", "/stream/orders/send", nil)
+    req.Header.Set("X-Request-ID", "req-1")
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, req)
+
+    if w.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected status 429, got %v", w.Code)
+    }
+    if ct := w.Header().Get("Content-Type"); ct != api.ProblemContentType {
+        t.Errorf("Expected content type %s, got %s", api.ProblemContentType, ct)
+    }
+    var problem api.Problem
+    if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+        t.Fatalf("Failed to parse problem: %v", err)
+    }
+    if problem.Code != api.ErrCodeRateLimited || problem.Status != 429 || problem.RequestID != "req-1" || problem.Instance != "/stream/orders/send" {
+        t.Errorf("Unexpected problem %+v", problem)
+    }
+}
+
+// TestWriteErrorHidesInternalErrors checks that unclassified errors become a
+// generic 500 without leaking their text.
+func TestWriteErrorHidesInternalErrors(t *testing.T) {
+    w := httptest.NewRecorder()
+    api.WriteError(w, httptest.NewRequest("GET", "/", nil), errors.New("secret broker address 10.0.0.1"))
+
+    var problem api.Problem
+    if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+        t.Fatalf("Failed to parse problem: %v", err)
+    }
+    if w.Code != http.StatusInternalServerError || problem.Code != api.ErrCodeInternal {
+        t.Errorf("Expected internal_error 500, got %v %+v", w.Code, problem)
+    }
+    if problem.Detail == "secret broker address 10.0.0.1" {
+        t.Errorf("Expected internal error text to be hidden")
+    }
+}
+
+// failingReader fails every read with a broker error naming internal hosts.
+type failingReader struct {
+    memoryReader
+}
+
+func (r *failingReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+    return kafka.Message{}, errors.New("dial tcp broker-3.internal:9093: connection refused")
+}
+
+func (r *failingReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+    return r.FetchMessage(ctx)
+}
+
+// TestGetResultsHidesReadErrors checks that subscribers are told reading
+// failed with the request id, without the broker's error text.
+func TestGetResultsHidesReadErrors(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "unreadable"})
+    api.UseGroupReader(func(*api.StreamInfo, string) api.CommittingReader { return &failingReader{} })
+    t.Cleanup(func() { api.UseGroupReader(nil) })
+
+    router := mux.NewRouter()
+    router.Use(api.RequestIDMiddleware())
+    router.HandleFunc("/stream/{stream_id}/results", api.GetResults)
+    server := httptest.NewServer(router)
+    defer server.Close()
+
+    header := http.Header{}
+    header.Set("X-Request-ID", "req-unreadable")
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[len("http"):]+"/stream/unreadable/results", header)
+    if err != nil {
+        t.Fatalf("Failed to subscribe: %v", err)
+    }
+    defer conn.Close()
+    conn.ReadMessage() // subscription status
+    _, message, err := conn.ReadMessage()
+    if err != nil {
+        t.Fatalf("Failed to read the error status: %v", err)
+    }
+    if got := string(message); got != "Error reading messages (request ID req-unreadable)" || strings.Contains(got, "broker-3") {
+        t.Errorf("Unexpected error status %q", got)
+    }
+}
+
+// TestSendDataMapsBrokerErrors checks that produce error codes brokers answer
+// with, which writers return wrapped in kafka.WriteErrors, map to their
+// status and code.
+func TestSendDataMapsBrokerErrors(t *testing.T) {
+    cases := []struct {
+        code   kafka.Error
+        status int
+        api    string
+    }{
+        {kafka.MessageSizeTooLarge, http.StatusRequestEntityTooLarge, api.ErrCodePayloadTooLarge},
+        {kafka.NotEnoughReplicas, http.StatusServiceUnavailable, api.ErrCodeBrokerUnavailable},
+        {kafka.TopicAuthorizationFailed, http.StatusBadGateway, api.ErrCodeBrokerUnauthorized},
+        {kafka.InvalidRecord, http.StatusBadGateway, api.ErrCodeBrokerError},
+    }
+    for _, c := range cases {
+        t.Run(c.api, func(t *testing.T) {
+            // Producers are kept per stream, so each case sends to its own
+            streamID := "refused-" + c.api
+            useStreams(t, api.StreamInfo{ID: streamID})
+            useFakeBroker(t, &fakeBroker{code: c.code})
+            w := httptest.NewRecorder()
+            api.SendData(w, httptest.NewRequest("POST", "/stream/"+streamID+"/send", strings.NewReader(`{"data": "x"}`)), streamID)
+
+            var problem api.Problem
+            json.Unmarshal(w.Body.Bytes(), &problem)
+            if w.Code != c.status || problem.Code != c.api {
+                t.Errorf("%v: expected %d %s, got %d %+v", c.code, c.status, c.api, w.Code, problem)
+            }
+        })
+    }
+}
@@ -0,0 +1,59 @@
+// tests/headers_test.go
+package tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gorilla/mux"
+)
+
+// TestSendDataRejectsInvalidHeaders checks that custom record headers are
+// validated before anything reaches Kafka.
+func TestSendDataRejectsInvalidHeaders(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+
+    cases := []struct {
+        name, body, httpHeader string
+    }{
+        {"server header in body", `{"data": "x", "headers": {"content-type": "text/csv"}}`, ""},
+        {"server header over HTTP", `{"data": "x"}`, api.CustomHeaderPrefix + "Produced-At"},
+        {"trace header", `{"data": "x", "headers": {"traceparent": "00"}}`, ""},
+        {"invalid name", `{"data": "x", "headers": {"source system": "billing"}}`, ""},
+        {"non-string value", `{"data": "x", "headers": {"attempt": 1}}`, ""},
+    }
+    for _, c := range cases {
+        req := httptest.NewRequest("POST", "/stream/events/send", bytes.NewBufferString(c.body))
+        if c.httpHeader != "" {
+            req.Header.Set(c.httpHeader, "2024-01-01T00:00:00Z")
+        }
+        w := httptest.NewRecorder()
+        api.SendData(w, req, "events")
+
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != http.StatusBadRequest || problem.Code != api.ErrCodeInvalidRequest {
+            t.Errorf("%s: expected 400 invalid_request, got %d %+v", c.name, w.Code, problem)
+        }
+    }
+}
+
+// TestGetResultsRejectsInvalidHeadersOption checks that headers envelopes are
+// only offered to text subscribers, before the websocket upgrade.
+func TestGetResultsRejectsInvalidHeadersOption(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/results", api.GetResults).Methods("GET")
+
+    for _, query := range []string{"headers=maybe", "headers=true&frames=binary"} {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/events/results?"+query, nil))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected 400, got %d", query, w.Code)
+        }
+    }
+}
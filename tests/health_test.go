@@ -0,0 +1,45 @@
+// tests/health_test.go
+package tests
+
+import (
+    "encoding/json"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// TestHealthz checks the liveness endpoint.
+func TestHealthz(t *testing.T) {
+    w := httptest.NewRecorder()
+    api.Healthz(w, httptest.NewRequest("GET", "/healthz", nil))
+
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected status OK, got %v", w.Code)
+    }
+}
+
+// TestReadyzReportsUnreachableBroker checks that readiness fails with
+// per-check details when the broker cannot be reached or the server is draining.
+func TestReadyzReportsUnreachableBroker(t *testing.T) {
+    api.UseBrokerConfig(&api.BrokerConfig{Brokers: []string{"127.0.0.1:1"}})
+    defer api.UseBrokerConfig(&api.BrokerConfig{Brokers: []string{"localhost:9092"}})
+    api.SetDraining(true)
+    defer api.SetDraining(false)
+
+    w := httptest.NewRecorder()
+    api.Readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+
+    if w.Code != http.StatusServiceUnavailable {
+        t.Errorf("Expected status 503, got %v", w.Code)
+    }
+    var report api.ReadinessReport
+    if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+        t.Fatalf("Failed to parse readiness report: %v", err)
+    }
+    for _, name := range []string{"broker", "draining"} {
+        if check := report.Checks[name]; check.Status != "fail" || check.Detail == "" {
+            t.Errorf("Expected failing %s check with detail, got %+v", name, check)
+        }
+    }
+}
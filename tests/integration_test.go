@@ -15,7 +15,6 @@ import (
 
 // TestStartStreamEndpoint tests the /stream/start endpoint for initiating a new stream.
 func TestStartStreamEndpoint(t *testing.T) {
-	api.RegisterMetrics()
     req := httptest.NewRequest("POST", "/stream/start", nil)
     w := httptest.NewRecorder()
     handler := http.HandlerFunc(api.StartStream)
@@ -41,7 +40,6 @@ func TestStartStreamEndpoint(t *testing.T) {
 
 
 func TestSendDataEndpoint(t *testing.T) {
-	api.RegisterMetrics()
 
     // Step 1: Start a new stream
     startReq := httptest.NewRequest("POST", "/stream/start", nil)
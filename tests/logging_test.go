@@ -0,0 +1,37 @@
+// tests/logging_test.go
+package tests
+
+import (
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// TestRequestIDMiddleware checks that a valid incoming request id is kept and
+// a malformed one is replaced, and that the id reaches handlers and responses.
+func TestRequestIDMiddleware(t *testing.T) {
+    var seen string
+    handler := api.RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        seen = api.RequestIDFromContext(r.Context())
+    }))
+
+    req := httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("X-Request-ID", "client-id-123")
+    w := httptest.NewRecorder()
+    handler.ServeHTTP(w, req)
+    if seen != "client-id-123" || w.Header().Get("X-Request-ID") != "client-id-123" {
+        t.Errorf("Expected incoming request id to be kept, got %q / %q", seen, w.Header().Get("X-Request-ID"))
+    }
+
+    req = httptest.NewRequest("GET", "/", nil)
+    req.Header.Set("X-Request-ID", "bad id\nwith newline")
+    w = httptest.NewRecorder()
+    handler.ServeHTTP(w, req)
+    if seen == "" || seen == "bad id\nwith newline" {
+        t.Errorf("Expected malformed request id to be replaced, got %q", seen)
+    }
+    if w.Header().Get("X-Request-ID") != seen {
+        t.Errorf("Expected response header %q, got %q", seen, w.Header().Get("X-Request-ID"))
+    }
+}
@@ -0,0 +1,147 @@
+// tests/metrics_test.go
+package tests
+
+import (
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+)
+
+// TestInstrumentationMiddlewareRouteLabel checks that requests are labeled by
+// route template rather than by the raw path containing the stream id.
+func TestInstrumentationMiddlewareRouteLabel(t *testing.T) {
+    metrics := api.NewMetrics(api.MetricsOptions{})
+    router := mux.NewRouter()
+    router.Use(metrics.Middleware())
+    router.HandleFunc("/stream/{stream_id}/send", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusAccepted)
+    }).Methods("POST")
+
+    for _, id := range []string{"a", "b", "c"} {
+        router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/stream/"+id+"/send", nil))
+    }
+
+    got, err := metrics.Value("http_requests_total", "route", "/stream/{stream_id}/send", "status", "202")
+    if err != nil {
+        t.Fatalf("Failed to read http_requests_total: %v", err)
+    }
+    if got != 3 {
+        t.Errorf("Expected 3 requests for the route template, got %v", got)
+    }
+}
+
+// TestInstrumentationMiddlewareUnmatched checks that requests no route
+// matches are counted under the "unmatched" route when the not found and
+// method not allowed handlers are instrumented.
+func TestInstrumentationMiddlewareUnmatched(t *testing.T) {
+    metrics := api.NewMetrics(api.MetricsOptions{})
+    router := mux.NewRouter()
+    router.Use(metrics.Middleware())
+    router.NotFoundHandler = metrics.Middleware()(api.NotFoundHandler())
+    router.MethodNotAllowedHandler = metrics.Middleware()(api.MethodNotAllowedHandler())
+    router.HandleFunc("/stream/start", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+
+    router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nowhere", nil))
+    router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stream/start", nil))
+
+    for _, status := range []string{"404", "405"} {
+        if got, err := metrics.Value("http_requests_total", "route", "unmatched", "status", status); err != nil || got != 1 {
+            t.Errorf("Expected one unmatched %s request, got %v (%v)", status, got, err)
+        }
+    }
+}
+
+// TestMetricsAreIndependent checks that each Metrics instance has its own
+// registry, so tests never share or double-register collectors.
+func TestMetricsAreIndependent(t *testing.T) {
+    first := api.NewMetrics(api.MetricsOptions{})
+    second := api.NewMetrics(api.MetricsOptions{RuntimeCollectors: true})
+    previous := api.UseMetrics(first)
+    defer api.UseMetrics(previous)
+
+    qm := api.NewQuotaManager(1024, 1024, 0, 0)
+    if err := qm.Reserve("acme", 42); err != nil {
+        t.Fatalf("Reserve failed: %v", err)
+    }
+
+    if got, err := first.Value("tenant_ingest_bytes_total", "tenant", "acme"); err != nil || got != 42 {
+        t.Errorf("Expected 42 bytes recorded on the injected metrics, got %v (%v)", got, err)
+    }
+    if _, err := second.Value("tenant_ingest_bytes_total", "tenant", "acme"); err == nil {
+        t.Errorf("Expected no series on an unrelated Metrics instance")
+    }
+}
+
+// TestUseMetricsWhileRecording checks that metrics can be swapped while
+// requests record into them; run with -race.
+func TestUseMetricsWhileRecording(t *testing.T) {
+    previous := api.UseMetrics(api.NewMetrics(api.MetricsOptions{}))
+    defer api.UseMetrics(previous)
+
+    qm := api.NewQuotaManager(1024, 1024, 0, 0)
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 100; i++ {
+            qm.Reserve("acme", 1)
+        }
+    }()
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 100; i++ {
+            api.UseMetrics(api.NewMetrics(api.MetricsOptions{}))
+        }
+    }()
+    wg.Wait()
+}
+
+// TestProducerErrorCauseLabel checks that sync sends the broker refuses are
+// counted under the cause of the broker's error code.
+func TestProducerErrorCauseLabel(t *testing.T) {
+    metrics := api.NewMetrics(api.MetricsOptions{})
+    previous := api.UseMetrics(metrics)
+    defer api.UseMetrics(previous)
+    useStreams(t, api.StreamInfo{ID: "refused-cause"})
+    useFakeBroker(t, &fakeBroker{code: kafka.NotEnoughReplicas})
+
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/refused-cause/send", strings.NewReader(`{"data": "x"}`)), "refused-cause")
+    if w.Code != http.StatusServiceUnavailable {
+        t.Fatalf("Expected 503, got %d %s", w.Code, w.Body.String())
+    }
+    if got, err := metrics.Value("kafka_producer_errors_total", "stream", "refused-cause", "cause", "broker_unavailable"); err != nil || got != 1 {
+        t.Errorf("Expected one broker_unavailable error, got %v (%v)", got, err)
+    }
+}
+
+// TestStreamManagerMetrics checks that a stream manager given its own metrics
+// records into them rather than into the installed instance.
+func TestStreamManagerMetrics(t *testing.T) {
+    installed := api.NewMetrics(api.MetricsOptions{})
+    previous := api.UseMetrics(installed)
+    defer api.UseMetrics(previous)
+    useFakeBroker(t, &fakeBroker{})
+
+    own := api.NewMetrics(api.MetricsOptions{})
+    sm := api.NewStreamManager(own)
+    if sm.CreateProducer([]string{"fake:9092"}, "own-metrics", "") == nil {
+        t.Fatal("Expected a producer")
+    }
+    if got, err := own.Value("active_streams"); err != nil || got != 1 {
+        t.Errorf("Expected one active stream in the manager's metrics, got %v (%v)", got, err)
+    }
+    if got, _ := installed.Value("active_streams"); got != 0 {
+        t.Errorf("Expected nothing recorded into the installed metrics, got %v", got)
+    }
+    sm.CloseStream("own-metrics")
+    if got, _ := own.Value("active_streams"); got != 0 {
+        t.Errorf("Expected the stream to be closed, got %v", got)
+    }
+}
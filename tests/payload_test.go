@@ -0,0 +1,82 @@
+// tests/payload_test.go
+package tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// orderProtoRecord is Order{id: 7, item: "book"} in the protobuf encoding.
+var orderProtoRecord = []byte{0x08, 0x07, 0x12, 0x04, 'b', 'o', 'o', 'k'}
+
+// TestEncodeBinaryRecord checks that protobuf-encoded records are validated,
+// framed and decode like records sent as JSON.
+func TestEncodeBinaryRecord(t *testing.T) {
+    store := useLocalSchemaStore(t)
+    proto, _ := store.Register("orders-value", api.Schema{Type: api.SchemaTypeProtobuf, Definition: orderProtoSchema})
+    framed, err := api.EncodeBinaryRecord(proto.ID, orderProtoRecord)
+    if err != nil {
+        t.Fatalf("Failed to encode protobuf record: %v", err)
+    }
+    decoded, err := api.DecodeRecord(framed)
+    if err != nil {
+        t.Fatalf("Failed to decode protobuf record: %v", err)
+    }
+    var fields map[string]interface{}
+    if err := json.Unmarshal(decoded, &fields); err != nil || fields["id"] != "7" || fields["item"] != "book" {
+        t.Errorf("Unexpected decoded record %s", decoded)
+    }
+    if _, err := api.EncodeBinaryRecord(proto.ID, []byte{0x12, 0x10}); !errors.Is(err, api.ErrSchemaMismatch) {
+        t.Errorf("Expected ErrSchemaMismatch for a truncated message, got %v", err)
+    }
+
+    avro, _ := store.Register("invoices-value", api.Schema{Type: api.SchemaTypeAvro, Definition: orderAvroSchema})
+    if _, err := api.EncodeBinaryRecord(avro.ID, orderProtoRecord); !errors.Is(err, api.ErrSchemaMismatch) {
+        t.Errorf("Expected ErrSchemaMismatch for binary Avro records, got %v", err)
+    }
+}
+
+// TestSendDataContentTypes checks content type negotiation on send before
+// anything reaches Kafka.
+func TestSendDataContentTypes(t *testing.T) {
+    schemas := useLocalSchemaStore(t)
+    proto, _ := schemas.Register("orders-value", api.Schema{Type: api.SchemaTypeProtobuf, Definition: orderProtoSchema})
+    avro, _ := schemas.Register("invoices-value", api.Schema{Type: api.SchemaTypeAvro, Definition: orderAvroSchema})
+
+    useStreams(t,
+        api.StreamInfo{ID: "events"},
+        api.StreamInfo{ID: "orders", Schema: &api.StreamSchema{Subject: "orders-value", ID: proto.ID, Version: 1, Type: api.SchemaTypeProtobuf}},
+        api.StreamInfo{ID: "invoices", Schema: &api.StreamSchema{Subject: "invoices-value", ID: avro.ID, Version: 1, Type: api.SchemaTypeAvro}},
+    )
+
+    cases := []struct {
+        stream, contentType string
+        body                []byte
+        status              int
+        code                string
+    }{
+        {"events", "text/xml", []byte("<data/>"), http.StatusUnsupportedMediaType, api.ErrCodeUnsupportedMediaType},
+        {"events", "application/json; charset", []byte(`{"data": "x"}`), http.StatusUnsupportedMediaType, api.ErrCodeUnsupportedMediaType},
+        {"events", api.ContentTypeBinary, nil, http.StatusBadRequest, api.ErrCodeInvalidRequest},
+        {"invoices", api.ContentTypeBinary, orderProtoRecord, http.StatusUnsupportedMediaType, api.ErrCodeUnsupportedMediaType},
+        {"orders", api.ContentTypeMsgpack, orderProtoRecord, http.StatusUnsupportedMediaType, api.ErrCodeUnsupportedMediaType},
+        {"orders", api.ContentTypeProtobuf, []byte{0x12, 0x10}, http.StatusUnprocessableEntity, api.ErrCodeSchemaMismatch},
+    }
+    for _, c := range cases {
+        req := httptest.NewRequest("POST", "/stream/"+c.stream+"/send", bytes.NewReader(c.body))
+        req.Header.Set("Content-Type", c.contentType)
+        w := httptest.NewRecorder()
+        api.SendData(w, req, c.stream)
+
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != c.status || problem.Code != c.code {
+            t.Errorf("%s to %s: expected %d %s, got %d %+v", c.contentType, c.stream, c.status, c.code, w.Code, problem)
+        }
+    }
+}
@@ -0,0 +1,131 @@
+// tests/quota_test.go
+package tests
+
+import (
+    "bytes"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/gorilla/mux"
+)
+
+// TestQuotaManagerDailyBytes checks that the daily byte quota is enforced per tenant.
+func TestQuotaManagerDailyBytes(t *testing.T) {
+    qm := api.NewQuotaManager(1024, 1024, 0, 100)
+
+    if err := qm.Reserve("acme", 60); err != nil {
+        t.Fatalf("Expected first reservation to succeed, got %v", err)
+    }
+    if err := qm.Reserve("acme", 60); err == nil {
+        t.Errorf("Expected second reservation to exceed the daily quota")
+    }
+    if err := qm.Reserve("globex", 60); err != nil {
+        t.Errorf("Expected another tenant to have its own quota, got %v", err)
+    }
+
+    usage := qm.Usage("acme")
+    if usage.BytesToday != 60 || usage.RecordsTotal != 1 || usage.RejectedRecords != 1 {
+        t.Errorf("Unexpected usage for acme: %+v", usage)
+    }
+}
+
+// TestSendDataRejectsOversizedBody checks that bodies over the limit return 413
+// before a producer is created.
+func TestSendDataRejectsOversizedBody(t *testing.T) {
+    payload := `{"data": "` + strings.Repeat("x", 2<<20) + `"}`
+    api.SetStreamAutoCreate(true)
+    defer api.SetStreamAutoCreate(false)
+    req := httptest.NewRequest("POST", "/stream/oversized/send", bytes.NewBufferString(payload))
+    w := httptest.NewRecorder()
+
+    api.SendData(w, req, "oversized")
+
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("Expected status 413, got %v", w.Code)
+    }
+}
+
+// TestQuotaManagerRelease checks that released bytes no longer count against
+// the daily quota.
+func TestQuotaManagerRelease(t *testing.T) {
+    qm := api.NewQuotaManager(1024, 1024, 0, 100)
+
+    if err := qm.Reserve("acme", 60); err != nil {
+        t.Fatalf("Expected the reservation to succeed, got %v", err)
+    }
+    qm.Release("acme", 60)
+    if err := qm.Reserve("acme", 60); err != nil {
+        t.Errorf("Expected released bytes to be available again, got %v", err)
+    }
+    if usage := qm.Usage("acme"); usage.BytesToday != 60 || usage.BytesTotal != 60 || usage.RecordsTotal != 1 {
+        t.Errorf("Unexpected usage after release: %+v", usage)
+    }
+}
+
+// TestTenantMapper checks principal to tenant mappings.
+func TestTenantMapper(t *testing.T) {
+    mapper, err := api.NewTenantMapper("apikey:1a2b3c4d=acme, payments=globex")
+    if err != nil {
+        t.Fatalf("Failed to parse mappings: %v", err)
+    }
+    for principal, want := range map[string]string{"apikey:1a2b3c4d": "acme", "payments": "globex", "apikey:ffffffff": "default", "anonymous": "default"} {
+        if got := mapper.Tenant(principal); got != want {
+            t.Errorf("%s: expected tenant %s, got %s", principal, want, got)
+        }
+    }
+    for _, spec := range []string{"acme", "=acme", "payments=", "payments=bad tenant"} {
+        if _, err := api.NewTenantMapper(spec); err == nil {
+            t.Errorf("Expected an error for %q", spec)
+        }
+    }
+}
+
+// TestGetTenantUsageIsScopedToCaller checks that the usage endpoint only
+// reports the caller's own tenant, whatever tenant header it sends.
+func TestGetTenantUsageIsScopedToCaller(t *testing.T) {
+    mapper, _ := api.NewTenantMapper("apikey:1a2b3c4d=acme")
+    api.UseTenantMapper(mapper)
+    t.Cleanup(func() { api.UseTenantMapper(&api.TenantMapper{}) })
+    router := mux.NewRouter()
+    router.HandleFunc("/tenants/{tenant}/usage", api.GetTenantUsage)
+
+    get := func(tenant string) int {
+        req := httptest.NewRequest("GET", "/tenants/"+tenant+"/usage", nil)
+        req.Header.Set("X-Tenant-ID", tenant)
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, api.WithPrincipal(req, "apikey:1a2b3c4d"))
+        return w.Code
+    }
+    if code := get("acme"); code != http.StatusOK {
+        t.Errorf("Expected the caller's tenant usage, got %d", code)
+    }
+    if code := get("globex"); code != http.StatusForbidden {
+        t.Errorf("Expected another tenant's usage to be forbidden, got %d", code)
+    }
+}
+
+// TestQuotaBurstCoversLargestRecord checks that without MAX_RECORD_BYTES the
+// bytes-per-second bucket holds a record of MAX_BODY_BYTES, and that records
+// no bucket can hold are refused with 413 rather than 429.
+func TestQuotaBurstCoversLargestRecord(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "burst"})
+    useFakeBroker(t, &fakeBroker{})
+    t.Cleanup(func() { api.UseQuotaManager(api.NewQuotaManagerFromEnv()) })
+    send := func() int {
+        w := httptest.NewRecorder()
+        api.SendData(w, httptest.NewRequest("POST", "/stream/burst/send", bytes.NewBufferString(`{"data": "`+strings.Repeat("x", 100)+`"}`)), "burst")
+        return w.Code
+    }
+
+    api.UseQuotaManager(api.NewQuotaManager(1024, 0, 16, 0))
+    if code := send(); code != http.StatusOK {
+        t.Errorf("Expected a record under MAX_BODY_BYTES to be admitted, got %d", code)
+    }
+    api.UseQuotaManager(api.NewQuotaManager(0, 0, 16, 0))
+    if code := send(); code != http.StatusRequestEntityTooLarge {
+        t.Errorf("Expected a record over the bucket to be refused with 413, got %d", code)
+    }
+}
@@ -0,0 +1,65 @@
+// tests/ratelimiter_test.go
+package tests
+
+import (
+    "context"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/alicebob/miniredis/v2"
+    "github.com/redis/go-redis/v9"
+)
+
+// TestRedisRateLimitStoreSharedBudget checks that two stores pointing at the same
+// server share a single budget, as two API replicas would.
+func TestRedisRateLimitStoreSharedBudget(t *testing.T) {
+    server := miniredis.RunT(t)
+
+    replicaA := api.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), 1, 2)
+    replicaB := api.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), 1, 2)
+
+    allowed := 0
+    for i := 0; i < 3; i++ {
+        for _, store := range []api.RateLimitStore{replicaA, replicaB} {
+            ok, err := store.Allow(context.Background(), "global")
+            if err != nil {
+                t.Fatalf("Allow returned error: %v", err)
+            }
+            if ok {
+                allowed++
+            }
+        }
+    }
+
+    // A burst of 2 at 1 req/s admits exactly two immediate requests in total.
+    if allowed != 2 {
+        t.Errorf("Expected 2 requests admitted across replicas, got %d", allowed)
+    }
+}
+
+// TestRateLimiterFailModes checks the middleware behavior when the store is unreachable.
+func TestRateLimiterFailModes(t *testing.T) {
+    server := miniredis.RunT(t)
+    store := api.NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1}), 5, 10)
+    server.Close()
+
+    next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    })
+
+    for _, tc := range []struct {
+        failOpen bool
+        want     int
+    }{
+        {failOpen: true, want: http.StatusOK},
+        {failOpen: false, want: http.StatusServiceUnavailable},
+    } {
+        w := httptest.NewRecorder()
+        api.RateLimiterMiddlewareWithStore(store, tc.failOpen)(next).ServeHTTP(w, httptest.NewRequest("POST", "/stream/start", nil))
+        if w.Code != tc.want {
+            t.Errorf("failOpen=%v: expected status %d, got %d", tc.failOpen, tc.want, w.Code)
+        }
+    }
+}
@@ -0,0 +1,372 @@
+// tests/routes_test.go
+package tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+)
+
+// TestRouteRequestValidate checks routing rule validation.
+func TestRouteRequestValidate(t *testing.T) {
+    valid := api.RouteRequest{
+        Targets:   []string{"alerts", "audit"},
+        Match:     api.RouteMatch{Headers: map[string]string{"tenant": "acme"}, Fields: map[string]interface{}{"error.level": "fatal"}},
+        Transform: &api.RouteTransform{Select: []string{"error"}, SetHeaders: map[string]string{"source": "orders"}},
+    }
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Expected a valid rule, got %v", err)
+    }
+    invalid := []api.RouteRequest{
+        {},
+        {Targets: []string{"alerts", "alerts"}},
+        {Targets: []string{"bad stream"}},
+        {Targets: []string{"alerts"}, Match: api.RouteMatch{Headers: map[string]string{"bad key": "x"}}},
+        {Targets: []string{"alerts"}, Match: api.RouteMatch{Fields: map[string]interface{}{"error..level": "x"}}},
+        {Targets: []string{"alerts"}, Transform: &api.RouteTransform{SetHeaders: map[string]string{api.RouteHopsHeader: "0"}}},
+        {Targets: []string{"alerts"}, Transform: &api.RouteTransform{Select: []string{""}}},
+    }
+    for _, request := range invalid {
+        if err := request.Validate(); err == nil {
+            t.Errorf("Expected an error for %+v", request)
+        }
+    }
+}
+
+func routeRouter() *mux.Router {
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/routes", api.CreateRoute).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/routes", api.ListRoutes).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}", api.GetRoute).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}", api.DeleteRoute).Methods("DELETE")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}/pause", api.PauseRoute).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/routes/{route_id}/resume", api.ResumeRoute).Methods("POST")
+    return router
+}
+
+// TestCreateRouteRejectsTargets checks that rules only route and dead-letter
+// into writable streams of the same tenant, dead-lettering into streams
+// without a schema.
+func TestCreateRouteRejectsTargets(t *testing.T) {
+    useStreams(t,
+        api.StreamInfo{ID: "orders"},
+        api.StreamInfo{ID: "external", Topic: "external", ReadOnly: true},
+        api.StreamInfo{ID: "other", Tenant: "globex"},
+        api.StreamInfo{ID: "alerts"},
+        api.StreamInfo{ID: "typed", Schema: &api.StreamSchema{Subject: "typed-value", ID: 1, Version: 1, Type: api.SchemaTypeJSON}},
+    )
+
+    router := routeRouter()
+    for _, target := range []string{"orders", "missing", "external", "other"} {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("POST", "/stream/orders/routes", bytes.NewBufferString(`{"targets": ["`+target+`"]}`)))
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != http.StatusBadRequest || problem.Code != api.ErrCodeInvalidRequest {
+            t.Errorf("%s: expected 400 invalid_request, got %d %+v", target, w.Code, problem)
+        }
+    }
+    for _, deadLetter := range []string{"orders", "missing", "external", "other", "typed", "alerts"} {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("POST", "/stream/orders/routes", bytes.NewBufferString(`{"targets": ["alerts"], "dead_letter": "`+deadLetter+`"}`)))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("dead letter %s: expected 400, got %d %s", deadLetter, w.Code, w.Body.String())
+        }
+    }
+}
+
+// TestRouteLifecycle creates, pauses, resumes and deletes a routing rule,
+// checking the paused state is persisted.
+func TestRouteLifecycle(t *testing.T) {
+    useStreams(t,
+        api.StreamInfo{ID: "orders"},
+        api.StreamInfo{ID: "alerts"},
+    )
+    path := filepath.Join(t.TempDir(), "routes.json")
+    routes, err := api.NewRouteManager(path)
+    if err != nil {
+        t.Fatalf("Failed to open route store: %v", err)
+    }
+    api.UseRoutes(routes)
+    defer routes.Close()
+
+    router := routeRouter()
+    do := func(method, path, body string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+        return w
+    }
+
+    w := do("POST", "/stream/orders/routes", `{"targets": ["alerts"], "match": {"fields": {"level": "error"}}}`)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+    }
+    var rule api.RouteView
+    json.Unmarshal(w.Body.Bytes(), &rule)
+    if rule.ID == "" || rule.StreamID != "orders" || rule.Paused || len(rule.Targets) != 1 {
+        t.Errorf("Unexpected rule %+v", rule)
+    }
+
+    w = do("POST", "/stream/orders/routes/"+rule.ID+"/pause", "")
+    json.Unmarshal(w.Body.Bytes(), &rule)
+    if w.Code != http.StatusOK || !rule.Paused {
+        t.Errorf("Expected a paused rule, got %d %s", w.Code, w.Body.String())
+    }
+    if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"paused": true`) {
+        t.Errorf("Expected the paused state to be persisted, got %s", data)
+    }
+    w = do("POST", "/stream/orders/routes/"+rule.ID+"/resume", "")
+    json.Unmarshal(w.Body.Bytes(), &rule)
+    if w.Code != http.StatusOK || rule.Paused {
+        t.Errorf("Expected a resumed rule, got %d %s", w.Code, w.Body.String())
+    }
+
+    var list struct {
+        Routes []api.RouteView `json:"routes"`
+    }
+    w = do("GET", "/stream/orders/routes", "")
+    json.Unmarshal(w.Body.Bytes(), &list)
+    if w.Code != http.StatusOK || len(list.Routes) != 1 || list.Routes[0].ID != rule.ID {
+        t.Errorf("Expected the rule to be listed, got %d %s", w.Code, w.Body.String())
+    }
+    if w = do("GET", "/stream/alerts/routes/"+rule.ID, ""); w.Code != http.StatusNotFound {
+        t.Errorf("Expected the rule not to be found under its target, got %d", w.Code)
+    }
+
+    if w = do("DELETE", "/stream/orders/routes/"+rule.ID, ""); w.Code != http.StatusNoContent {
+        t.Errorf("Expected 204, got %d", w.Code)
+    }
+    w = do("POST", "/stream/orders/routes/"+rule.ID+"/pause", "")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusNotFound || problem.Code != api.ErrCodeRouteNotFound {
+        t.Errorf("Expected 404 route_not_found, got %d %+v", w.Code, problem)
+    }
+}
+
+// routeRecord is a record of stream "orders" with the given payload and headers.
+func routeRecord(value string, headers ...string) kafka.Message {
+    m := kafka.Message{Key: []byte("k"), Value: []byte(value)}
+    for i := 0; i+1 < len(headers); i += 2 {
+        m.Headers = append(m.Headers, kafka.Header{Key: headers[i], Value: []byte(headers[i+1])})
+    }
+    return m
+}
+
+// TestRouteRuleMatches checks header predicates, dot-path field predicates and
+// that numbers compare by value, as rules decoded from JSON hold float64s.
+func TestRouteRuleMatches(t *testing.T) {
+    info := &api.StreamInfo{ID: "orders"}
+    var decoded api.RouteMatch
+    json.Unmarshal([]byte(`{"fields": {"error.code": 5}}`), &decoded)
+
+    cases := []struct {
+        name   string
+        match  api.RouteMatch
+        record kafka.Message
+        want   api.RouteResult
+    }{
+        {"empty match", api.RouteMatch{}, routeRecord("not json"), api.RouteMatched},
+        {"nested field", api.RouteMatch{Fields: map[string]interface{}{"error.level": "fatal"}}, routeRecord(`{"error": {"level": "fatal"}}`), api.RouteMatched},
+        {"nested field differs", api.RouteMatch{Fields: map[string]interface{}{"error.level": "fatal"}}, routeRecord(`{"error": {"level": "warn"}}`), api.RouteSkipped},
+        {"path through a scalar", api.RouteMatch{Fields: map[string]interface{}{"error.level": "fatal"}}, routeRecord(`{"error": "fatal"}`), api.RouteSkipped},
+        {"field on a non-JSON record", api.RouteMatch{Fields: map[string]interface{}{"level": "fatal"}}, routeRecord("level=fatal"), api.RouteSkipped},
+        {"integer against JSON number", api.RouteMatch{Fields: map[string]interface{}{"count": 5}}, routeRecord(`{"count": 5.0}`), api.RouteMatched},
+        {"decoded rule number", decoded, routeRecord(`{"error": {"code": 5}}`), api.RouteMatched},
+        {"number against string", decoded, routeRecord(`{"error": {"code": "5"}}`), api.RouteSkipped},
+        {"object field", api.RouteMatch{Fields: map[string]interface{}{"error": map[string]interface{}{"code": 5}}}, routeRecord(`{"error": {"code": 5}}`), api.RouteMatched},
+        {"header", api.RouteMatch{Headers: map[string]string{"tenant": "acme"}}, routeRecord("x", "tenant", "acme"), api.RouteMatched},
+        {"header differs", api.RouteMatch{Headers: map[string]string{"tenant": "acme"}}, routeRecord("x", "tenant", "globex"), api.RouteSkipped},
+        {"header missing", api.RouteMatch{Headers: map[string]string{"tenant": "acme"}}, routeRecord("x"), api.RouteSkipped},
+    }
+    for _, c := range cases {
+        rule := api.RouteRule{ID: "r1", StreamID: "orders", Targets: []string{"alerts"}, Match: c.match}
+        if _, result, err := rule.Apply(info, c.record); result != c.want || err != nil {
+            t.Errorf("%s: expected result %d, got %d (%v)", c.name, c.want, result, err)
+        }
+    }
+}
+
+// TestRouteRuleTransforms checks the payload and headers of routed records.
+func TestRouteRuleTransforms(t *testing.T) {
+    info := &api.StreamInfo{ID: "orders"}
+    rule := api.RouteRule{
+        ID:        "r1",
+        StreamID:  "orders",
+        Targets:   []string{"alerts"},
+        Transform: &api.RouteTransform{Select: []string{"error", "missing"}, SetHeaders: map[string]string{"source": "orders", "tenant": "routed"}},
+    }
+    record := routeRecord(`{"error": {"level": "fatal"}, "items": [1, 2]}`,
+        api.ContentTypeHeader, "text/plain", "tenant", "acme", "trace", "abc",
+        api.RoutedByHeader, "r0", api.RouteHopsHeader, "2")
+
+    routed, result, err := rule.Apply(info, record)
+    if result != api.RouteMatched || err != nil {
+        t.Fatalf("Expected a match, got %d (%v)", result, err)
+    }
+    if string(routed.Key) != "k" || string(routed.Value) != `{"error":{"level":"fatal"}}` {
+        t.Errorf("Unexpected routed record %s=%s", routed.Key, routed.Value)
+    }
+    want := map[string]string{
+        "trace":               "abc",
+        "source":              "orders",
+        "tenant":              "routed",
+        api.ContentTypeHeader: api.ContentTypeJSON,
+        api.RoutedByHeader:    "r1",
+        api.RouteHopsHeader:   "3",
+    }
+    got := make(map[string]string, len(routed.Headers))
+    for _, header := range routed.Headers {
+        if _, duplicate := got[header.Key]; duplicate {
+            t.Errorf("Header %s is set twice", header.Key)
+        }
+        got[header.Key] = string(header.Value)
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("Expected headers %v, got %v", want, got)
+    }
+
+    // Records are routed unchanged without a transform, keeping their content type
+    plain := api.RouteRule{ID: "r2", StreamID: "orders", Targets: []string{"alerts"}}
+    routed, _, _ = plain.Apply(info, routeRecord("raw", api.ContentTypeHeader, api.ContentTypeText))
+    if string(routed.Value) != "raw" || !hasHeader(routed, api.ContentTypeHeader, api.ContentTypeText) || !hasHeader(routed, api.RouteHopsHeader, "1") {
+        t.Errorf("Unexpected untransformed record %s %v", routed.Value, routed.Headers)
+    }
+
+    if _, result, err := rule.Apply(info, routeRecord(`["not", "an", "object"]`)); result != api.RouteMatched || err == nil {
+        t.Errorf("Expected selecting from a JSON array to fail, got %d (%v)", result, err)
+    }
+}
+
+func hasHeader(m kafka.Message, key, value string) bool {
+    for _, header := range m.Headers {
+        if header.Key == key && string(header.Value) == value {
+            return true
+        }
+    }
+    return false
+}
+
+// TestRouteRuleDropsLoops checks that records past the hop limit are dropped.
+func TestRouteRuleDropsLoops(t *testing.T) {
+    rule := api.RouteRule{ID: "r1", StreamID: "orders", Targets: []string{"alerts"}}
+    if _, result, _ := rule.Apply(&api.StreamInfo{ID: "orders"}, routeRecord("x", api.RouteHopsHeader, "7")); result != api.RouteMatched {
+        t.Errorf("Expected a record under the hop limit to be routed, got %d", result)
+    }
+    if _, result, _ := rule.Apply(&api.StreamInfo{ID: "orders"}, routeRecord("x", api.RouteHopsHeader, "8")); result != api.RouteDropped {
+        t.Errorf("Expected a record at the hop limit to be dropped, got %d", result)
+    }
+}
+
+// startRoute creates a rule on stream "orders" of a persisted route store
+// reading from a memoryReader, with writes to a broker that is not running.
+func startRoute(t *testing.T, request string) (*memoryReader, *mux.Router, api.RouteView) {
+    t.Setenv("ROUTE_MAX_ATTEMPTS", "1")
+    t.Setenv("ROUTE_RETRY_BACKOFF_MS", "1")
+    useStreams(t, api.StreamInfo{ID: "orders"}, api.StreamInfo{ID: "alerts"}, api.StreamInfo{ID: "failed"})
+    api.UseBrokerConfig(&api.BrokerConfig{Brokers: []string{"127.0.0.1:1"}})
+    t.Cleanup(func() { api.UseBrokerConfig(&api.BrokerConfig{Brokers: []string{"localhost:9092"}}) })
+    reader := useMemoryReader(t)
+    routes, err := api.NewRouteManager(filepath.Join(t.TempDir(), "routes.json"))
+    if err != nil {
+        t.Fatalf("Failed to open route store: %v", err)
+    }
+    api.UseRoutes(routes)
+    t.Cleanup(routes.Close)
+
+    router := routeRouter()
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("POST", "/stream/orders/routes", bytes.NewBufferString(request)))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+    }
+    var rule api.RouteView
+    json.Unmarshal(w.Body.Bytes(), &rule)
+    return reader, router, rule
+}
+
+func getRoute(router *mux.Router, rule api.RouteView) api.RouteView {
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/orders/routes/"+rule.ID, nil))
+    var view api.RouteView
+    json.Unmarshal(w.Body.Bytes(), &view)
+    return view
+}
+
+// TestRouteCommitsSettledRecords checks that skipped and dropped records are
+// committed.
+func TestRouteCommitsSettledRecords(t *testing.T) {
+    reader, router, rule := startRoute(t, `{"targets": ["alerts"], "match": {"fields": {"level": "error"}}}`)
+    reader.messages <- routeRecord(`{"level": "info"}`)
+    reader.messages <- routeRecord(`{"level": "error"}`, api.RouteHopsHeader, "8")
+    eventually(t, "the records to be committed", func() bool { return reader.commits() == 2 })
+    if stats := getRoute(router, rule).Stats; stats.Skipped != 1 || stats.Dropped != 1 || stats.Matched != 0 {
+        t.Errorf("Unexpected stats %+v", stats)
+    }
+}
+
+// TestRoutePausesOnUnroutableRecords checks that a rule without a dead-letter
+// stream pauses itself on a record it cannot write, leaving it uncommitted.
+func TestRoutePausesOnUnroutableRecords(t *testing.T) {
+    reader, router, rule := startRoute(t, `{"targets": ["alerts"]}`)
+    reader.messages <- routeRecord(`{"level": "error"}`)
+    eventually(t, "the rule to pause", func() bool { return getRoute(router, rule).Paused })
+    view := getRoute(router, rule)
+    if view.Stats.Failed != 1 || view.Stats.Routed != 0 || view.Stats.LastError == "" {
+        t.Errorf("Unexpected stats %+v", view.Stats)
+    }
+    if reader.commits() != 0 {
+        t.Errorf("Expected the record to stay uncommitted, got %d commits", reader.commits())
+    }
+}
+
+// TestRoutePausesWhenDeadLetteringFails checks that a record is only
+// committed once it reaches its targets or the dead-letter stream.
+func TestRoutePausesWhenDeadLetteringFails(t *testing.T) {
+    reader, router, rule := startRoute(t, `{"targets": ["alerts"], "dead_letter": "failed"}`)
+    if rule.DeadLetter != "failed" {
+        t.Errorf("Expected the dead-letter stream to be kept, got %+v", rule)
+    }
+    reader.messages <- routeRecord(`{"level": "error"}`)
+    eventually(t, "the rule to pause", func() bool { return getRoute(router, rule).Paused })
+    view := getRoute(router, rule)
+    if view.Stats.DeadLettered != 0 || !strings.Contains(view.Stats.LastError, "failed") {
+        t.Errorf("Unexpected stats %+v", view.Stats)
+    }
+    if reader.commits() != 0 {
+        t.Errorf("Expected the record to stay uncommitted, got %d commits", reader.commits())
+    }
+}
+
+// TestRoutePausesOnTenantQuota checks that routed records are charged to the
+// source stream's tenant and that the rule pauses, without dead-lettering,
+// once the tenant's daily quota is spent.
+func TestRoutePausesOnTenantQuota(t *testing.T) {
+    qm := api.NewQuotaManager(1024, 1024, 0, 10)
+    api.UseQuotaManager(qm)
+    t.Cleanup(func() { api.UseQuotaManager(api.NewQuotaManagerFromEnv()) })
+
+    reader, router, rule := startRoute(t, `{"targets": ["alerts"], "dead_letter": "failed"}`)
+    reader.messages <- routeRecord(`{"level": "error"}`)
+    eventually(t, "the rule to pause", func() bool { return getRoute(router, rule).Paused })
+    view := getRoute(router, rule)
+    if view.Stats.DeadLettered != 0 || view.Stats.Routed != 0 || !strings.Contains(view.Stats.LastError, "quota") {
+        t.Errorf("Unexpected stats %+v", view.Stats)
+    }
+    if usage := qm.Usage("default"); usage.RejectedRecords != 1 || usage.BytesToday != 0 {
+        t.Errorf("Expected the routed record to be refused for the source tenant, got %+v", usage)
+    }
+    if reader.commits() != 0 {
+        t.Errorf("Expected the record to stay uncommitted, got %d commits", reader.commits())
+    }
+}
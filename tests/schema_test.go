@@ -0,0 +1,333 @@
+// tests/schema_test.go
+package tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/gorilla/mux"
+)
+
+const orderAvroSchema = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "item", "type": "string"}]}`
+
+const orderJSONSchema = `{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}`
+
+const orderProtoSchema = `syntax = "proto3";
+message Order {
+  int64 id = 1;
+  string item = 2;
+}`
+
+// useLocalSchemaStore installs an empty in-memory schema store for the test.
+func useLocalSchemaStore(t *testing.T) *api.LocalSchemaStore {
+    store, err := api.NewLocalSchemaStore("")
+    if err != nil {
+        t.Fatalf("Failed to create schema store: %v", err)
+    }
+    api.UseSchemaStore(store)
+    t.Cleanup(func() { api.UseSchemaStore(&api.LocalSchemaStore{}) })
+    return store
+}
+
+// TestJSONSchemaRefusesExternalRefs checks that JSON schemas can only refer to
+// themselves and the standard meta-schemas.
+func TestJSONSchemaRefusesExternalRefs(t *testing.T) {
+    store := useLocalSchemaStore(t)
+    local := `{"$schema": "http://json-schema.org/draft-07/schema#", "definitions": {"id": {"type": "integer"}}, "properties": {"id": {"$ref": "#/definitions/id"}}}`
+    if _, err := store.Register("local-value", api.Schema{Type: api.SchemaTypeJSON, Definition: local}); err != nil {
+        t.Errorf("Expected a schema with local refs to register, got %v", err)
+    }
+    // A readable JSON file, which the default loaders would load
+    file := filepath.Join(t.TempDir(), "id.json")
+    os.WriteFile(file, []byte(`{"type": "integer"}`), 0o600)
+    for _, ref := range []string{"file://" + filepath.ToSlash(file), "https://example.com/order.json", "other.json"} {
+        definition := `{"properties": {"id": {"$ref": "` + ref + `"}}}`
+        if _, err := store.Register("external-value", api.Schema{Type: api.SchemaTypeJSON, Definition: definition}); !errors.Is(err, api.ErrInvalidSchema) {
+            t.Errorf("%s: expected ErrInvalidSchema, got %v", ref, err)
+        }
+    }
+}
+
+// TestSchemaRecordRoundTrip checks validation, wire framing and decoding for
+// each schema type.
+func TestSchemaRecordRoundTrip(t *testing.T) {
+    store := useLocalSchemaStore(t)
+    cases := []struct {
+        schemaType, definition, valid, invalid string
+    }{
+        {api.SchemaTypeAvro, orderAvroSchema, `{"id": 7, "item": "book"}`, `{"id": "seven"}`},
+        {api.SchemaTypeJSON, orderJSONSchema, `{"id": 7, "item": "book"}`, `{"item": "book"}`},
+        {api.SchemaTypeProtobuf, orderProtoSchema, `{"id": "7", "item": "book"}`, `{"sku": 1}`},
+    }
+    for _, c := range cases {
+        schema, err := store.Register("orders-"+c.schemaType, api.Schema{Type: c.schemaType, Definition: c.definition})
+        if err != nil {
+            t.Fatalf("Failed to register %s schema: %v", c.schemaType, err)
+        }
+
+        framed, err := api.EncodeRecord(schema.ID, []byte(c.valid))
+        if err != nil {
+            t.Fatalf("Failed to encode %s record: %v", c.schemaType, err)
+        }
+        if framed[0] != 0 || int(framed[4]) != schema.ID {
+            t.Errorf("Expected %s record framed with schema id %d, got % x", c.schemaType, schema.ID, framed[:5])
+        }
+        decoded, err := api.DecodeRecord(framed)
+        if err != nil {
+            t.Fatalf("Failed to decode %s record: %v", c.schemaType, err)
+        }
+        var fields map[string]interface{}
+        if err := json.Unmarshal(decoded, &fields); err != nil || fields["item"] != "book" {
+            t.Errorf("Unexpected decoded %s record %s", c.schemaType, decoded)
+        }
+
+        if _, err := api.EncodeRecord(schema.ID, []byte(c.invalid)); !errors.Is(err, api.ErrSchemaMismatch) {
+            t.Errorf("Expected ErrSchemaMismatch for %s record %s, got %v", c.schemaType, c.invalid, err)
+        }
+    }
+}
+
+// TestLocalSchemaStoreVersions checks ids and versions of registered schemas.
+func TestLocalSchemaStoreVersions(t *testing.T) {
+    store := useLocalSchemaStore(t)
+    first, _ := store.Register("orders-value", api.Schema{Type: api.SchemaTypeJSON, Definition: orderJSONSchema})
+    again, _ := store.Register("orders-value", api.Schema{Type: api.SchemaTypeJSON, Definition: orderJSONSchema})
+    if again.ID != first.ID || again.Version != 1 {
+        t.Errorf("Expected re-registration to return version 1 id %d, got %+v", first.ID, again)
+    }
+    second, _ := store.Register("orders-value", api.Schema{Type: api.SchemaTypeJSON, Definition: `{"type": "object"}`})
+    if second.Version != 2 || second.ID == first.ID {
+        t.Errorf("Expected a new id at version 2, got %+v", second)
+    }
+    if _, err := store.Register("orders-value", api.Schema{Type: api.SchemaTypeAvro, Definition: `{"type": "nope"}`}); !errors.Is(err, api.ErrInvalidSchema) {
+        t.Errorf("Expected ErrInvalidSchema, got %v", err)
+    }
+}
+
+// TestRegistrySchemaStore checks the registry client against the local stand-in.
+func TestRegistrySchemaStore(t *testing.T) {
+    local, _ := api.NewLocalSchemaStore("")
+    server := httptest.NewServer(api.SchemaRegistryHandler(local))
+    defer server.Close()
+
+    registry := api.NewRegistrySchemaStore(server.URL)
+    registered, err := registry.Register("orders-value", api.Schema{Definition: orderAvroSchema})
+    if err != nil {
+        t.Fatalf("Failed to register schema: %v", err)
+    }
+    if registered.ID == 0 || registered.Version != 1 {
+        t.Errorf("Unexpected registered schema %+v", registered)
+    }
+    latest, err := registry.Latest("orders-value")
+    if err != nil || latest.ID != registered.ID || latest.Type != api.SchemaTypeAvro {
+        t.Errorf("Unexpected latest schema %+v (%v)", latest, err)
+    }
+    byID, err := registry.ByID(registered.ID)
+    if err != nil || byID.Definition != orderAvroSchema {
+        t.Errorf("Unexpected schema by id %+v (%v)", byID, err)
+    }
+    if _, err := registry.Latest("missing-value"); !errors.Is(err, api.ErrSchemaNotFound) {
+        t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+    }
+}
+
+// TestSendDataRejectsSchemaMismatch checks that sends to schema-bound streams
+// are validated before anything reaches Kafka.
+func TestSendDataRejectsSchemaMismatch(t *testing.T) {
+    schemas := useLocalSchemaStore(t)
+    schema, _ := schemas.Register("orders-value", api.Schema{Type: api.SchemaTypeJSON, Definition: orderJSONSchema})
+
+    useStreams(t, api.StreamInfo{ID: "orders", Schema: &api.StreamSchema{Subject: "orders-value", ID: schema.ID, Version: 1, Type: api.SchemaTypeJSON}})
+
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/orders/send", bytes.NewBufferString(`{"data": {"item": "book"}}`)), "orders")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusUnprocessableEntity || problem.Code != api.ErrCodeSchemaMismatch {
+        t.Errorf("Expected 422 schema_mismatch, got %v %+v", w.Code, problem)
+    }
+}
+
+// TestCheckCompatibility checks the compatibility rules for each schema type.
+func TestCheckCompatibility(t *testing.T) {
+    withDefault := `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "item", "type": "string"}, {"name": "qty", "type": "int", "default": 1}]}`
+    withoutDefault := `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "item", "type": "string"}, {"name": "qty", "type": "int"}]}`
+    retyped := `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"}, {"name": "item", "type": "string"}]}`
+    cases := []struct {
+        mode, schemaType, previous, next string
+        compatible                      bool
+    }{
+        {api.CompatibilityBackward, api.SchemaTypeAvro, orderAvroSchema, withDefault, true},
+        {api.CompatibilityBackward, api.SchemaTypeAvro, orderAvroSchema, withoutDefault, false},
+        {api.CompatibilityForward, api.SchemaTypeAvro, orderAvroSchema, withoutDefault, true},
+        {api.CompatibilityFull, api.SchemaTypeAvro, orderAvroSchema, retyped, false},
+        {api.CompatibilityNone, api.SchemaTypeAvro, orderAvroSchema, retyped, true},
+        {api.CompatibilityBackward, api.SchemaTypeJSON, orderJSONSchema, `{"type": "object", "required": ["id", "item"]}`, false},
+        {api.CompatibilityBackward, api.SchemaTypeJSON, orderJSONSchema, `{"type": "object", "properties": {"id": {"type": "number"}}}`, true},
+        {api.CompatibilityForward, api.SchemaTypeJSON, orderJSONSchema, `{"type": "object", "properties": {"id": {"type": "number"}}}`, false},
+        {api.CompatibilityFull, api.SchemaTypeProtobuf, orderProtoSchema, "syntax = \"proto3\";\nmessage Order {\n  int64 id = 1;\n  string note = 3;\n}", true},
+        {api.CompatibilityBackward, api.SchemaTypeProtobuf, orderProtoSchema, "syntax = \"proto3\";\nmessage Order {\n  int64 id = 1;\n  double item = 2;\n}", false},
+    }
+    for _, c := range cases {
+        issues, err := api.CheckCompatibility(c.mode, api.Schema{Type: c.schemaType, Definition: c.previous}, api.Schema{Type: c.schemaType, Definition: c.next})
+        if err != nil {
+            t.Fatalf("Unexpected error checking %s %s: %v", c.mode, c.schemaType, err)
+        }
+        if (len(issues) == 0) != c.compatible {
+            t.Errorf("Expected %s %s change to next=%s compatible=%v, got issues %v", c.mode, c.schemaType, c.next, c.compatible, issues)
+        }
+    }
+}
+
+// TestRegisterStreamSchemaEvolution checks that incompatible versions are
+// rejected with their reasons and compatible ones become current.
+func TestRegisterStreamSchemaEvolution(t *testing.T) {
+    schemas := useLocalSchemaStore(t)
+    schema, _ := schemas.Register("orders-value", api.Schema{Definition: orderAvroSchema})
+    useStreams(t, api.StreamInfo{ID: "orders", Schema: &api.StreamSchema{Subject: "orders-value", ID: schema.ID, Version: 1, Type: api.SchemaTypeAvro}})
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/schema", api.RegisterStreamSchema).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/schema", api.GetStreamSchemas).Methods("GET")
+    register := func(definition string) *httptest.ResponseRecorder {
+        body, _ := json.Marshal(map[string]string{"schema": definition})
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("POST", "/stream/orders/schema", bytes.NewReader(body)))
+        return w
+    }
+
+    w := register(`{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "item", "type": "string"}, {"name": "qty", "type": "int"}]}`)
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusConflict || problem.Code != api.ErrCodeSchemaIncompatible || len(problem.Errors) != 1 {
+        t.Errorf("Expected 409 schema_incompatible with one reason, got %v %s", w.Code, w.Body.String())
+    }
+
+    w = register(`{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "item", "type": "string"}, {"name": "qty", "type": "int", "default": 1}]}`)
+    var bound api.StreamSchema
+    json.Unmarshal(w.Body.Bytes(), &bound)
+    if w.Code != http.StatusOK || bound.Version != 2 || bound.Compatibility != api.CompatibilityBackward {
+        t.Errorf("Expected version 2 to be bound, got %v %s", w.Code, w.Body.String())
+    }
+
+    w = httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/orders/schema", nil))
+    var listing struct {
+        Versions []api.Schema `json:"versions"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &listing)
+    if len(listing.Versions) != 2 {
+        t.Errorf("Expected two schema versions, got %s", w.Body.String())
+    }
+}
+
+// TestStreamSchemaRequests checks that schema requests only see the
+// caller's tenant's streams and refuse oversized bodies.
+func TestStreamSchemaRequests(t *testing.T) {
+    useLocalSchemaStore(t)
+    useStreams(t, api.StreamInfo{ID: "orders"}, api.StreamInfo{ID: "ledger", Tenant: "globex"})
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/schema", api.RegisterStreamSchema).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/schema", api.GetStreamSchemas).Methods("GET")
+    cases := []struct {
+        method, path, body string
+        status             int
+        code               string
+    }{
+        {"GET", "/stream/ledger/schema", "", http.StatusNotFound, api.ErrCodeStreamNotFound},
+        {"POST", "/stream/ledger/schema", `{"schema": "{\"type\": \"string\"}"}`, http.StatusNotFound, api.ErrCodeStreamNotFound},
+        {"POST", "/stream/orders/schema", `{"schema": "` + strings.Repeat(" ", 2<<20) + `"}`, http.StatusRequestEntityTooLarge, api.ErrCodePayloadTooLarge},
+    }
+    for _, c := range cases {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)))
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != c.status || problem.Code != c.code {
+            t.Errorf("%s %s: expected %d %s, got %d %+v", c.method, c.path, c.status, c.code, w.Code, problem)
+        }
+    }
+}
+
+// TestBindSchemaSubjects checks that streams only bind to their own topic's
+// subjects or subjects under their tenant's prefix, and that a definition
+// bound to a subject with versions must be compatible with its latest one.
+func TestBindSchemaSubjects(t *testing.T) {
+    t.Setenv("STREAM_TOPIC_PREFIX", "{tenant}.streams.")
+    schemas := useLocalSchemaStore(t)
+    schemas.Register("globex.streams.ledger-value", api.Schema{Definition: orderAvroSchema})
+    schemas.Register("acme.streams.orders-value", api.Schema{Definition: orderAvroSchema})
+    useStreams(t, api.StreamInfo{ID: "orders", Topic: "acme.streams.orders", Tenant: "acme"}, api.StreamInfo{ID: "ledger", Topic: "globex.streams.ledger", Tenant: "globex"})
+    mapper, _ := api.NewTenantMapper("apikey:00000001=acme,apikey:00000002=globex")
+    api.UseTenantMapper(mapper)
+    t.Cleanup(func() { api.UseTenantMapper(&api.TenantMapper{}) })
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/schema", api.RegisterStreamSchema).Methods("POST")
+    withoutDefault := `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "item", "type": "string"}, {"name": "qty", "type": "int"}]}`
+    cases := []struct {
+        binding map[string]string
+        status  int
+        code    string
+    }{
+        {map[string]string{"subject": "globex.streams.ledger-value"}, http.StatusForbidden, api.ErrCodeForbidden},
+        {map[string]string{"subject": "globex.streams.ledger-value", "schema": withoutDefault, "compatibility": "NONE"}, http.StatusForbidden, api.ErrCodeForbidden},
+        {map[string]string{"subject": "billing-value"}, http.StatusForbidden, api.ErrCodeForbidden},
+        {map[string]string{"schema": withoutDefault}, http.StatusConflict, api.ErrCodeSchemaIncompatible},
+        {map[string]string{"subject": "acme.streams.shared-value", "schema": orderAvroSchema}, http.StatusOK, ""},
+    }
+    for _, c := range cases {
+        body, _ := json.Marshal(c.binding)
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, api.WithPrincipal(httptest.NewRequest("POST", "/stream/orders/schema", bytes.NewReader(body)), "apikey:00000001"))
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != c.status || problem.Code != c.code {
+            t.Errorf("%v: expected %d %q, got %d %s", c.binding, c.status, c.code, w.Code, w.Body.String())
+        }
+    }
+    for _, subject := range []string{"globex.streams.ledger-value", "acme.streams.orders-value"} {
+        if versions, _ := schemas.Versions(subject); len(versions) != 1 {
+            t.Errorf("Expected %s to keep one version, got %v", subject, versions)
+        }
+    }
+}
+
+// TestProjectRecord checks that records written with one version are read in
+// the shape of another.
+func TestProjectRecord(t *testing.T) {
+    schemas := useLocalSchemaStore(t)
+    v1, _ := schemas.Register("orders-value", api.Schema{Definition: orderAvroSchema})
+    v2, _ := schemas.Register("orders-value", api.Schema{Definition: `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "double"}, {"name": "qty", "type": "int", "default": 1}]}`})
+
+    framed, err := api.EncodeRecord(v1.ID, []byte(`{"id": 7, "item": "book"}`))
+    if err != nil {
+        t.Fatalf("Failed to encode record: %v", err)
+    }
+    projected, err := api.ProjectRecord(framed, v2)
+    if err != nil {
+        t.Fatalf("Failed to project record: %v", err)
+    }
+    var fields map[string]interface{}
+    json.Unmarshal(projected, &fields)
+    if fields["id"] != 7.0 || fields["qty"] != 1.0 || fields["item"] != nil {
+        t.Errorf("Unexpected projected record %s", projected)
+    }
+
+    jsonV1, _ := schemas.Register("events-value", api.Schema{Type: api.SchemaTypeJSON, Definition: orderJSONSchema})
+    jsonV2, _ := schemas.Register("events-value", api.Schema{Type: api.SchemaTypeJSON, Definition: `{"type": "object", "properties": {"id": {"type": "integer"}, "status": {"type": "string", "default": "new"}}}`})
+    framed, _ = api.EncodeRecord(jsonV1.ID, []byte(`{"id": 3, "extra": true}`))
+    projected, err = api.ProjectRecord(framed, jsonV2)
+    if err != nil || string(projected) != `{"id":3,"status":"new"}` {
+        t.Errorf("Unexpected projected JSON record %s (%v)", projected, err)
+    }
+}
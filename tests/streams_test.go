@@ -0,0 +1,420 @@
+// tests/streams_test.go
+package tests
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+)
+
+// useStreams registers streams for the test, restoring an empty registry
+// afterwards. Streams without a creation time are created now.
+func useStreams(t testing.TB, streams ...api.StreamInfo) *api.MemoryStreamStore {
+    t.Helper()
+    store := api.NewMemoryStreamStore()
+    for _, info := range streams {
+        if info.CreatedAt.IsZero() {
+            info.CreatedAt = time.Now()
+        }
+        store.Put(info)
+    }
+    if err := api.UseStreamStore(store); err != nil {
+        t.Fatalf("Failed to load store: %v", err)
+    }
+    t.Cleanup(func() { api.UseStreamStore(api.NewMemoryStreamStore()) })
+    return store
+}
+
+// TestSendDataRejectsUnknownStream checks that sends to streams that were never
+// started return 404 instead of creating a topic.
+func TestSendDataRejectsUnknownStream(t *testing.T) {
+    req := httptest.NewRequest("POST", "/stream/typo/send", bytes.NewBufferString(`{"data": "x"}`))
+    w := httptest.NewRecorder()
+    api.SendData(w, req, "typo")
+
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusNotFound || problem.Code != api.ErrCodeStreamNotFound {
+        t.Errorf("Expected 404 stream_not_found, got %v %+v", w.Code, problem)
+    }
+}
+
+// TestSendDataRejectsInvalidStreamID checks stream ids against Kafka topic rules.
+func TestSendDataRejectsInvalidStreamID(t *testing.T) {
+    for _, id := range []string{"..", "has space", "bad/slash"} {
+        w := httptest.NewRecorder()
+        api.SendData(w, httptest.NewRequest("POST", "/stream/x/send", bytes.NewBufferString(`{"data": "x"}`)), id)
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("Expected 400 for stream id %q, got %v", id, w.Code)
+        }
+    }
+}
+
+// TestGetResultsRejectsUnknownStream checks that subscriptions to unknown
+// streams are refused before the websocket upgrade.
+func TestGetResultsRejectsUnknownStream(t *testing.T) {
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/results", api.GetResults).Methods("GET")
+
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/unknown-stream/results", nil))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected 404, got %v", w.Code)
+    }
+}
+
+// TestFileStreamStoreSurvivesReopen checks that streams written to the file
+// store are loaded again by a new store, as after a restart.
+func TestFileStreamStoreSurvivesReopen(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "streams.json")
+    store, err := api.NewFileStreamStore(path)
+    if err != nil {
+        t.Fatalf("Failed to open store: %v", err)
+    }
+    created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+    if err := store.Put(api.StreamInfo{ID: "orders", Owner: "apikey:abc", CreatedAt: created}); err != nil {
+        t.Fatalf("Failed to put stream: %v", err)
+    }
+    store.Put(api.StreamInfo{ID: "stale", CreatedAt: created})
+    store.Delete("stale")
+
+    reopened, err := api.NewFileStreamStore(path)
+    if err != nil {
+        t.Fatalf("Failed to reopen store: %v", err)
+    }
+    streams, _ := reopened.List()
+    if len(streams) != 1 || streams[0].ID != "orders" || streams[0].Owner != "apikey:abc" || !streams[0].CreatedAt.Equal(created) {
+        t.Errorf("Unexpected streams after reopen: %+v", streams)
+    }
+}
+
+// TestStreamListingAfterLoad checks that streams loaded from a store are
+// listed, described and accepted by the registry.
+func TestStreamListingAfterLoad(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "orders", Owner: "apikey:abc"})
+
+    router := mux.NewRouter()
+    router.HandleFunc("/streams", api.ListStreams).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}", api.DescribeStream).Methods("GET")
+
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/streams", nil))
+    var listing struct {
+        Streams []api.StreamInfo `json:"streams"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &listing)
+    if len(listing.Streams) != 1 || listing.Streams[0].ID != "orders" {
+        t.Errorf("Unexpected listing %s", w.Body.String())
+    }
+
+    w = httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/orders", nil))
+    if w.Code != http.StatusOK {
+        t.Errorf("Expected 200 describing a loaded stream, got %v", w.Code)
+    }
+    w = httptest.NewRecorder()
+    router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/missing", nil))
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected 404 describing an unknown stream, got %v", w.Code)
+    }
+}
+
+// TestStreamsAreScopedToTenants checks that streams of other tenants are not
+// listed, described or written to.
+func TestStreamsAreScopedToTenants(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "orders", Tenant: "acme"}, api.StreamInfo{ID: "events"})
+    mapper, _ := api.NewTenantMapper("apikey:1a2b3c4d=acme")
+    api.UseTenantMapper(mapper)
+    t.Cleanup(func() { api.UseTenantMapper(&api.TenantMapper{}) })
+
+    router := mux.NewRouter()
+    router.HandleFunc("/streams", api.ListStreams).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}", api.DescribeStream).Methods("GET")
+    do := func(principal, method, path string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, api.WithPrincipal(httptest.NewRequest(method, path, nil), principal))
+        return w
+    }
+    list := func(principal string) []string {
+        var listing struct {
+            Streams []api.StreamInfo `json:"streams"`
+        }
+        json.Unmarshal(do(principal, "GET", "/streams").Body.Bytes(), &listing)
+        ids := []string{}
+        for _, info := range listing.Streams {
+            ids = append(ids, info.ID)
+        }
+        return ids
+    }
+
+    if ids := list("apikey:1a2b3c4d"); len(ids) != 1 || ids[0] != "orders" {
+        t.Errorf("Expected acme to list only its stream, got %v", ids)
+    }
+    if ids := list("apikey:ffffffff"); len(ids) != 1 || ids[0] != "events" {
+        t.Errorf("Expected the default tenant to list only its stream, got %v", ids)
+    }
+    if w := do("apikey:1a2b3c4d", "GET", "/stream/orders"); w.Code != http.StatusOK {
+        t.Errorf("Expected acme to describe its stream, got %d", w.Code)
+    }
+    if w := do("apikey:ffffffff", "GET", "/stream/orders"); w.Code != http.StatusNotFound {
+        t.Errorf("Expected another tenant's stream to be hidden, got %d", w.Code)
+    }
+
+    w := httptest.NewRecorder()
+    api.SendData(w, api.WithPrincipal(httptest.NewRequest("POST", "/stream/orders/send", bytes.NewBufferString(`{"data": "x"}`)), "apikey:ffffffff"), "orders")
+    if w.Code != http.StatusNotFound {
+        t.Errorf("Expected sends to another tenant's stream to return 404, got %d", w.Code)
+    }
+}
+
+// TestStreamSpecValidate checks the static validation of stream specs.
+func TestStreamSpecValidate(t *testing.T) {
+    valid := api.StreamSpec{Partitions: 3, ReplicationFactor: 1, RetentionMs: -1, CleanupPolicy: "compact,delete", Compression: "zstd", MaxMessageBytes: 1 << 20}
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Expected valid spec, got %v", err)
+    }
+    invalid := []api.StreamSpec{
+        {Partitions: 100000},
+        {RetentionMs: -2},
+        {CleanupPolicy: "archive"},
+        {Compression: "brotli"},
+        {MaxMessageBytes: -1},
+        {ReplicationFactor: 40000},
+    }
+    for _, spec := range invalid {
+        if err := spec.Validate(); !errors.Is(err, api.ErrInvalidStreamSpec) {
+            t.Errorf("Expected %+v to be rejected, got %v", spec, err)
+        }
+    }
+    if err := (api.StreamSpec{ReplicationFactor: 40000}).Validate(); err == nil || !strings.Contains(err.Error(), "between 1 and 32767") {
+        t.Errorf("Expected the replication_factor range in the error, got %v", err)
+    }
+}
+
+// TestProducersOnlyCreateMissingTopics checks that producers of streams
+// started with a spec do not create their topic again, while auto-created
+// streams still have theirs created.
+func TestProducersOnlyCreateMissingTopics(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "specified-topic", Config: &api.StreamSpec{Partitions: 6, ReplicationFactor: 3}}, api.StreamInfo{ID: "auto-topic"})
+    created := make(map[string]bool)
+    api.UseWriterFunc(func(brokers []string, topic string, createTopic bool) *kafka.Writer {
+        created[topic] = createTopic
+        return &kafka.Writer{Addr: kafka.TCP("fake:9092"), Topic: topic, Transport: &fakeBroker{}, BatchSize: 1}
+    })
+    t.Cleanup(func() { api.UseWriterFunc(nil) })
+
+    for _, streamID := range []string{"specified-topic", "auto-topic"} {
+        w := httptest.NewRecorder()
+        api.SendData(w, httptest.NewRequest("POST", "/stream/"+streamID+"/send", bytes.NewBufferString(`{"data": "x"}`)), streamID)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s: expected 200, got %d %s", streamID, w.Code, w.Body.String())
+        }
+    }
+    if createTopic, ok := created["specified-topic"]; !ok || createTopic {
+        t.Errorf("Expected the specified stream's producer not to create its topic, got %v %v", createTopic, ok)
+    }
+    if !created["auto-topic"] {
+        t.Errorf("Expected the auto-created stream's producer to create its topic")
+    }
+}
+
+// TestStartStreamRejectsInvalidSpec checks that bad specs fail with 400
+// before any topic is created.
+func TestStartStreamRejectsInvalidSpec(t *testing.T) {
+    for _, body := range []string{`{"partitions": 100000}`, `{"cleanup_policy": "archive"}`, `{"unknown": 1}`, `not json`} {
+        w := httptest.NewRecorder()
+        api.StartStream(w, httptest.NewRequest("POST", "/stream/start", bytes.NewBufferString(body)))
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("Expected 400 for %s, got %v", body, w.Code)
+        }
+    }
+}
+
+// TestTopicNameAppliesTenantPrefix checks that STREAM_TOPIC_PREFIX namespaces
+// topics per tenant and that oversized topic names are rejected.
+func TestTopicNameAppliesTenantPrefix(t *testing.T) {
+    t.Setenv("STREAM_TOPIC_PREFIX", "{tenant}.streams.")
+    topic, err := api.TopicName("orders", "acme")
+    if err != nil || topic != "acme.streams.orders" {
+        t.Errorf("Expected acme.streams.orders, got %q (%v)", topic, err)
+    }
+    if _, err := api.TopicName(strings.Repeat("a", 249), "acme"); err == nil {
+        t.Error("Expected an error for a topic name over 249 characters")
+    }
+}
+
+// TestRegisterStreamRejectsDuplicates checks conflicts on a taken stream id and
+// on topics that Kafka considers colliding.
+func TestRegisterStreamRejectsDuplicates(t *testing.T) {
+    sm := api.NewStreamManager(nil)
+    if _, err := sm.RegisterStream(api.StreamInfo{ID: "orders", Topic: "acme.orders"}); err != nil {
+        t.Fatalf("Failed to register stream: %v", err)
+    }
+    if _, err := sm.RegisterStream(api.StreamInfo{ID: "orders", Topic: "other.orders"}); !errors.Is(err, api.ErrStreamExists) {
+        t.Errorf("Expected ErrStreamExists for a duplicate id, got %v", err)
+    }
+    if err := sm.CheckAvailable("orders2", "acme_orders", "default"); !errors.Is(err, api.ErrStreamExists) {
+        t.Errorf("Expected ErrStreamExists for a colliding topic, got %v", err)
+    }
+    if err := sm.CheckAvailable("orders2", "acme_orders", "globex"); !errors.Is(err, api.ErrStreamExists) || strings.Contains(err.Error(), "stream orders") {
+        t.Errorf("Expected ErrStreamExists without naming another tenant's stream, got %v", err)
+    }
+}
+
+// TestAutoCreateRejectsUnusableIDs checks that auto-creating a stream whose
+// topic would be invalid or taken fails with 400 and 409 rather than 500.
+func TestAutoCreateRejectsUnusableIDs(t *testing.T) {
+    t.Setenv("STREAM_TOPIC_PREFIX", "{tenant}.streams.")
+    useStreams(t, api.StreamInfo{ID: "orders_eu", Topic: "default.streams.orders_eu"})
+    api.SetStreamAutoCreate(true)
+    defer api.SetStreamAutoCreate(false)
+
+    cases := []struct {
+        streamID string
+        status   int
+        code     string
+    }{
+        {strings.Repeat("a", 240), http.StatusBadRequest, api.ErrCodeInvalidRequest},
+        {"orders.eu", http.StatusConflict, api.ErrCodeStreamExists},
+    }
+    for _, c := range cases {
+        w := httptest.NewRecorder()
+        api.SendData(w, httptest.NewRequest("POST", "/stream/"+c.streamID+"/send", bytes.NewBufferString(`{"data": "x"}`)), c.streamID)
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != c.status || problem.Code != c.code {
+            t.Errorf("%.20s: expected %d %s, got %d %s", c.streamID, c.status, c.code, w.Code, w.Body.String())
+        }
+    }
+}
+
+// TestStartStreamRejectsInvalidName checks client-chosen names against Kafka topic rules.
+func TestStartStreamRejectsInvalidName(t *testing.T) {
+    w := httptest.NewRecorder()
+    api.StartStream(w, httptest.NewRequest("POST", "/stream/start", bytes.NewBufferString(`{"name": "bad/name"}`)))
+    if w.Code != http.StatusBadRequest {
+        t.Errorf("Expected 400 for an invalid name, got %v", w.Code)
+    }
+}
+
+// TestAttachStreamValidation checks attach requests before the cluster is contacted.
+func TestAttachStreamValidation(t *testing.T) {
+    valid := api.AttachStreamRequest{Topic: "billing.invoices", Partitions: []int{0, 2}, StartOffset: api.StartOffsetLatest}
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Expected valid attach request, got %v", err)
+    }
+    for _, request := range []api.AttachStreamRequest{
+        {},
+        {Topic: "bad/topic"},
+        {Topic: "invoices", StartOffset: "yesterday"},
+        {Topic: "invoices", Partitions: []int{1, 1}},
+        {Topic: "invoices", Partitions: []int{-1}},
+    } {
+        if err := request.Validate(); err == nil {
+            t.Errorf("Expected an error for %+v", request)
+        }
+    }
+}
+
+// TestSendDataRejectsReadOnlyStream checks that attached streams refuse sends.
+func TestSendDataRejectsReadOnlyStream(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "invoices", Topic: "billing.invoices", ReadOnly: true})
+
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/invoices/send", bytes.NewBufferString(`{"data": "x"}`)), "invoices")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusForbidden || problem.Code != api.ErrCodeStreamReadOnly {
+        t.Errorf("Expected 403 stream_read_only, got %v %+v", w.Code, problem)
+    }
+}
+
+// TestAttachStreamRequiresAdmin checks that only admin principals may attach,
+// and that admins cannot attach the audit topic or another tenant's topics.
+func TestAttachStreamRequiresAdmin(t *testing.T) {
+    store := useStreams(t)
+    t.Setenv("STREAM_TOPIC_PREFIX", "{tenant}.streams.")
+    t.Setenv("AUDIT_KAFKA_TOPIC", "kafnodex.audit")
+    mapper, err := api.NewTenantMapper("apikey:00000001=acme,apikey:00000002=globex")
+    if err != nil {
+        t.Fatal(err)
+    }
+    api.UseTenantMapper(mapper)
+    t.Cleanup(func() { api.UseTenantMapper(&api.TenantMapper{}) })
+    api.UseAdminPrincipals(api.NewAdminPrincipals("apikey:00000001"))
+    t.Cleanup(func() { api.UseAdminPrincipals(&api.AdminPrincipals{}) })
+
+    cases := []struct {
+        principal, body string
+    }{
+        {"apikey:00000002", `{"topic": "billing.invoices"}`},
+        {"apikey:00000001", `{"topic": "kafnodex.audit"}`},
+        {"apikey:00000001", `{"topic": "kafnodex_audit", "name": "audit"}`},
+        {"apikey:00000001", `{"topic": "globex.streams.orders", "name": "orders"}`},
+        {"apikey:00000001", `{"topic": "default.streams.orders", "name": "orders"}`},
+    }
+    for _, c := range cases {
+        w := httptest.NewRecorder()
+        api.AttachStream(w, api.WithPrincipal(httptest.NewRequest("POST", "/streams/attach", bytes.NewBufferString(c.body)), c.principal))
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != http.StatusForbidden || problem.Code != api.ErrCodeForbidden {
+            t.Errorf("%s %s: expected 403 forbidden, got %v %+v", c.principal, c.body, w.Code, problem)
+        }
+    }
+    if streams, _ := store.List(); len(streams) != 0 {
+        t.Errorf("Expected no attached streams, got %+v", streams)
+    }
+}
+
+// TestFetchRecords checks that long-poll fetches return the records available,
+// filtered by header, commit them, and return an empty list after waiting.
+func TestFetchRecords(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "invoices", Topic: "billing.invoices", ReadOnly: true})
+    reader := useMemoryReader(t)
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/fetch", api.FetchRecords).Methods("GET")
+    fetch := func(query string) (int, api.FetchResponse) {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/invoices/fetch?"+query, nil))
+        var response api.FetchResponse
+        json.Unmarshal(w.Body.Bytes(), &response)
+        return w.Code, response
+    }
+
+    reader.messages <- kafka.Message{Offset: 1, Value: []byte("first"), Headers: []kafka.Header{{Key: "region", Value: []byte("eu")}}}
+    reader.messages <- kafka.Message{Offset: 2, Value: []byte("second"), Headers: []kafka.Header{{Key: "region", Value: []byte("us")}}}
+    reader.messages <- kafka.Message{Offset: 3, Value: []byte("third"), Headers: []kafka.Header{{Key: "region", Value: []byte("eu")}}}
+    code, response := fetch("header.region=eu&max_records=1")
+    if code != http.StatusOK || len(response.Records) != 1 || response.Records[0].Offset != 1 || !strings.Contains(response.Records[0].Data, "first") {
+        t.Fatalf("Expected record 1, got %v %+v", code, response)
+    }
+    code, response = fetch("header.region=eu")
+    if code != http.StatusOK || len(response.Records) != 1 || response.Records[0].Offset != 3 || response.Records[0].Headers["region"] != "eu" {
+        t.Fatalf("Expected record 3 only, got %v %+v", code, response)
+    }
+    if reader.commits() != 3 {
+        t.Errorf("Expected the 3 fetched records committed, got %d", reader.commits())
+    }
+
+    start := time.Now()
+    code, response = fetch("wait_ms=100")
+    if code != http.StatusOK || response.Records == nil || len(response.Records) != 0 || time.Since(start) < 100*time.Millisecond {
+        t.Errorf("Expected an empty list after waiting, got %v %+v", code, response)
+    }
+    for _, query := range []string{"max_records=0", "wait_ms=60000"} {
+        if code, _ := fetch(query); code != http.StatusBadRequest {
+            t.Errorf("%s: expected 400, got %v", query, code)
+        }
+    }
+}
@@ -0,0 +1,166 @@
+// tests/tls_test.go
+package tests
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "io"
+    "math/big"
+    "my-golang-api/internal/api"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// testCert is a generated certificate and key, optionally signed by a parent.
+type testCert struct {
+    cert    *x509.Certificate
+    key     *ecdsa.PrivateKey
+    certPEM []byte
+    keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, commonName string, serial int64, parent *testCert) *testCert {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("Failed to generate key: %v", err)
+    }
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(serial),
+        Subject:      pkix.Name{CommonName: commonName},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+        DNSNames:     []string{"localhost"},
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+    }
+    signerCert, signerKey := template, key
+    if parent == nil {
+        template.IsCA = true
+        template.BasicConstraintsValid = true
+    } else {
+        signerCert, signerKey = parent.cert, parent.key
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+    if err != nil {
+        t.Fatalf("Failed to create certificate: %v", err)
+    }
+    cert, _ := x509.ParseCertificate(der)
+    keyDER, _ := x509.MarshalECPrivateKey(key)
+    return &testCert{
+        cert:    cert,
+        key:     key,
+        certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+        keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+    }
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+    t.Helper()
+    if err := os.WriteFile(path, data, 0o600); err != nil {
+        t.Fatalf("Failed to write %s: %v", path, err)
+    }
+}
+
+// TestMutualTLSPrincipal checks that a client certificate signed by the
+// configured CA is verified and mapped to a principal.
+func TestMutualTLSPrincipal(t *testing.T) {
+    dir := t.TempDir()
+    ca := newTestCert(t, "test-ca", 1, nil)
+    server := newTestCert(t, "localhost", 2, ca)
+    client := newTestCert(t, "orders-service", 3, ca)
+
+    writeFile(t, filepath.Join(dir, "ca.pem"), ca.certPEM)
+    writeFile(t, filepath.Join(dir, "server.pem"), server.certPEM)
+    writeFile(t, filepath.Join(dir, "server-key.pem"), server.keyPEM)
+    t.Setenv("TLS_CERT_FILE", filepath.Join(dir, "server.pem"))
+    t.Setenv("TLS_KEY_FILE", filepath.Join(dir, "server-key.pem"))
+    t.Setenv("TLS_CLIENT_CA_FILE", filepath.Join(dir, "ca.pem"))
+    t.Setenv("TLS_MIN_VERSION", "1.2")
+
+    tlsConfig, _, err := api.TLSConfigFromEnv()
+    if err != nil {
+        t.Fatalf("Failed to build TLS config: %v", err)
+    }
+    mapper, err := api.NewCertPrincipalMapper("orders-service=orders")
+    if err != nil {
+        t.Fatalf("Failed to build principal mapper: %v", err)
+    }
+
+    ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        principal, ok := mapper.Principal(r)
+        if !ok {
+            w.WriteHeader(http.StatusForbidden)
+            return
+        }
+        io.WriteString(w, principal)
+    }))
+    ts.TLS = tlsConfig
+    ts.StartTLS()
+    defer ts.Close()
+
+    roots := x509.NewCertPool()
+    roots.AddCert(ca.cert)
+    clientCert, _ := tls.X509KeyPair(client.certPEM, client.keyPEM)
+    httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+        RootCAs:      roots,
+        ServerName:   "localhost",
+        Certificates: []tls.Certificate{clientCert},
+    }}}
+
+    resp, err := httpClient.Get(ts.URL)
+    if err != nil {
+        t.Fatalf("mTLS request failed: %v", err)
+    }
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(resp.Body)
+    if resp.StatusCode != http.StatusOK || string(body) != "orders" {
+        t.Errorf("Expected principal 'orders', got %d %q", resp.StatusCode, body)
+    }
+
+    // Without a client certificate the handshake must be refused
+    anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+    if resp, err := anonymous.Get(ts.URL); err == nil {
+        resp.Body.Close()
+        t.Errorf("Expected request without client certificate to fail")
+    }
+}
+
+// TestCertReloader checks that a replaced certificate is served after Reload.
+func TestCertReloader(t *testing.T) {
+    dir := t.TempDir()
+    ca := newTestCert(t, "test-ca", 1, nil)
+    first := newTestCert(t, "localhost", 10, ca)
+    second := newTestCert(t, "localhost", 11, ca)
+    certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+    writeFile(t, certFile, first.certPEM)
+    writeFile(t, keyFile, first.keyPEM)
+    reloader, err := api.NewCertReloader(certFile, keyFile)
+    if err != nil {
+        t.Fatalf("Failed to load certificate: %v", err)
+    }
+
+    writeFile(t, certFile, second.certPEM)
+    writeFile(t, keyFile, second.keyPEM)
+    if err := reloader.Reload(); err != nil {
+        t.Fatalf("Failed to reload certificate: %v", err)
+    }
+
+    cert, _ := reloader.GetCertificate(nil)
+    leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+    if leaf.SerialNumber.Int64() != 11 {
+        t.Errorf("Expected reloaded certificate serial 11, got %v", leaf.SerialNumber)
+    }
+}
@@ -0,0 +1,155 @@
+// tests/tracing_test.go
+package tests
+
+import (
+    "bytes"
+    "context"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gorilla/mux"
+    "github.com/gorilla/websocket"
+    "github.com/segmentio/kafka-go"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useSpanRecorder installs W3C propagation and a tracer provider recording
+// every span into the returned recorder.
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+    t.Helper()
+    t.Setenv("OTEL_TRACES_EXPORTER", "none")
+    if _, err := api.InitTracing(context.Background()); err != nil {
+        t.Fatalf("Failed to initialize tracing: %v", err)
+    }
+    recorder := tracetest.NewSpanRecorder()
+    previous := otel.GetTracerProvider()
+    otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+    t.Cleanup(func() { otel.SetTracerProvider(previous) })
+    return recorder
+}
+
+// endedSpan returns the first ended span with the given name.
+func endedSpan(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+    for _, span := range recorder.Ended() {
+        if span.Name() == name {
+            return span
+        }
+    }
+    return nil
+}
+
+// spanStreamID returns a span's stream.id attribute.
+func spanStreamID(span sdktrace.ReadOnlySpan) string {
+    for _, kv := range span.Attributes() {
+        if kv.Key == attribute.Key("stream.id") {
+            return kv.Value.AsString()
+        }
+    }
+    return ""
+}
+
+// TestTracingMiddlewareContinuesTrace checks that the server span joins the
+// caller's W3C trace and is named after the route template.
+func TestTracingMiddlewareContinuesTrace(t *testing.T) {
+    recorder := useSpanRecorder(t)
+
+    router := mux.NewRouter()
+    router.Use(api.TracingMiddleware())
+    router.HandleFunc("/stream/{stream_id}/send", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }).Methods("POST")
+
+    req := httptest.NewRequest("POST", "/stream/orders/send", nil)
+    req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+    router.ServeHTTP(httptest.NewRecorder(), req)
+
+    spans := recorder.Ended()
+    if len(spans) != 1 {
+        t.Fatalf("Expected 1 span, got %d", len(spans))
+    }
+    span := spans[0]
+    if span.Name() != "POST /stream/{stream_id}/send" {
+        t.Errorf("Unexpected span name %q", span.Name())
+    }
+    if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+        t.Errorf("Expected span to continue the incoming trace, got trace id %s", got)
+    }
+    if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+        t.Errorf("Expected parent span 00f067aa0ba902b7, got %s", got)
+    }
+}
+
+// TestTraceContextRoundTrip checks that a sent record carries the produce
+// span's trace context in a traceparent header, and that the span consuming
+// it links back to the produce span.
+func TestTraceContextRoundTrip(t *testing.T) {
+    recorder := useSpanRecorder(t)
+    useStreams(t, api.StreamInfo{ID: "traced"})
+    broker := &fakeBroker{}
+    useFakeBroker(t, broker)
+    reader := useMemoryReader(t)
+
+    w := httptest.NewRecorder()
+    api.SendData(w, httptest.NewRequest("POST", "/stream/traced/send", bytes.NewBufferString(`{"data": "x"}`)), "traced")
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+    }
+    produceSpan := endedSpan(recorder, "produce")
+    if produceSpan == nil || spanStreamID(produceSpan) != "traced" {
+        t.Fatalf("Expected a produce span for stream traced, got %v", produceSpan)
+    }
+    produced := broker.headers()
+    if len(produced) != 1 {
+        t.Fatalf("Expected one stored record, got %d", len(produced))
+    }
+    var traceparent string
+    for _, header := range produced[0] {
+        if header.Key == "traceparent" {
+            traceparent = string(header.Value)
+        }
+    }
+    sc := produceSpan.SpanContext()
+    if want := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"; traceparent != want {
+        t.Fatalf("Expected traceparent %s, got %q", want, traceparent)
+    }
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/results", api.GetResults)
+    server := httptest.NewServer(router)
+    defer server.Close()
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[len("http"):]+"/stream/traced/results", nil)
+    if err != nil {
+        t.Fatalf("Failed to subscribe: %v", err)
+    }
+    defer conn.Close()
+    conn.ReadMessage() // subscription status
+    reader.messages <- kafka.Message{Value: []byte("x"), Headers: produced[0]}
+    if _, _, err := conn.ReadMessage(); err != nil {
+        t.Fatalf("Failed to read the record: %v", err)
+    }
+
+    var consumeSpan sdktrace.ReadOnlySpan
+    eventually(t, "the consume span to end", func() bool {
+        consumeSpan = endedSpan(recorder, "consume")
+        return consumeSpan != nil
+    })
+    if spanStreamID(consumeSpan) != "traced" {
+        t.Errorf("Expected the consume span to carry stream.id traced")
+    }
+    links := consumeSpan.Links()
+    if len(links) != 1 || links[0].SpanContext.TraceID() != sc.TraceID() || links[0].SpanContext.SpanID() != sc.SpanID() {
+        t.Errorf("Expected the consume span to link to the produce span, got %+v", links)
+    }
+    for _, span := range recorder.Ended() {
+        switch span.Name() {
+        case "produce", "consume", "process", "websocket.write":
+        default:
+            t.Errorf("Unexpected span name %q", span.Name())
+        }
+    }
+}
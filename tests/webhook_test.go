@@ -0,0 +1,408 @@
+// tests/webhook_test.go
+package tests
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "my-golang-api/internal/api"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/gorilla/mux"
+    "github.com/segmentio/kafka-go"
+)
+
+// TestWebhookRequestValidate checks webhook registration validation.
+func TestWebhookRequestValidate(t *testing.T) {
+    valid := api.WebhookRequest{URL: "https://example.com/hook", Secret: "s3cret", Filter: map[string]string{"tenant": "acme"}, BatchSize: 50}
+    if err := valid.Validate(); err != nil {
+        t.Errorf("Expected a valid request, got %v", err)
+    }
+    invalid := []api.WebhookRequest{
+        {URL: "ftp://example.com/hook", Secret: "s3cret"},
+        {URL: "/hook", Secret: "s3cret"},
+        {URL: "https://example.com/hook"},
+        {URL: "https://example.com/hook", Secret: "s3cret", BatchSize: 501},
+        {URL: "https://example.com/hook", Secret: "s3cret", Filter: map[string]string{"bad key": "x"}},
+        {URL: "http://127.0.0.1:8080/hook", Secret: "s3cret"},
+        {URL: "http://localhost/hook", Secret: "s3cret"},
+        {URL: "http://[::1]/hook", Secret: "s3cret"},
+        {URL: "http://10.1.2.3/hook", Secret: "s3cret"},
+        {URL: "http://169.254.169.254/latest/meta-data", Secret: "s3cret"},
+    }
+    for _, request := range invalid {
+        if err := request.Validate(); err == nil {
+            t.Errorf("Expected an error for %+v", request)
+        }
+    }
+
+    t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "127.0.0.0/8, 10.1.2.3")
+    for _, target := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://10.1.2.3/hook"} {
+        if err := (api.WebhookRequest{URL: target, Secret: "s3cret"}).Validate(); err != nil {
+            t.Errorf("Expected %s to be allowed, got %v", target, err)
+        }
+    }
+}
+
+// TestSignWebhook checks the signature receivers are told to verify.
+func TestSignWebhook(t *testing.T) {
+    body := []byte(`{"records":[]}`)
+    mac := hmac.New(sha256.New, []byte("s3cret"))
+    mac.Write([]byte("1700000000." + string(body)))
+    if got, want := api.SignWebhook("s3cret", "1700000000", body), hex.EncodeToString(mac.Sum(nil)); got != want {
+        t.Errorf("Expected signature %s, got %s", want, got)
+    }
+}
+
+// TestWebhookLifecycle registers, reads and deletes a webhook, checking the
+// secret is persisted but never returned.
+func TestWebhookLifecycle(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+    path := filepath.Join(t.TempDir(), "webhooks.json")
+    webhooks, err := api.NewWebhookManager(path)
+    if err != nil {
+        t.Fatalf("Failed to open webhook store: %v", err)
+    }
+    api.UseWebhooks(webhooks)
+    defer webhooks.Close()
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/webhooks", api.CreateWebhook).Methods("POST")
+    router.HandleFunc("/stream/{stream_id}/webhooks", api.ListWebhooks).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}", api.GetWebhook).Methods("GET")
+    router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}", api.DeleteWebhook).Methods("DELETE")
+    router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}/dead-letters", api.GetWebhookDeadLetters).Methods("GET")
+    do := func(method, path, body string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+        return w
+    }
+
+    w := do("POST", "/stream/events/webhooks", `{"url": "https://hooks.example.com/hook", "secret": "s3cret"}`)
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+    }
+    if strings.Contains(w.Body.String(), "s3cret") {
+        t.Errorf("Secret returned in %s", w.Body.String())
+    }
+    var hook api.WebhookView
+    json.Unmarshal(w.Body.Bytes(), &hook)
+    if hook.ID == "" || hook.StreamID != "events" || hook.BatchSize != 1 {
+        t.Errorf("Unexpected webhook %+v", hook)
+    }
+    if data, _ := os.ReadFile(path); !strings.Contains(string(data), "s3cret") {
+        t.Errorf("Expected the secret to be persisted, got %s", data)
+    }
+
+    var list struct {
+        Webhooks []api.WebhookView `json:"webhooks"`
+    }
+    w = do("GET", "/stream/events/webhooks", "")
+    json.Unmarshal(w.Body.Bytes(), &list)
+    if w.Code != http.StatusOK || len(list.Webhooks) != 1 || list.Webhooks[0].ID != hook.ID {
+        t.Errorf("Expected the webhook to be listed, got %d %s", w.Code, w.Body.String())
+    }
+    if w = do("GET", "/stream/events/webhooks/"+hook.ID+"/dead-letters", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"dead_letters":[]`) {
+        t.Errorf("Expected no dead letters, got %d %s", w.Code, w.Body.String())
+    }
+
+    if w = do("DELETE", "/stream/events/webhooks/"+hook.ID, ""); w.Code != http.StatusNoContent {
+        t.Errorf("Expected 204, got %d", w.Code)
+    }
+    w = do("GET", "/stream/events/webhooks/"+hook.ID, "")
+    var problem api.Problem
+    json.Unmarshal(w.Body.Bytes(), &problem)
+    if w.Code != http.StatusNotFound || problem.Code != api.ErrCodeWebhookNotFound {
+        t.Errorf("Expected 404 webhook_not_found, got %d %+v", w.Code, problem)
+    }
+}
+
+// TestCreateWebhookRejectsInvalid checks that bad registrations are 400s.
+func TestCreateWebhookRejectsInvalid(t *testing.T) {
+    useStreams(t, api.StreamInfo{ID: "events"})
+
+    router := mux.NewRouter()
+    router.HandleFunc("/stream/{stream_id}/webhooks", api.CreateWebhook).Methods("POST")
+    for _, body := range []string{`{"url": "http://example.com"}`, `{"url": "http://example.com", "secret": "x", "retries": 3}`, `not json`} {
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, httptest.NewRequest("POST", "/stream/events/webhooks", bytes.NewBufferString(body)))
+        var problem api.Problem
+        json.Unmarshal(w.Body.Bytes(), &problem)
+        if w.Code != http.StatusBadRequest || problem.Code != api.ErrCodeInvalidRequest {
+            t.Errorf("%s: expected 400 invalid_request, got %d %+v", body, w.Code, problem)
+        }
+    }
+}
+
+// memoryReader feeds records to the server's background consumers and keeps
+// the offsets they commit.
+type memoryReader struct {
+    messages  chan kafka.Message
+    mu        sync.Mutex
+    committed []kafka.Message
+}
+
+func (r *memoryReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+    select {
+    case m := <-r.messages:
+        return m, nil
+    case <-ctx.Done():
+        return kafka.Message{}, ctx.Err()
+    }
+}
+
+func (r *memoryReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+    return r.FetchMessage(ctx)
+}
+
+func (r *memoryReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.committed = append(r.committed, msgs...)
+    return nil
+}
+
+func (r *memoryReader) commits() int {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return len(r.committed)
+}
+
+func (r *memoryReader) Stats() kafka.ReaderStats { return kafka.ReaderStats{Lag: int64(len(r.messages))} }
+
+func (r *memoryReader) Close() error { return nil }
+
+// useMemoryReader makes the webhooks and routing rules the test starts read
+// from a memoryReader.
+func useMemoryReader(t testing.TB) *memoryReader {
+    reader := &memoryReader{messages: make(chan kafka.Message, 100)}
+    api.UseGroupReader(func(*api.StreamInfo, string) api.CommittingReader { return reader })
+    t.Cleanup(func() { api.UseGroupReader(nil) })
+    return reader
+}
+
+// eventually fails the test if condition does not hold within five seconds.
+func eventually(t *testing.T, what string, condition func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for !condition() {
+        if time.Now().After(deadline) {
+            t.Fatalf("Timed out waiting for %s", what)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+// webhookFixture is a webhook registered on stream "events" of a persisted
+// webhook store, delivering to a test server.
+type webhookFixture struct {
+    hook     api.WebhookView
+    path     string
+    reader   *memoryReader
+    webhooks *api.WebhookManager
+    router   *mux.Router
+}
+
+func startWebhook(t *testing.T, target, request string) *webhookFixture {
+    t.Helper()
+    t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "127.0.0.1/32")
+    t.Setenv("WEBHOOK_BATCH_LINGER_MS", "20")
+    t.Setenv("WEBHOOK_RETRY_BACKOFF_MS", "1")
+    useStreams(t, api.StreamInfo{ID: "events"})
+    f := &webhookFixture{path: filepath.Join(t.TempDir(), "webhooks.json"), reader: useMemoryReader(t)}
+    var err error
+    if f.webhooks, err = api.NewWebhookManager(f.path); err != nil {
+        t.Fatalf("Failed to open webhook store: %v", err)
+    }
+    api.UseWebhooks(f.webhooks)
+    t.Cleanup(f.webhooks.Close)
+
+    f.router = mux.NewRouter()
+    f.router.HandleFunc("/stream/{stream_id}/webhooks", api.CreateWebhook).Methods("POST")
+    f.router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}", api.GetWebhook).Methods("GET")
+    f.router.HandleFunc("/stream/{stream_id}/webhooks/{webhook_id}/dead-letters", api.GetWebhookDeadLetters).Methods("GET")
+    body := `{"url": "` + target + `", "secret": "s3cret"` + request + `}`
+    w := httptest.NewRecorder()
+    f.router.ServeHTTP(w, httptest.NewRequest("POST", "/stream/events/webhooks", bytes.NewBufferString(body)))
+    if w.Code != http.StatusCreated {
+        t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+    }
+    json.Unmarshal(w.Body.Bytes(), &f.hook)
+    return f
+}
+
+func (f *webhookFixture) status() api.WebhookStatus {
+    w := httptest.NewRecorder()
+    f.router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/events/webhooks/"+f.hook.ID, nil))
+    var view api.WebhookView
+    json.Unmarshal(w.Body.Bytes(), &view)
+    return view.Status
+}
+
+func (f *webhookFixture) deadLetters() []api.DeadLetter {
+    w := httptest.NewRecorder()
+    f.router.ServeHTTP(w, httptest.NewRequest("GET", "/stream/events/webhooks/"+f.hook.ID+"/dead-letters", nil))
+    var body struct {
+        DeadLetters []api.DeadLetter `json:"dead_letters"`
+    }
+    json.Unmarshal(w.Body.Bytes(), &body)
+    return body.DeadLetters
+}
+
+// failingEndpoint answers every delivery with status, counting them.
+func failingEndpoint(t *testing.T, status int) (*httptest.Server, *int32) {
+    var requests int32
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&requests, 1)
+        w.WriteHeader(status)
+    }))
+    t.Cleanup(server.Close)
+    return server, &requests
+}
+
+// TestWebhookDeliversSignedBatches checks a delivery's signature, batching
+// and filtering, and that offsets are committed once it succeeds.
+func TestWebhookDeliversSignedBatches(t *testing.T) {
+    type delivery struct {
+        header http.Header
+        body   []byte
+    }
+    deliveries := make(chan delivery, 10)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        deliveries <- delivery{header: r.Header.Clone(), body: body}
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer server.Close()
+    f := startWebhook(t, server.URL+"/hook", `, "batch_size": 2, "filter": {"tenant": "acme"}`)
+
+    for i, tenant := range []string{"globex", "acme", "acme"} {
+        f.reader.messages <- kafka.Message{Offset: int64(i), Value: []byte("record " + tenant), Headers: []kafka.Header{{Key: "tenant", Value: []byte(tenant)}}}
+    }
+    var got delivery
+    select {
+    case got = <-deliveries:
+    case <-time.After(5 * time.Second):
+        t.Fatal("Timed out waiting for a delivery")
+    }
+    timestamp := got.header.Get(api.WebhookTimestampHeader)
+    if signature := got.header.Get(api.WebhookSignatureHeader); signature != "sha256="+api.SignWebhook("s3cret", timestamp, got.body) {
+        t.Errorf("Signature %q does not match the body", signature)
+    }
+    if got.header.Get(api.WebhookIDHeader) != f.hook.ID {
+        t.Errorf("Expected webhook id %s, got %s", f.hook.ID, got.header.Get(api.WebhookIDHeader))
+    }
+    var payload api.WebhookPayload
+    json.Unmarshal(got.body, &payload)
+    if payload.StreamID != "events" || len(payload.Records) != 2 || payload.Records[0].Data != "record acme" || payload.Records[1].Offset != 2 {
+        t.Errorf("Unexpected payload %s", got.body)
+    }
+    eventually(t, "offsets to be committed", func() bool { return f.reader.commits() == 3 })
+    if status := f.status(); status.Delivered != 2 || status.LastDeliveryAt == nil {
+        t.Errorf("Unexpected status %+v", status)
+    }
+}
+
+// TestWebhookRetriesFailedDeliveries checks that server errors are retried
+// until the endpoint accepts the delivery.
+func TestWebhookRetriesFailedDeliveries(t *testing.T) {
+    var requests int32
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if atomic.AddInt32(&requests, 1) <= 2 {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+    }))
+    defer server.Close()
+    f := startWebhook(t, server.URL, "")
+
+    f.reader.messages <- kafka.Message{Value: []byte("x")}
+    eventually(t, "the delivery", func() bool { return f.status().Delivered == 1 })
+    status := f.status()
+    if atomic.LoadInt32(&requests) != 3 || status.FailedAttempts != 2 || status.DeadLettered != 0 {
+        t.Errorf("Expected 3 requests and 2 failed attempts, got %d %+v", requests, status)
+    }
+    eventually(t, "the offset to be committed", func() bool { return f.reader.commits() == 1 })
+}
+
+// TestWebhookDeadLettersRejectedDeliveries checks that client errors are not
+// retried and that dead letters are persisted with the webhooks.
+func TestWebhookDeadLettersRejectedDeliveries(t *testing.T) {
+    server, requests := failingEndpoint(t, http.StatusBadRequest)
+    f := startWebhook(t, server.URL, "")
+
+    f.reader.messages <- kafka.Message{Value: []byte("x")}
+    eventually(t, "the dead letter", func() bool { return f.status().DeadLettered == 1 })
+    deadLetters := f.deadLetters()
+    if atomic.LoadInt32(requests) != 1 || len(deadLetters) != 1 || deadLetters[0].Attempts != 1 || !strings.Contains(deadLetters[0].Error, "400") {
+        t.Errorf("Expected one rejected attempt, got %d requests and %+v", atomic.LoadInt32(requests), deadLetters)
+    }
+    eventually(t, "the offset to be committed", func() bool { return f.reader.commits() == 1 })
+
+    f.webhooks.Close()
+    reopened, err := api.NewWebhookManager(f.path)
+    if err != nil {
+        t.Fatalf("Failed to reopen webhook store: %v", err)
+    }
+    api.UseWebhooks(reopened)
+    defer reopened.Close()
+    if deadLetters := f.deadLetters(); len(deadLetters) != 1 || deadLetters[0].Records[0].Data != "x" {
+        t.Errorf("Expected the dead letter to survive a restart, got %+v", deadLetters)
+    }
+}
+
+// TestWebhookDeadLettersAfterRetries checks that deliveries move to the dead
+// letters once WEBHOOK_MAX_ATTEMPTS is exhausted.
+func TestWebhookDeadLettersAfterRetries(t *testing.T) {
+    t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+    server, requests := failingEndpoint(t, http.StatusInternalServerError)
+    f := startWebhook(t, server.URL, "")
+
+    f.reader.messages <- kafka.Message{Value: []byte("x")}
+    eventually(t, "the dead letter", func() bool { return f.status().DeadLettered == 1 })
+    if deadLetters := f.deadLetters(); atomic.LoadInt32(requests) != 3 || deadLetters[0].Attempts != 3 {
+        t.Errorf("Expected 3 attempts, got %d requests and %+v", atomic.LoadInt32(requests), deadLetters)
+    }
+}
+
+// TestWebhookStopLeavesRecordsUncommitted checks that stopping a webhook
+// between retries neither commits nor dead-letters the batch.
+func TestWebhookStopLeavesRecordsUncommitted(t *testing.T) {
+    server, requests := failingEndpoint(t, http.StatusServiceUnavailable)
+    f := startWebhook(t, server.URL, "")
+    t.Setenv("WEBHOOK_RETRY_BACKOFF_MS", "60000")
+
+    f.reader.messages <- kafka.Message{Value: []byte("x")}
+    eventually(t, "the first attempt", func() bool { return atomic.LoadInt32(requests) == 1 })
+    f.webhooks.Close()
+    if f.reader.commits() != 0 || f.status().DeadLettered != 0 {
+        t.Errorf("Expected the record to stay uncommitted, got %d commits and %+v", f.reader.commits(), f.status())
+    }
+}
+
+// TestWebhookRefusesInternalAddressesWhenDialing checks that addresses are
+// checked when connecting, not only when the webhook is registered.
+func TestWebhookRefusesInternalAddressesWhenDialing(t *testing.T) {
+    server, requests := failingEndpoint(t, http.StatusOK)
+    f := startWebhook(t, server.URL, "")
+    t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "")
+
+    f.reader.messages <- kafka.Message{Value: []byte("x")}
+    eventually(t, "the dead letter", func() bool { return f.status().DeadLettered == 1 })
+    if deadLetters := f.deadLetters(); atomic.LoadInt32(requests) != 0 || !strings.Contains(deadLetters[0].Error, "not allowed") {
+        t.Errorf("Expected the delivery to be refused, got %d requests and %+v", atomic.LoadInt32(requests), deadLetters)
+    }
+}